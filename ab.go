@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// Variant is content of a poke in an experiment of ABTunnel.
+// Non-empty fields replace those of the poke.
+type Variant struct {
+	Name    string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// apply returns a copy of p with the content of v.
+func (v Variant) apply(p *Poke) *Poke {
+	q := *p
+	if v.Subject != "" {
+		q.Subject = v.Subject
+	}
+	if v.Body != "" {
+		q.Body = v.Body
+	}
+	if v.HTML != "" {
+		q.HTML = v.HTML
+	}
+	return &q
+}
+
+// ABTunnel is a Tunnel that sends pokes with content of one of two variants.
+// A recipient is always assigned the same variant of an experiment, and the variant name
+// is recorded as MetaVariant, so outcomes can be compared per variant from records.
+type ABTunnel struct {
+	t          Tunnel
+	experiment string
+	ratio      float64
+	a, b       Variant
+}
+
+// NewABTunnel returns an ABTunnel sending through t.
+// ratio is the share of recipients assigned a, from 0 to 1; the rest are assigned b.
+// experiment is hashed with recipients, so recipients are split differently by experiments.
+func NewABTunnel(t Tunnel, experiment string, ratio float64, a, b Variant) *ABTunnel {
+	return &ABTunnel{
+		t:          t,
+		experiment: experiment,
+		ratio:      ratio,
+		a:          a,
+		b:          b,
+	}
+}
+
+// Type is a method of Tunnel interface
+func (t ABTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t ABTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t ABTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// It sends p with the content of its variant; p itself is not changed.
+func (t ABTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	v := t.variant(p.To)
+	rec, err := t.t.Send(ctx, v.apply(p))
+	rec.setMeta(MetaVariant, v.Name)
+	return rec, err
+}
+
+// variant returns the variant of recipient to.
+func (t ABTunnel) variant(to string) Variant {
+	h := fnv.New64a()
+	h.Write([]byte(t.experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(to))
+	// the top 53 bits make a uniform float in [0, 1)
+	if float64(h.Sum64()>>11)/(1<<53) < t.ratio {
+		return t.a
+	}
+	return t.b
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+// ErrAlphaSender is returned when an alphanumeric sender ID is invalid,
+// or is used for a destination that does not support it.
+var ErrAlphaSender = errors.New("notify: alphanumeric sender not allowed")
+
+// validateAlphaSender checks id is 1 to 11 characters of letters, digits and spaces,
+// with at least one letter, as twilio requires.
+func validateAlphaSender(id string) error {
+	if len(id) == 0 || len(id) > 11 {
+		return fmt.Errorf("%w: %q must be 1 to 11 characters", ErrAlphaSender, id)
+	}
+	letter := false
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			letter = true
+		case r >= '0' && r <= '9', r == ' ':
+		default:
+			return fmt.Errorf("%w: %q has invalid character %q", ErrAlphaSender, id, r)
+		}
+	}
+	if !letter {
+		return fmt.Errorf("%w: %q must have a letter", ErrAlphaSender, id)
+	}
+	return nil
+}
+
+// NewAlphaSMSTunnel returns a SMSTunnel sending from alphanumeric sender ID sender, e.g. "MyBrand".
+// Alphanumeric senders are one-way: recipients can not reply.
+// Not all countries allow them, so pokes are only sent to numbers of regions,
+// given as ISO 3166 codes known to NormalizePhone; others fail with ErrAlphaSender.
+func NewAlphaSMSTunnel(sender string, regions []string, c *twilio.Twilio, opts ...TunnelOption) (*SMSTunnel, error) {
+	if err := validateAlphaSender(sender); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, len(regions))
+	for _, r := range regions {
+		reg, ok := phoneRegions[strings.ToUpper(r)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown region %q", ErrAlphaSender, r)
+		}
+		codes = append(codes, reg.code)
+	}
+	if c == nil {
+		c = twilio.NewTwilioClient(os.Getenv("TWILIO_SID"), os.Getenv("TWILIO_AUTH_TOKEN"))
+	}
+	t := &SMSTunnel{
+		c:          c,
+		id:         sender,
+		alphaCodes: codes,
+	}
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	t.opts.log().LogAttrs(context.Background(), slog.LevelWarn, "alphanumeric sms sender can not receive replies",
+		slog.String("sender", sender),
+	)
+	return t, nil
+}
+
+// checkAlpha checks a normalized number to can receive from the alphanumeric sender of t.
+// It always passes for tunnels sending from a number.
+func (t SMSTunnel) checkAlpha(to string) error {
+	if t.alphaCodes == nil {
+		return nil
+	}
+	for _, code := range t.alphaCodes {
+		if strings.HasPrefix(to, "+"+code) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrAlphaSender, t.id, to)
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+// ErrBackfillUnsupported is returned by BackfillStatuses for tunnels that can not list the messages they sent.
+var ErrBackfillUnsupported = errors.New("notify: tunnel can not list messages")
+
+// ProviderMessage is a message in the history of a provider.
+type ProviderMessage struct {
+	ProviderID     string    // ID of the message at the provider, as recorded in MetaProviderID
+	Status         string    // status of the message, as the statuses of records
+	ProviderStatus string    // status of the message, as the provider names it
+	TimeStamp      time.Time // when the provider last updated the message
+	ErrorCode      string    // error code of the provider, if any
+}
+
+// MessageLister is a Tunnel that can list the messages its provider sent in a time range.
+type MessageLister interface {
+	// ListMessages returns the messages sent from from until to.
+	ListMessages(ctx context.Context, from, to time.Time) ([]ProviderMessage, error)
+}
+
+// twilioPageSize is the max number of messages of a page of the twilio message list
+const twilioPageSize = 1000
+
+// twilioMessagePage is a page of the twilio message list
+type twilioMessagePage struct {
+	Messages []struct {
+		twilio.SmsResponse
+		ErrorCode *int `json:"error_code"`
+	} `json:"messages"`
+	NextPageURI string `json:"next_page_uri"`
+}
+
+// ListMessages is a method of MessageLister interface. It pages the twilio message list,
+// filtered by the dates messages are sent. Messages never sent, e.g. failed before sending, are not listed.
+func (t SMSTunnel) ListMessages(ctx context.Context, from, to time.Time) ([]ProviderMessage, error) {
+	base, err := url.Parse(t.c.BaseUrl)
+	if err != nil {
+		return nil, err
+	}
+	// twilio filters by day, the days of from and to included; the range is cut to the second below
+	q := url.Values{}
+	q.Set("DateSent>=", from.UTC().Format("2006-01-02"))
+	q.Set("DateSent<=", to.UTC().Format("2006-01-02"))
+	q.Set("PageSize", fmt.Sprint(twilioPageSize))
+	u := t.c.BaseUrl + "/Accounts/" + t.c.AccountSid + "/Messages.json?" + q.Encode()
+
+	var msgs []ProviderMessage
+	for u != "" {
+		var page twilioMessagePage
+		ex, _, err := t.twilioRequest(ctx, http.MethodGet, u, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		if ex != nil {
+			return nil, fmt.Errorf("twilio exception: %w", *ex)
+		}
+		for _, m := range page.Messages {
+			if sent, err := m.DateSentAsTime(); err == nil && (sent.Before(from) || !sent.Before(to)) {
+				continue
+			}
+			msg := ProviderMessage{
+				ProviderID:     m.Sid,
+				Status:         m.Status,
+				ProviderStatus: m.Status,
+			}
+			if status, ok := twilioStatuses[m.Status]; ok {
+				msg.Status = status
+			}
+			if msg.TimeStamp, err = m.DateUpdateAsTime(); err != nil {
+				msg.TimeStamp = time.Now()
+			}
+			if m.ErrorCode != nil {
+				msg.ErrorCode = fmt.Sprint(*m.ErrorCode)
+			}
+			msgs = append(msgs, msg)
+		}
+
+		u = ""
+		if page.NextPageURI != "" {
+			// next pages are given as paths on the host of the api
+			next, err := base.Parse(page.NextPageURI)
+			if err != nil {
+				return nil, err
+			}
+			u = next.String()
+		}
+	}
+	return msgs, nil
+}
+
+// BackfillStatuses reconciles records of messages sent through t from from until to with the
+// statuses the provider has of them, e.g. after callbacks were lost in an outage.
+// Messages whose latest record is of another status than the provider's get a record of it,
+// made as its callback would be, so a late callback of the same status is not recorded again.
+// Messages the store has no record of are ignored. It returns how many messages are updated,
+// and fails with ErrBackfillUnsupported if t is not a MessageLister.
+func (d *Dispatcher) BackfillStatuses(ctx context.Context, t Tunnel, from, to time.Time) (updated int, err error) {
+	ml, ok := t.(MessageLister)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrBackfillUnsupported, t.Type())
+	}
+	msgs, err := ml.ListMessages(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ProviderID
+	}
+	history, err := d.store.GetRecordsByProviderID(ctx, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	var recs []Record
+	for _, m := range msgs {
+		hist := history[m.ProviderID]
+		if len(hist) == 0 {
+			continue
+		}
+		last := hist[len(hist)-1]
+		if last.Status == m.Status {
+			continue
+		}
+		rec := Record{
+			MessageID:  last.MessageID,
+			Status:     m.Status,
+			TimeStamp:  m.TimeStamp,
+			Type:       t.Type(),
+			TenantID:   last.TenantID,
+			CampaignID: last.CampaignID,
+			OwnerUID:   last.OwnerUID,
+		}
+		rec.setMeta(MetaProviderID, m.ProviderID)
+		rec.setMeta(MetaEventID, m.ProviderID+"/"+m.ProviderStatus)
+		if m.ErrorCode != "" {
+			rec.setMeta(MetaErrorCode, m.ErrorCode)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	created, err := d.store.CreateRecords(ctx, recs...)
+	return len(created), err
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+func TestSMSTunnelListMessages(t *testing.T) {
+	day := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		wantFrom string // DateSent>= of the request
+		wantTo   string // DateSent<= of the request
+		wantSIDs []string
+	}{
+		{"one day outage", day.Add(9 * time.Hour), day.Add(17 * time.Hour), "2020-03-04", "2020-03-04", []string{"SM2"}},
+		{"across days", day.Add(-time.Hour), day.Add(17 * time.Hour), "2020-03-03", "2020-03-04", []string{"SM1", "SM2"}},
+		{"whole day", day, day.Add(24 * time.Hour), "2020-03-04", "2020-03-05", []string{"SM2", "SM3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if q.Get("DateSent>=") != tt.wantFrom || q.Get("DateSent<=") != tt.wantTo {
+					t.Errorf("query %s, want DateSent>=%s and DateSent<=%s", r.URL.RawQuery, tt.wantFrom, tt.wantTo)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"messages": [
+					{"sid": "SM1", "status": "delivered", "date_sent": "Tue, 03 Mar 2020 23:30:00 +0000"},
+					{"sid": "SM2", "status": "undelivered", "date_sent": "Wed, 04 Mar 2020 12:00:00 +0000", "error_code": 30003},
+					{"sid": "SM3", "status": "delivered", "date_sent": "Wed, 04 Mar 2020 23:59:59 +0000"}
+				]}`))
+			}))
+			defer srv.Close()
+			c := twilio.NewTwilioClient("AC1", "token")
+			c.BaseUrl = srv.URL
+			tun := NewSMSTunnel("+15555550100", c)
+
+			msgs, err := tun.ListMessages(context.Background(), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sids []string
+			for _, m := range msgs {
+				sids = append(sids, m.ProviderID)
+			}
+			if len(sids) != len(tt.wantSIDs) {
+				t.Fatalf("listed %v, want %v", sids, tt.wantSIDs)
+			}
+			for i := range sids {
+				if sids[i] != tt.wantSIDs[i] {
+					t.Errorf("listed %v, want %v", sids, tt.wantSIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestBackfillStatusesUnsupported(t *testing.T) {
+	s, _ := newFakeStore(t)
+	d := NewDispatcher(s, NewRegistry())
+	_, err := d.BackfillStatuses(context.Background(), &fakeTunnel{}, time.Now().Add(-time.Hour), time.Now())
+	if !errors.Is(err, ErrBackfillUnsupported) || errors.Is(err, ErrVerifyUnsupported) {
+		t.Errorf("BackfillStatuses error = %v, want ErrBackfillUnsupported", err)
+	}
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/sync/singleflight"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrBacklogFull is returned by Create when the store holds as many pending pokes as
+// its max backlog, see WithMaxBacklog. Producers should back off and retry later.
+var ErrBacklogFull = errors.New("notify: backlog full")
+
+// backlogCounter caches counts of pending pokes by tenant, for WithMaxBacklog.
+type backlogCounter struct {
+	max int
+	ttl time.Duration
+
+	mu     sync.Mutex
+	counts map[string]backlogCount
+	// refresh counts a tenant once for the creates that find its count expired together
+	refresh singleflight.Group
+}
+
+type backlogCount struct {
+	n  int
+	at time.Time
+}
+
+// CountPending counts the pokes not archived yet, due or not, by an aggregation query.
+func (s *firePokeStore) CountPending(ctx context.Context) (int, error) {
+	n, err := s.countQuery(ctx, s.pokeQuery())
+	if err != nil {
+		return 0, firePokeStoreErr{
+			err,
+			"count_pending",
+			"",
+		}
+	}
+	return n, nil
+}
+
+// checkBacklog returns ErrBacklogFull if the backlog of the tenant of ctx is full.
+// Counts are cached for the ttl of WithMaxBacklog, and counted up by creates in between.
+// Concurrent creates wait for one count of the expired backlog.
+// If the backlog can not be counted, creates go on, as a failed count says nothing of the backlog.
+func (s *firePokeStore) checkBacklog(ctx context.Context) error {
+	b := s.backlog
+	if b == nil {
+		return nil
+	}
+	tenant := TenantFrom(ctx)
+	b.mu.Lock()
+	c, ok := b.counts[tenant]
+	b.mu.Unlock()
+	if !ok || time.Since(c.at) > b.ttl {
+		v, err, _ := b.refresh.Do(tenant, func() (interface{}, error) {
+			n, err := s.CountPending(ctx)
+			if err != nil {
+				return nil, err
+			}
+			c := backlogCount{n: n, at: time.Now()}
+			b.mu.Lock()
+			b.counts[tenant] = c
+			b.mu.Unlock()
+			return c, nil
+		})
+		if err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "count backlog failed", slog.Any("error", err))
+			return nil
+		}
+		c = v.(backlogCount)
+	}
+	if c.n >= b.max {
+		return ErrBacklogFull
+	}
+	return nil
+}
+
+// countCreated counts a created poke into the cached backlog of the tenant of ctx.
+func (s *firePokeStore) countCreated(ctx context.Context) {
+	b := s.backlog
+	if b == nil {
+		return
+	}
+	tenant := TenantFrom(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.counts[tenant]; ok {
+		c.n++
+		b.counts[tenant] = c
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckBacklog(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		pending int
+		want    error
+	}{
+		{"empty", 1, 0, nil},
+		{"below max", 3, 2, nil},
+		{"full", 2, 2, ErrBacklogFull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			for i := 0; i < tt.pending; i++ {
+				if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			WithMaxBacklog(tt.max, time.Hour)(s)
+			if err := s.checkBacklog(ctx); !errors.Is(err, tt.want) {
+				t.Errorf("checkBacklog = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBacklogCountsOnce(t *testing.T) {
+	s, f := newFakeStore(t, WithMaxBacklog(10, time.Hour))
+	f.hold = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.checkBacklog(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// let the creates find the count missing before it is done
+	time.Sleep(50 * time.Millisecond)
+	close(f.hold)
+	wg.Wait()
+	if f.aggs != 1 {
+		t.Errorf("%d backlog counts, want 1", f.aggs)
+	}
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerTunnel when it refuses to send.
+var ErrCircuitOpen = errors.New("notify: circuit open")
+
+// BreakerConfig configures a CircuitBreakerTunnel
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive failures to open the circuit
+	Cooldown         time.Duration // how long the circuit stays open before a trial send
+	SuccessThreshold int           // successful trial sends to close the circuit
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreakerTunnel is a Tunnel that stops sending through a failing tunnel for a while.
+// It should be initialize by NewCircuitBreakerTunnel()
+type CircuitBreakerTunnel struct {
+	t   Tunnel
+	cfg BreakerConfig
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool // a trial send is in flight
+}
+
+// NewCircuitBreakerTunnel returns a CircuitBreakerTunnel wrapping t.
+// Thresholds less than 1 are taken as 1.
+func NewCircuitBreakerTunnel(t Tunnel, cfg BreakerConfig) *CircuitBreakerTunnel {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.SuccessThreshold < 1 {
+		cfg.SuccessThreshold = 1
+	}
+	return &CircuitBreakerTunnel{
+		t:   t,
+		cfg: cfg,
+	}
+}
+
+// Type is a method of Tunnel interface
+func (t *CircuitBreakerTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t *CircuitBreakerTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t *CircuitBreakerTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// While the circuit is open, Send returns a StatusQueued Record and ErrCircuitOpen
+// without calling the wrapped tunnel. After the cooldown, one trial send at a time is allowed.
+// Only failures of the provider which may pass, see transientSend, count as failures; pokes rejected
+// as invalid, e.g. of a malformed number, do not open the circuit for the others.
+// Sends the wrapped tunnel refuses for now, like ErrBudgetExceeded, count neither way.
+func (t *CircuitBreakerTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	if !t.allow() {
+		return Record{
+			MessageID: p.ID,
+			Status:    StatusQueued,
+			TimeStamp: time.Now(),
+		}, ErrCircuitOpen
+	}
+	rec, err := t.t.Send(ctx, p)
+	if shouldRequeue(err) {
+		t.release()
+	} else {
+		t.done(!transientSend(rec.Status, err))
+	}
+	return rec, err
+}
+
+func (t *CircuitBreakerTunnel) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.state {
+	case breakerOpen:
+		if time.Since(t.openedAt) < t.cfg.Cooldown {
+			return false
+		}
+		t.state = breakerHalfOpen
+		t.successes = 0
+		fallthrough
+	case breakerHalfOpen:
+		if t.trial {
+			return false
+		}
+		t.trial = true
+	}
+	return true
+}
+
+func (t *CircuitBreakerTunnel) done(ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == breakerHalfOpen {
+		t.trial = false
+		if !ok {
+			t.open()
+			return
+		}
+		t.successes++
+		if t.successes >= t.cfg.SuccessThreshold {
+			t.state = breakerClosed
+			t.failures = 0
+		}
+		return
+	}
+
+	if ok {
+		t.failures = 0
+		return
+	}
+	t.failures++
+	if t.failures >= t.cfg.FailureThreshold {
+		t.open()
+	}
+}
+
+// release ends a trial send without an outcome.
+func (t *CircuitBreakerTunnel) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trial = false
+}
+
+func (t *CircuitBreakerTunnel) open() {
+	t.state = breakerOpen
+	t.openedAt = time.Now()
+	t.failures = 0
+	t.successes = 0
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTunnel(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		err      error
+		wantOpen bool
+	}{
+		{"delivered", StatusDelivered, nil, false},
+		{"failed", StatusFailed, errors.New("unavailable"), true},
+		{"timed out", StatusError, context.DeadlineExceeded, true},
+		{"rate limited", StatusFailed, &RateLimitError{Err: errors.New("too many requests")}, true},
+		{"invalid", StatusError, ErrInvalidPhone, false},
+		{"undelivered", StatusUndelivered, errors.New("rejected"), false},
+		{"refused", StatusQueued, ErrBudgetExceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tun := &fakeTunnel{status: tt.status, err: tt.err}
+			cb := NewCircuitBreakerTunnel(tun, BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour})
+			for i := 0; i < 2; i++ {
+				cb.Send(context.Background(), &Poke{ID: "p"})
+			}
+			_, err := cb.Send(context.Background(), &Poke{ID: "p"})
+			if open := errors.Is(err, ErrCircuitOpen); open != tt.wantOpen {
+				t.Errorf("open = %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is returned by BudgetedTunnel when the spend of the period reaches the cap.
+var ErrBudgetExceeded = errors.New("notify: budget exceeded")
+
+// Period returns the start of the budget period containing t.
+type Period func(t time.Time) time.Time
+
+// Monthly is a Period of calendar months.
+func Monthly(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
+
+// Daily is a Period of calendar days.
+func Daily(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Budget tracks spend of a period against a cap. Spend resets when a new period begins.
+// A Budget is safe for concurrent use.
+type Budget struct {
+	cap    float64
+	period Period
+
+	mu    sync.Mutex
+	start time.Time
+	spent float64
+}
+
+// NewBudget returns a Budget of cap per period.
+func NewBudget(cap float64, period Period) *Budget {
+	return &Budget{
+		cap:    cap,
+		period: period,
+		start:  period(time.Now()),
+	}
+}
+
+// roll resets the spend if a new period began. b.mu must be held.
+func (b *Budget) roll() {
+	if start := b.period(time.Now()); !start.Equal(b.start) {
+		b.start = start
+		b.spent = 0
+	}
+}
+
+// Add adds cost to the spend of current period.
+func (b *Budget) Add(cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.spent += cost
+}
+
+// reserve adds cost to the spend of current period, unless the spend reaches the cap.
+// It returns the start of the period reserved in, to settle the reservation.
+func (b *Budget) reserve(cost float64) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	if b.spent >= b.cap {
+		return b.start, false
+	}
+	b.spent += cost
+	return b.start, true
+}
+
+// settle replaces a reservation of reserved in the period of start by the actual cost.
+// If a new period began since, the reservation is gone, and cost is spent in the new period.
+func (b *Budget) settle(start time.Time, reserved, cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	if b.start.Equal(start) {
+		cost -= reserved
+	}
+	b.spent += cost
+}
+
+// Spent returns the spend of current period.
+func (b *Budget) Spent() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	return b.spent
+}
+
+// Exceeded reports whether the spend of current period reaches the cap.
+func (b *Budget) Exceeded() bool {
+	return b.Spent() >= b.cap
+}
+
+// recordCost returns the cost of rec, or else the price reported in its metadata.
+func recordCost(rec Record) (float64, bool) {
+	if rec.Cost > 0 {
+		return rec.Cost, true
+	}
+	v, ok := rec.Metadata[MetaPrice]
+	if !ok {
+		return 0, false
+	}
+	return parsePrice(v)
+}
+
+// BudgetedTunnel is a Tunnel that refuses to send once its Budget is exceeded.
+type BudgetedTunnel struct {
+	t        Tunnel
+	b        *Budget
+	estimate float64
+}
+
+// NewBudgetedTunnel returns a BudgetedTunnel spending b.
+// estimate is the cost taken for a sent poke whose Record has no price.
+func NewBudgetedTunnel(t Tunnel, b *Budget, estimate float64) *BudgetedTunnel {
+	return &BudgetedTunnel{
+		t:        t,
+		b:        b,
+		estimate: estimate,
+	}
+}
+
+// Type is a method of Tunnel interface
+func (t BudgetedTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t BudgetedTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t BudgetedTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// When the budget is exceeded, it returns a StatusQueued Record and ErrBudgetExceeded
+// without calling the wrapped tunnel. The estimate is reserved in the budget before sending,
+// so concurrent sends pass the cap by one estimate at most, and replaced by the cost
+// of the Record once sent; a failed send without a price costs nothing.
+func (t BudgetedTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start, ok := t.b.reserve(t.estimate)
+	if !ok {
+		return Record{
+			MessageID: p.ID,
+			Status:    StatusQueued,
+			TimeStamp: time.Now(),
+		}, ErrBudgetExceeded
+	}
+	rec, err := t.t.Send(ctx, p)
+	cost, ok := recordCost(rec)
+	if !ok && err == nil {
+		cost = t.estimate
+	}
+	t.b.settle(start, t.estimate, cost)
+	return rec, err
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowTunnel is a Tunnel taking a while to send, with rec, safe for concurrent use.
+type slowTunnel struct {
+	rec  Record
+	err  error
+	sent atomic.Int32
+}
+
+func (t *slowTunnel) describe() string { return "slow" }
+func (t *slowTunnel) Type() string     { return TypeSMS }
+func (t *slowTunnel) ID() string       { return "slow" }
+
+func (t *slowTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	t.sent.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return t.rec, t.err
+}
+
+func TestBudgetedTunnelConcurrent(t *testing.T) {
+	tun := &slowTunnel{rec: Record{Status: StatusQueued}}
+	bt := NewBudgetedTunnel(tun, NewBudget(3, Monthly), 1)
+
+	var wg sync.WaitGroup
+	var exceeded atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := bt.Send(context.Background(), &Poke{ID: "p"}); errors.Is(err, ErrBudgetExceeded) {
+				exceeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := tun.sent.Load(); n != 3 || exceeded.Load() != 7 {
+		t.Errorf("%d sent and %d refused, want 3 and 7", n, exceeded.Load())
+	}
+}
+
+func TestBudgetedTunnelSpend(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  Record
+		err  error
+		want float64
+	}{
+		{"estimated", Record{Status: StatusQueued}, nil, 1},
+		{"priced", Record{Status: StatusQueued, Cost: 0.25}, nil, 0.25},
+		{"price in metadata", Record{Status: StatusQueued, Metadata: map[string]string{MetaPrice: "-0.5"}}, nil, 0.5},
+		{"failed", Record{Status: StatusFailed}, errors.New("unavailable"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBudget(10, Monthly)
+			bt := NewBudgetedTunnel(&slowTunnel{rec: tt.rec, err: tt.err}, b, 1)
+			bt.Send(context.Background(), &Poke{ID: "p"})
+			if got := b.Spent(); got != tt.want {
+				t.Errorf("spent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
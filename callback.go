@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+// twilioStatuses maps twilio message statuses to statuses.
+// Other twilio statuses, like "sent", are recorded as is.
+var twilioStatuses = map[string]string{
+	"queued":      StatusQueued,
+	"delivered":   StatusDelivered,
+	"undelivered": StatusUndelivered,
+	"failed":      StatusFailed,
+	"read":        StatusRead,
+}
+
+// callbackRetryAfter is the Retry-After of a callback posted before the record of its send is written.
+const callbackRetryAfter = 30 * time.Second
+
+// TwilioCallbackHandler records status callbacks of messages sent by SMSTunnel.
+// The poke ID is given in query "id", and its campaign and owner in queries "campaign" and "owner",
+// which SMSTunnel adds to its callback URLs.
+// Twilio may post a callback more than once; a status of a message is recorded once.
+// A Price posted with a callback is set on the record of the send, see UpdateCost.
+// If that record is not written yet, e.g. it is buffered by WithRecordWriter,
+// the callback is answered 503 with a Retry-After, for twilio to post it again.
+// Callbacks are checked to be signed by c, with baseURL, e.g. "https://example.com",
+// prepended to the request url.
+//
+// If c is nil, signatures are NOT checked: anyone can post forged statuses and prices of any poke.
+// Pass nil in tests only; a warning is logged when such a handler is made.
+func TwilioCallbackHandler(store PokeStore, c *twilio.Twilio, baseURL string) http.HandlerFunc {
+	if c == nil {
+		slog.Warn("twilio callbacks are not checked to be signed by twilio")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if c != nil {
+			ok, err := c.CheckRequestSignature(r, baseURL)
+			if err != nil || !ok {
+				http.Error(w, "invalid twilio signature", http.StatusForbidden)
+				return
+			}
+		}
+
+		id := r.URL.Query().Get("id")
+		sid := r.PostFormValue("MessageSid")
+		st := r.PostFormValue("MessageStatus")
+		if id == "" || sid == "" || st == "" {
+			http.Error(w, "missing message id, sid or status", http.StatusBadRequest)
+			return
+		}
+		status, ok := twilioStatuses[st]
+		if !ok {
+			status = st
+		}
+
+		rec := Record{
+			MessageID:  id,
+			Status:     status,
+			TimeStamp:  time.Now(),
+			CampaignID: r.URL.Query().Get("campaign"),
+			OwnerUID:   r.URL.Query().Get("owner"),
+		}
+		rec.setMeta(MetaProviderID, sid)
+		rec.setMeta(MetaEventID, sid+"/"+st)
+		if code := r.PostFormValue("ErrorCode"); code != "" {
+			rec.setMeta(MetaErrorCode, code)
+		}
+		if _, err := store.CreateRecord(r.Context(), rec); err != nil {
+			slog.ErrorContext(r.Context(), "record twilio callback failed", slog.String("poke_id", id), slog.Any("error", err))
+			http.Error(w, "could not record status", http.StatusInternalServerError)
+			return
+		}
+		// a price, once twilio has it, goes to the record of the send, not the record of the callback
+		if cost, ok := parsePrice(r.PostFormValue("Price")); ok {
+			currency := r.PostFormValue("PriceUnit")
+			if currency == "" {
+				currency = twilioCurrency
+			}
+			err := store.UpdateCost(r.Context(), id, cost, currency)
+			if errors.Is(err, ErrNotFound) {
+				// the record of the send is not flushed yet; the status is recorded, its price is not
+				w.Header().Set("Retry-After", strconv.Itoa(int(callbackRetryAfter/time.Second)))
+				http.Error(w, "send not recorded yet", http.StatusServiceUnavailable)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "update cost failed", slog.String("poke_id", id), slog.Any("error", err))
+				http.Error(w, "could not record price", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
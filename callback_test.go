@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwilioCallbackHandlerPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		sent      bool // the record of the send is written
+		wantCode  int
+		wantRetry bool
+		wantCost  float64
+	}{
+		{"send recorded", true, http.StatusNoContent, false, 0.0075},
+		{"send not flushed", false, http.StatusServiceUnavailable, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			if tt.sent {
+				if _, err := s.CreateRecord(ctx, Record{MessageID: "p1", Status: StatusQueued, Type: TypeSMS, TimeStamp: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			form := url.Values{
+				"MessageSid":    {"SM1"},
+				"MessageStatus": {"delivered"},
+				"Price":         {"-0.0075"},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/callback?id=p1", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			TwilioCallbackHandler(s, nil, "").ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("Retry-After") != ""; got != tt.wantRetry {
+				t.Errorf("Retry-After set = %v, want %v", got, tt.wantRetry)
+			}
+			recs, err := s.GetRecord(ctx, "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var delivered bool
+			var cost float64
+			for _, r := range recs {
+				delivered = delivered || r.Status == StatusDelivered
+				cost += r.Cost
+			}
+			if !delivered {
+				t.Error("delivered status not recorded")
+			}
+			if cost != tt.wantCost {
+				t.Errorf("cost = %v, want %v", cost, tt.wantCost)
+			}
+		})
+	}
+}
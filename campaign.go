@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+)
+
+// CampaignStats counts pokes of a campaign, see Poke.CampaignID.
+// Delivered and Failed count records, so a poke failed and retried counts once per failed attempt,
+// and a status recorded by a callback counts only if the callback carries the campaign.
+type CampaignStats struct {
+	Total     int // pokes queued or archived
+	Queued    int // pokes not sent yet
+	Archived  int // pokes sent, expired or skipped
+	Delivered int // records of StatusDelivered
+	Failed    int // records of StatusFailed, StatusUndelivered and StatusError
+}
+
+// CampaignStatus returns stats of campaign by aggregation queries, without reading pokes.
+func (s *firePokeStore) CampaignStatus(ctx context.Context, campaign string) (CampaignStats, error) {
+	var st CampaignStats
+	for _, c := range []struct {
+		q   firestore.Query
+		dst *int
+	}{
+		{s.pokeQuery().Where("campaign_id", "==", campaign), &st.Queued},
+		{s.archiveQuery().Where("campaign_id", "==", campaign), &st.Archived},
+		{s.recCol.Where("campaign_id", "==", campaign).
+			Where("status", "==", StatusDelivered), &st.Delivered},
+		{s.recCol.Where("campaign_id", "==", campaign).
+			Where("status", "in", []string{StatusFailed, StatusUndelivered, StatusError}), &st.Failed},
+	} {
+		q, err := s.scope(ctx, c.q)
+		var res firestore.AggregationResult
+		if err == nil {
+			res, err = s.count(ctx, q)
+		}
+		if err != nil {
+			return CampaignStats{}, firePokeStoreErr{
+				err,
+				"campaign_status",
+				campaign,
+			}
+		}
+		if v, ok := res["count"].(*firestorepb.Value); ok {
+			*c.dst = int(v.GetIntegerValue())
+		}
+	}
+	st.Total = st.Queued + st.Archived
+	return st, nil
+}
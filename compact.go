@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// LatestRecord returns the latest record of message messageID, reading only it rather than
+// the whole history of GetRecord. It returns an error matching ErrNotFound if the message has no record.
+// It needs a composite index of message_id and timestamp descending.
+func (s *firePokeStore) LatestRecord(ctx context.Context, messageID string) (*Record, error) {
+	q, err := s.scope(ctx, s.recCol.Where("message_id", "==", messageID).
+		OrderBy("timestamp", firestore.Desc).Limit(1))
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
+	if err == nil && len(docs) == 0 {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"latest_record",
+			messageID,
+		}
+	}
+	rec := new(Record)
+	if err := docs[0].DataTo(rec); err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"latest_record",
+			"unmarshal record ID = " + docs[0].Ref.ID,
+		}
+	}
+	rec.ID = docs[0].Ref.ID
+	return rec, nil
+}
+
+// CompactRecords collapses the records of message messageID between the record of its send,
+// which keeps its cost, and the latest, into the History of the latest, and deletes them.
+// Up to 498 records are collapsed at a time, the writes of a transaction; call it again for more.
+//
+// Collapsed records are no longer counted by RecordStats, and provider events of them may be
+// recorded again if the provider posts them again; compact messages that are settled.
+func (s *firePokeStore) CompactRecords(ctx context.Context, messageID string) error {
+	start := time.Now()
+	q, err := s.scope(ctx, s.recCol.Where("message_id", "==", messageID))
+	if err != nil {
+		return firePokeStoreErr{
+			err,
+			"compact_records",
+			messageID,
+		}
+	}
+	var collapsed []*Record
+	// records are read in the transaction, so a record added meanwhile, e.g. by a callback, is not deleted
+	err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		collapsed = nil
+		docs, err := tx.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+		recs := make([]*Record, 0, len(docs))
+		for _, d := range docs {
+			rec := new(Record)
+			if err := d.DataTo(rec); err != nil {
+				return err
+			}
+			rec.ID = d.Ref.ID
+			recs = append(recs, rec)
+		}
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].TimeStamp.Before(recs[j].TimeStamp)
+		})
+		if len(recs) < 3 {
+			return nil
+		}
+		latest := recs[len(recs)-1]
+		var sent *Record
+		for _, r := range recs {
+			if r.Type != "" {
+				sent = r
+				break
+			}
+		}
+
+		for _, r := range recs[:len(recs)-1] {
+			if r == sent {
+				continue
+			}
+			if len(collapsed) == maxTxWrites-2 {
+				break
+			}
+			collapsed = append(collapsed, r)
+		}
+		if len(collapsed) == 0 {
+			return nil
+		}
+		history := append([]RecordEntry(nil), latest.History...)
+		for _, r := range collapsed {
+			history = append(history, r.History...)
+			history = append(history, RecordEntry{
+				Status:    r.Status,
+				TimeStamp: r.TimeStamp,
+				Metadata:  r.Metadata,
+			})
+		}
+		sort.SliceStable(history, func(i, j int) bool {
+			return history[i].TimeStamp.Before(history[j].TimeStamp)
+		})
+
+		err = tx.Update(s.recCol.Doc(latest.ID), []firestore.Update{
+			{Path: "history", Value: history},
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range collapsed {
+			if err := tx.Delete(s.recCol.Doc(r.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.logOp(ctx, "compact_records", start, err, slog.String("poke_id", messageID), slog.Int("records", len(collapsed)))
+	if err != nil {
+		return firePokeStoreErr{
+			err,
+			"compact_records",
+			messageID,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCompactRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		records     int // records after the send
+		wantLeft    int
+		wantHistory int
+	}{
+		{"send only", 0, 1, 0},
+		{"too few", 1, 2, 0},
+		{"collapsed", 3, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			recs := []Record{{MessageID: "p1", Status: StatusQueued, Type: TypeSMS, TimeStamp: now}}
+			for i := 1; i <= tt.records; i++ {
+				r := Record{MessageID: "p1", Status: StatusDelivered, TimeStamp: now.Add(time.Duration(i) * time.Second)}
+				r.setMeta(MetaEventID, strconv.Itoa(i))
+				recs = append(recs, r)
+			}
+			for _, r := range recs {
+				if _, err := s.CreateRecord(ctx, r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.CompactRecords(ctx, "p1"); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.GetRecord(ctx, "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantLeft {
+				t.Fatalf("%d records left, want %d", len(got), tt.wantLeft)
+			}
+			latest, err := s.LatestRecord(ctx, "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(latest.History) != tt.wantHistory {
+				t.Errorf("latest record has %d history entries, want %d", len(latest.History), tt.wantHistory)
+			}
+			var sent bool
+			for _, r := range got {
+				sent = sent || r.Type == TypeSMS
+			}
+			if !sent {
+				t.Error("record of the send was collapsed")
+			}
+		})
+	}
+}
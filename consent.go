@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ErrNoConsent is returned by ConsentTunnel for a marketing poke to a recipient not opted in.
+var ErrNoConsent = errors.New("notify: recipient has not consented")
+
+// ErrConsentUnavailable is returned by ConsentTunnel when opt-ins can not be checked, e.g. firestore is down.
+// The Dispatcher keeps the poke queued for the next run.
+var ErrConsentUnavailable = errors.New("notify: consent unavailable")
+
+// consent is an opt-in of a recipient to a channel
+type consent struct {
+	To        string    `firestore:"to"` // normalized, see recipientKey
+	Channel   string    `firestore:"channel,omitempty"`
+	TimeStamp time.Time `firestore:"timestamp"`
+	Expires   time.Time `firestore:"expires,omitempty"`
+}
+
+// ConsentStore is a list of recipients opted in to marketing, in a firestore collection,
+// a document per recipient and channel. Opt-ins recorded before they were kept per channel,
+// a document per recipient, are not read; record them again.
+// It should be initialized by NewConsentStore.
+type ConsentStore struct {
+	c   *firestore.Client
+	col *firestore.CollectionRef
+	ttl time.Duration
+}
+
+// NewConsentStore returns a ConsentStore in collection col.
+// Opt-ins expire ttl after they are recorded; a ttl of 0 means they do not expire.
+func NewConsentStore(c *firestore.Client, col string, ttl time.Duration) *ConsentStore {
+	return &ConsentStore{c: c, col: c.Collection(col), ttl: ttl}
+}
+
+// doc returns the document of the opt-in of recipient to through channel.
+// Phone numbers with a country code are normalized first, so they match however they are written.
+func (s *ConsentStore) doc(to, channel string) *firestore.DocumentRef {
+	return s.col.Doc(recipientDocID(recipientKey(to) + "\x00" + channel))
+}
+
+// RecordConsent records recipient to opted in to marketing through channel, a tunnel type
+// like TypeSMS. An empty channel is an opt-in to every channel.
+// Opt-ins to channels are kept apart; recording one again replaces it, and restarts its expiry.
+func (s *ConsentStore) RecordConsent(ctx context.Context, to, channel string) error {
+	now := time.Now()
+	c := consent{
+		To:        recipientKey(to),
+		Channel:   channel,
+		TimeStamp: now,
+	}
+	if s.ttl > 0 {
+		c.Expires = now.Add(s.ttl)
+	}
+	_, err := s.doc(to, channel).Set(ctx, c)
+	return err
+}
+
+// RevokeConsent removes the opt-ins of recipient to through every channel, if any,
+// as an opt-out, like a STOP reply, is of all marketing.
+// It needs a single field index of "to", which firestore has by default.
+func (s *ConsentStore) RevokeConsent(ctx context.Context, to string) error {
+	q := s.col.Where("to", "==", recipientKey(to))
+	return s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, d := range docs {
+			if err := tx.Delete(d.Ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Consented reports whether recipient to has an unexpired opt-in covering channel:
+// an opt-in through channel, or through every channel.
+func (s *ConsentStore) Consented(ctx context.Context, to, channel string) (bool, error) {
+	refs := []*firestore.DocumentRef{s.doc(to, channel)}
+	if channel != "" {
+		refs = append(refs, s.doc(to, ""))
+	}
+	docs, err := s.c.GetAll(ctx, refs)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var c consent
+		if err := doc.DataTo(&c); err != nil {
+			return false, err
+		}
+		if c.Expires.IsZero() || now.Before(c.Expires) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConsentTunnel is a Tunnel that sends marketing pokes only to recipients opted in,
+// as TCPA requires of marketing SMS. Transactional pokes are sent without a check.
+// It should be initialized by NewConsentTunnel.
+type ConsentTunnel struct {
+	t     Tunnel
+	store *ConsentStore
+}
+
+// NewConsentTunnel returns a ConsentTunnel wrapping t, checking opt-ins in store
+// for the channel of t's type.
+func NewConsentTunnel(t Tunnel, store *ConsentStore) *ConsentTunnel {
+	return &ConsentTunnel{t: t, store: store}
+}
+
+// Type is a method of Tunnel interface
+func (t *ConsentTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t *ConsentTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t *ConsentTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// A marketing poke to a recipient not opted in is not sent: it returns a StatusSuppressed Record
+// and ErrNoConsent, so the Dispatcher records and archives it. If the opt-in can not be checked,
+// the poke is not sent either: it returns a StatusQueued Record and ErrConsentUnavailable,
+// so the Dispatcher keeps it queued.
+func (t *ConsentTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	if !p.Marketing {
+		return t.t.Send(ctx, p)
+	}
+	ok, err := t.store.Consented(ctx, p.To, t.t.Type())
+	if err != nil {
+		return Record{
+			MessageID: p.ID,
+			Status:    StatusQueued,
+			TimeStamp: time.Now(),
+		}, fmt.Errorf("%w: check consent of %s: %v", ErrConsentUnavailable, p.ID, err)
+	}
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrNoConsent, p.To)
+		rec := Record{
+			MessageID: p.ID,
+			Status:    StatusSuppressed,
+			TimeStamp: time.Now(),
+		}
+		rec.setMeta(MetaReason, err.Error())
+		return rec, err
+	}
+	return t.t.Send(ctx, p)
+}
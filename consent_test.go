@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsentStore(t *testing.T) {
+	type consent struct{ to, channel string }
+	tests := []struct {
+		name     string
+		recorded []consent
+		revoked  string
+		check    consent
+		want     bool
+	}{
+		{"none", nil, "", consent{"+15555550100", TypeSMS}, false},
+		{"channel", []consent{{"+15555550100", TypeSMS}}, "", consent{"+15555550100", TypeSMS}, true},
+		{"other channel", []consent{{"+15555550100", TypeEmail}}, "", consent{"+15555550100", TypeSMS}, false},
+		{"every channel", []consent{{"+15555550100", ""}}, "", consent{"+15555550100", TypeSMS}, true},
+		{"second channel keeps the first", []consent{{"+15555550100", TypeSMS}, {"+15555550100", TypeEmail}}, "", consent{"+15555550100", TypeSMS}, true},
+		{"second channel", []consent{{"+15555550100", TypeSMS}, {"+15555550100", TypeEmail}}, "", consent{"+15555550100", TypeEmail}, true},
+		{"written differently", []consent{{"+1 (555) 555-0100", TypeSMS}}, "", consent{"+15555550100", TypeSMS}, true},
+		{"revoked", []consent{{"+15555550100", TypeSMS}}, "+15555550100", consent{"+15555550100", TypeSMS}, false},
+		{"revoked written differently", []consent{{"+15555550100", TypeSMS}}, "+1 555 555 0100", consent{"+15555550100", TypeSMS}, false},
+		{"revoked every channel", []consent{{"+15555550100", TypeSMS}, {"+15555550100", ""}}, "+15555550100", consent{"+15555550100", TypeSMS}, false},
+		{"revoked other recipient", []consent{{"+15555550100", TypeSMS}}, "+15555550199", consent{"+15555550100", TypeSMS}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeClient(t)
+			s := NewConsentStore(c, "consents", 0)
+			ctx := context.Background()
+			for _, r := range tt.recorded {
+				if err := s.RecordConsent(ctx, r.to, r.channel); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.revoked != "" {
+				if err := s.RevokeConsent(ctx, tt.revoked); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := s.Consented(ctx, tt.check.to, tt.check.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Consented(%q, %q) = %v, want %v", tt.check.to, tt.check.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsentExpires(t *testing.T) {
+	c, _ := newFakeClient(t)
+	s := NewConsentStore(c, "consents", time.Nanosecond)
+	ctx := context.Background()
+	if err := s.RecordConsent(ctx, "+15555550100", TypeSMS); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if ok, err := s.Consented(ctx, "+15555550100", TypeSMS); err != nil || ok {
+		t.Errorf("Consented after expiry = %v, %v, want false", ok, err)
+	}
+}
+
+func TestConsentTunnelUnavailable(t *testing.T) {
+	c, _ := newFakeClient(t)
+	tun := &fakeTunnel{status: StatusQueued}
+	ct := NewConsentTunnel(tun, NewConsentStore(c, "consents", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec, err := ct.Send(ctx, &Poke{ID: "p1", To: "+15555550100", Body: "sale", Marketing: true})
+	if !errors.Is(err, ErrConsentUnavailable) || !shouldRequeue(err) {
+		t.Fatalf("Send error = %v, want ErrConsentUnavailable to requeue", err)
+	}
+	if rec.Status != StatusQueued || tun.sent != 0 {
+		t.Errorf("status = %q and %d sent, want StatusQueued and none sent", rec.Status, tun.sent)
+	}
+}
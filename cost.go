@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+)
+
+// twilioCurrency is the currency of twilio prices. gotwilio does not expose the price unit
+// of messages, which is USD unless the account is billed otherwise.
+const twilioCurrency = "USD"
+
+// parsePrice parses a price reported by a provider as a cost.
+// Providers like twilio report prices as negative amounts.
+func parsePrice(v string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+	return math.Abs(f), true
+}
+
+// SumCost sums Cost of records from from until to, of tenant, or of all tenants if tenant is "".
+// Costs are summed whatever their currency; tunnels of one currency are assumed.
+// Summing is done by firestore, it needs a composite index of tenant_id and timestamp.
+func (s *firePokeStore) SumCost(ctx context.Context, from, to time.Time, tenant string) (float64, error) {
+	q := s.recCol.Where("timestamp", ">=", from).Where("timestamp", "<", to)
+	if tenant != "" {
+		q = q.Where("tenant_id", "==", tenant)
+	}
+	q, err := s.scope(ctx, q)
+	var res firestore.AggregationResult
+	if err == nil {
+		err = s.retryRead(ctx, func() error {
+			res, err = q.NewAggregationQuery().WithSum("cost", "cost").Get(ctx)
+			return err
+		})
+	}
+	if err != nil {
+		return 0, firePokeStoreErr{
+			err,
+			"sum_cost",
+			tenant,
+		}
+	}
+	v, _ := res["cost"].(*firestorepb.Value)
+	if _, ok := v.GetValueType().(*firestorepb.Value_DoubleValue); ok {
+		return v.GetDoubleValue(), nil
+	}
+	return float64(v.GetIntegerValue()), nil
+}
+
+// UpdateCost sets the cost of message messageID, reported after it was sent, e.g. by a callback,
+// on the record written when it was sent, the first one of a tunnel Type, rather than adding a record.
+// It returns an error matching ErrNotFound if the message has no such record.
+func (s *firePokeStore) UpdateCost(ctx context.Context, messageID string, cost float64, currency string) error {
+	start := time.Now()
+	recs, err := s.GetRecord(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	var sent *Record
+	for _, r := range recs {
+		if r.Type != "" && (sent == nil || r.TimeStamp.Before(sent.TimeStamp)) {
+			sent = r
+		}
+	}
+	if sent == nil {
+		return firePokeStoreErr{
+			ErrNotFound,
+			"update_cost",
+			messageID,
+		}
+	}
+	_, err = s.recCol.Doc(sent.ID).Update(ctx, []firestore.Update{
+		{Path: "cost", Value: cost},
+		{Path: "currency", Value: currency},
+	})
+	s.logOp(ctx, "update_cost", start, err, slog.String("poke_id", messageID))
+	if err != nil {
+		return firePokeStoreErr{
+			err,
+			"update_cost",
+			messageID,
+		}
+	}
+	return nil
+}
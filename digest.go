@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDigestPending is the error of a poke buffered in a digest not sent yet.
+// The poke stays queued, and is recorded and archived when its digest is sent.
+var ErrDigestPending = errors.New("notify: poke pending in a digest")
+
+// DigestTunnel is a Tunnel that buffers pokes per recipient, and tenant, for a window,
+// then sends them as a single poke through the wrapped tunnel.
+// It should be initialize by NewDigestTunnel()
+type DigestTunnel struct {
+	t      Tunnel
+	store  PokeStore
+	window time.Duration
+	sep    string
+	opts   tunnelOptions
+
+	mu       sync.Mutex
+	pending  map[digestKey]*digest
+	buffered map[string]bool // IDs of pokes buffered or being sent in a digest
+	closed   bool
+}
+
+// digestKey is the tenant and the recipient of the pokes of a digest
+type digestKey struct {
+	tenant, to string
+}
+
+type digest struct {
+	pokes []*Poke
+	timer *time.Timer
+}
+
+// NewDigestTunnel returns a DigestTunnel. Bodies of buffered pokes are joined by sep.
+// store, which must be the store of the Dispatcher, keeps buffered pokes queued until their digest is sent,
+// so pokes buffered by a process stopped are sent by the next. When a digest is sent, every poke in it
+// is recorded and archived in store, see CompleteSend; the records carry the IDs of all pokes of the digest
+// in metadata MetaDigestOf. A digest failed to send, but may pass, is recorded and its pokes are put off
+// for a window; a digest refused for now, e.g. by a CircuitBreakerTunnel, leaves its pokes queued.
+func NewDigestTunnel(t Tunnel, store PokeStore, window time.Duration, sep string, opts ...TunnelOption) *DigestTunnel {
+	d := &DigestTunnel{
+		t:        t,
+		store:    store,
+		window:   window,
+		sep:      sep,
+		pending:  make(map[digestKey]*digest),
+		buffered: make(map[string]bool),
+	}
+	for _, o := range opts {
+		o(&d.opts)
+	}
+	return d
+}
+
+// Type is a method of Tunnel interface
+func (t *DigestTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t *DigestTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t *DigestTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// It buffers p and returns a StatusQueued Record with ErrDigestPending, so the Dispatcher leaves p queued.
+// The digest of p's recipient is sent when the window since its first poke ends.
+// A poke buffered already, e.g. listed again by the next run, is not buffered twice.
+// Pokes with content a digest has no room for, HTML, media, a callback url or an event,
+// and pokes sent after Close, are sent right away on their own.
+func (t *DigestTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	queued := Record{
+		MessageID: p.ID,
+		Status:    StatusQueued,
+		TimeStamp: time.Now(),
+	}
+	if !digestible(p) {
+		return t.t.Send(ctx, p)
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return t.t.Send(ctx, p)
+	}
+	if t.buffered[p.ID] {
+		t.mu.Unlock()
+		return queued, ErrDigestPending
+	}
+	t.buffered[p.ID] = true
+	key := digestKey{p.TenantID, p.To}
+	d, ok := t.pending[key]
+	if !ok {
+		d = &digest{}
+		d.timer = time.AfterFunc(t.window, func() {
+			if err := t.flush(context.Background(), key); err != nil {
+				t.opts.log().Error("send digest failed", slog.String("to", key.to), slog.Any("error", err))
+			}
+		})
+		t.pending[key] = d
+	}
+	d.pokes = append(d.pokes, p)
+	t.mu.Unlock()
+	return queued, ErrDigestPending
+}
+
+// digestible reports whether p can be joined in a digest: it has no content but its subject and body.
+func digestible(p *Poke) bool {
+	return p.HTML == "" && len(p.MediaURL) == 0 && p.CallbackURL == "" && p.Event == nil
+}
+
+// Flush sends all buffered digests now.
+func (t *DigestTunnel) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	keys := make([]digestKey, 0, len(t.pending))
+	for key := range t.pending {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		if err := t.flush(ctx, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops buffering and flushes. It should be called on shutdown.
+func (t *DigestTunnel) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	return t.Flush(ctx)
+}
+
+// flush sends the digest of key, if any, and records and archives its pokes.
+func (t *DigestTunnel) flush(ctx context.Context, key digestKey) error {
+	t.mu.Lock()
+	d, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+		d.timer.Stop()
+	}
+	t.mu.Unlock()
+	if !ok || len(d.pokes) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(d.pokes))
+	for _, dp := range d.pokes {
+		ids = append(ids, dp.ID)
+	}
+	// pokes are buffered again only once done with, recorded or not
+	defer func() {
+		t.mu.Lock()
+		for _, id := range ids {
+			delete(t.buffered, id)
+		}
+		t.mu.Unlock()
+	}()
+
+	rec, sendErr := t.t.Send(ctx, t.combine(d.pokes))
+	if shouldRequeue(sendErr) {
+		return fmt.Errorf("send digest of %s: %w", strings.Join(ids, ","), sendErr)
+	}
+	rec.Type = t.Type()
+	rec.setMeta(MetaDigestOf, strings.Join(ids, ","))
+
+	retry := transientSend(rec.Status, sendErr)
+	for _, dp := range d.pokes {
+		r := rec
+		r.ID = ""
+		r.MessageID = dp.ID
+		r = withPokeMetadata(r, dp)
+		var err error
+		if retry {
+			if _, err = t.store.CreateRecord(ctx, r); err == nil {
+				err = t.store.Reschedule(ctx, dp.ID, time.Now().Add(t.window))
+			}
+		} else {
+			_, err = t.store.CompleteSend(ctx, dp.ID, r)
+		}
+		if err != nil {
+			t.opts.log().ErrorContext(ctx, "record digest failed", slog.String("poke_id", dp.ID), slog.Any("error", err))
+		}
+	}
+	if sendErr != nil {
+		return fmt.Errorf("send digest of %s: %w", strings.Join(ids, ","), sendErr)
+	}
+	return nil
+}
+
+// combine makes a digest poke of pokes, digestible all, of a tenant and recipient.
+// It takes ID, tunnel and subject of the first poke. It is marketing if any poke is,
+// so it is sent as marketing, e.g. checked for consent, and has the campaign and owner
+// of the pokes if they share them.
+func (t *DigestTunnel) combine(pokes []*Poke) *Poke {
+	first := pokes[0]
+	if len(pokes) == 1 {
+		return first
+	}
+	bodies := make([]string, 0, len(pokes))
+	var marketing bool
+	for _, p := range pokes {
+		bodies = append(bodies, p.Body)
+		marketing = marketing || p.Marketing
+	}
+	return &Poke{
+		ID:         first.ID,
+		Tunnel:     first.Tunnel,
+		To:         first.To,
+		Subject:    first.Subject,
+		Body:       strings.Join(bodies, t.sep),
+		DateToSend: time.Now(),
+		Metadata:   first.Metadata,
+		Marketing:  marketing,
+		TenantID:   first.TenantID,
+		CampaignID: shared(pokes, func(p *Poke) string { return p.CampaignID }),
+		OwnerUID:   shared(pokes, func(p *Poke) string { return p.OwnerUID }),
+	}
+}
+
+// shared returns field of pokes if all pokes have the same, or "".
+func shared(pokes []*Poke, field func(*Poke) string) string {
+	v := field(pokes[0])
+	for _, p := range pokes[1:] {
+		if field(p) != v {
+			return ""
+		}
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDigestTunnel(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		err         error
+		wantPending int // pokes queued after the digest is sent
+		wantRecords int
+	}{
+		{"delivered", StatusDelivered, nil, 0, 2},
+		{"undelivered", StatusUndelivered, errors.New("rejected"), 0, 2},
+		{"failed", StatusFailed, errors.New("unavailable"), 2, 2},
+		{"refused", StatusQueued, ErrCircuitOpen, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newFakeStore(t)
+			ctx := context.Background()
+			tun := &fakeTunnel{status: tt.status, err: tt.err}
+			dt := NewDigestTunnel(tun, s, time.Hour, "\n")
+			reg := NewRegistry()
+			reg.Register(TypeSMS, dt)
+			d := NewDispatcher(s, reg)
+
+			for _, body := range []string{"one", "two"} {
+				if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: body}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the second run lists the buffered pokes again
+			for i := 0; i < 2; i++ {
+				if err := d.Run(ctx); err != nil {
+					t.Fatalf("Run error = %v", err)
+				}
+			}
+			if n := f.count("pokes"); n != 2 || tun.sent != 0 {
+				t.Fatalf("%d pokes queued and %d sent before the digest, want 2 queued and none sent", n, tun.sent)
+			}
+
+			if err := dt.Flush(ctx); !errors.Is(err, tt.err) {
+				t.Fatalf("Flush error = %v, want %v", err, tt.err)
+			}
+			if tun.sent != 1 {
+				t.Errorf("%d sent, want a digest", tun.sent)
+			}
+			if n := f.count("pokes"); n != tt.wantPending {
+				t.Errorf("%d pokes queued, want %d", n, tt.wantPending)
+			}
+			if n := f.count("archives"); n != 2-tt.wantPending {
+				t.Errorf("%d pokes archived, want %d", n, 2-tt.wantPending)
+			}
+			if n := f.count("records"); n != tt.wantRecords {
+				t.Errorf("%d records, want %d", n, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestDigestTunnelNotDigestible(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Poke
+	}{
+		{"html", Poke{HTML: "<p>hi</p>"}},
+		{"media", Poke{MediaURL: []string{"https://example.com/a.png"}}},
+		{"callback", Poke{CallbackURL: "https://example.com/status"}},
+		{"event", Poke{Event: &CalendarEvent{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			tun := &fakeTunnel{status: StatusDelivered}
+			dt := NewDigestTunnel(tun, s, time.Hour, "\n")
+			p := tt.p
+			p.ID, p.To, p.Body = "p1", "+15555550100", "hi"
+			rec, err := dt.Send(context.Background(), &p)
+			if err != nil || rec.Status != StatusDelivered || tun.sent != 1 {
+				t.Errorf("Send = %q, %v with %d sent, want sent at once", rec.Status, err, tun.sent)
+			}
+		})
+	}
+}
+
+func TestDigestCombine(t *testing.T) {
+	tests := []struct {
+		name          string
+		pokes         []*Poke
+		wantMarketing bool
+		wantCampaign  string
+	}{
+		{"transactional", []*Poke{{ID: "a", CampaignID: "c1"}, {ID: "b", CampaignID: "c1"}}, false, "c1"},
+		{"marketing", []*Poke{{ID: "a", Marketing: true}, {ID: "b", Marketing: true}}, true, ""},
+		{"some marketing", []*Poke{{ID: "a"}, {ID: "b", Marketing: true}}, true, ""},
+		{"campaigns differ", []*Poke{{ID: "a", CampaignID: "c1"}, {ID: "b", CampaignID: "c2"}}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, p := range tt.pokes {
+				p.TenantID, p.To, p.Body = "t1", "+15555550100", p.ID
+			}
+			dt := NewDigestTunnel(&fakeTunnel{}, nil, time.Hour, "\n")
+			got := dt.combine(tt.pokes)
+			if got.Marketing != tt.wantMarketing || got.CampaignID != tt.wantCampaign || got.TenantID != "t1" {
+				t.Errorf("combine = marketing %v, campaign %q, tenant %q, want %v, %q, %q",
+					got.Marketing, got.CampaignID, got.TenantID, tt.wantMarketing, tt.wantCampaign, "t1")
+			}
+		})
+	}
+}
+
+func TestDigestTenants(t *testing.T) {
+	tun := &fakeTunnel{status: StatusDelivered}
+	s, _ := newFakeStore(t)
+	dt := NewDigestTunnel(tun, s, time.Hour, "\n")
+	ctx := context.Background()
+	for _, tenant := range []string{"t1", "t2"} {
+		p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.TenantID = tenant
+		if _, err := dt.Send(ctx, p); !errors.Is(err, ErrDigestPending) {
+			t.Fatalf("Send error = %v, want ErrDigestPending", err)
+		}
+	}
+	if err := dt.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tun.sent != 2 {
+		t.Errorf("%d digests sent, want one a tenant", tun.sent)
+	}
+}
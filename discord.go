@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DiscordTunnel sends pokes to a discord channel through a webhook.
+// The body is sent as the content, and the subject, if any, as the title of an embed.
+type DiscordTunnel struct {
+	webhook string
+	opts    tunnelOptions
+}
+
+// NewDiscordTunnel returns a DiscordTunnel posting to webhookURL.
+// A poke whose To is an https url is posted there instead.
+func NewDiscordTunnel(webhookURL string, opts ...TunnelOption) *DiscordTunnel {
+	t := &DiscordTunnel{webhook: webhookURL}
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	return t
+}
+
+// Type is a method of Tunnel interface
+func (DiscordTunnel) Type() string { return TypeDiscord }
+
+// ID is a method of Tunnel interface.
+// It is the webhook ID, as the token in the webhook url is a secret.
+func (t DiscordTunnel) ID() string {
+	u, err := url.Parse(t.webhook)
+	if err != nil {
+		return ""
+	}
+	// the path is /api/webhooks/{id}/{token}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) >= 2 {
+		return parts[len(parts)-2]
+	}
+	return u.Host
+}
+
+// describe is a method of resource interface
+func (t DiscordTunnel) describe() string {
+	return fmt.Sprintf("service/%s/tunnel/%s/id/%s", "notify", t.Type(), t.ID())
+}
+
+type discordEmbed struct {
+	Title string `json:"title"`
+}
+
+type discordMessage struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+// Send posts a poke to the webhook.
+func (t DiscordTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t DiscordTunnel) send(ctx context.Context, p *Poke) (Record, error) {
+	rec := Record{MessageID: p.ID}
+
+	webhook := t.webhook
+	if strings.HasPrefix(p.To, "https://") {
+		webhook = p.To
+	}
+	u, err := url.Parse(webhook)
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, errors.New("discord: invalid webhook url")
+	}
+	// wait for the message to be created, to get its ID
+	q := u.Query()
+	q.Set("wait", "true")
+	u.RawQuery = q.Encode()
+
+	msg := discordMessage{Content: p.Body}
+	if p.Subject != "" {
+		msg.Embeds = []discordEmbed{{Title: p.Subject}}
+	}
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(bs))
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, errors.New("discord: invalid webhook url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	rec.TimeStamp = time.Now()
+	if err != nil {
+		rec.Status = StatusError
+		// the url has the token, keep it out of errors.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return rec, fmt.Errorf("discord: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		rec.Status = StatusFailed
+		return rec, &RateLimitError{RetryAfter: discordRetryAfter(resp.Header, body), Err: errors.New("discord webhook: " + resp.Status)}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		rec.Status = StatusFailed
+		return rec, fmt.Errorf("discord webhook: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(body, &created) == nil && created.ID != "" {
+		rec.setMeta(MetaProviderID, created.ID)
+	}
+	rec.Status = StatusDelivered
+	return rec, nil
+}
+
+// discordRetryAfter returns how long discord asks to wait, given in seconds by the body,
+// or else by the Retry-After header.
+func discordRetryAfter(h http.Header, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &limited) == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	return retryAfter(h)
+}
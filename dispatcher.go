@@ -0,0 +1,505 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// requeueErrs are errors of tunnels refusing to send for now.
+// Pokes failed with them stay queued for the next run.
+var requeueErrs = []error{
+	ErrCircuitOpen,
+	ErrBudgetExceeded,
+	ErrTunnelPaused,
+	ErrConsentUnavailable,
+	ErrDigestPending,
+}
+
+func shouldRequeue(err error) bool {
+	for _, e := range requeueErrs {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher sends due pokes through tunnels, records and archives them.
+// Tunnels given to a Dispatcher should not be wrapped by LogWrapper, the Dispatcher records by itself.
+type Dispatcher struct {
+	store   PokeStore
+	tunnels *Registry
+
+	workerID string
+	lease    time.Duration
+	hooks    []PreSendHook
+
+	maxAttempts int
+	backoff     time.Duration
+
+	records *BufferedRecordWriter
+
+	testRecipient string
+	testMode      bool
+
+	estimates map[string]costEstimate // by tunnel Type
+
+	locker   *Locker
+	lockName string
+	lockTTL  time.Duration
+
+	concurrency int
+	mu          sync.Mutex
+	closed      bool
+	inflight    sync.WaitGroup
+}
+
+// ErrDispatcherClosed is returned by Run after the Dispatcher is shut down.
+var ErrDispatcherClosed = errors.New("notify: dispatcher shut down")
+
+// PreSendHook is called by the Dispatcher before sending a poke.
+// Returning an error wrapping ErrSuppressed archives the poke as suppressed instead of sending it.
+// Other errors keep the poke queued, so a hook failing to check does not drop pokes.
+type PreSendHook func(ctx context.Context, p *Poke) error
+
+// DispatcherOption configures a Dispatcher
+type DispatcherOption func(*Dispatcher)
+
+// WithPreSendHook makes the Dispatcher call hooks, in order, before sending every poke.
+func WithPreSendHook(hooks ...PreSendHook) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.hooks = append(d.hooks, hooks...)
+	}
+}
+
+// WithRecordWriter makes the Dispatcher buffer records of sends to retry in w, instead of creating one per send.
+// Records of pokes archived or dead lettered are created right away, as a crash before a flush would lose them.
+// Records buffered by w have no ID. Shutdown flushes w, but does not close it.
+func WithRecordWriter(w *BufferedRecordWriter) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.records = w
+	}
+}
+
+// WithTestRecipient makes the Dispatcher send pokes flagged Test to to, a catch-all recipient,
+// instead of their To, which is recorded as MetaOriginalTo.
+// A Dispatcher without a test recipient records pokes flagged Test as StatusSkipped, never sending them.
+func WithTestRecipient(to string) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.testRecipient = to
+	}
+}
+
+// WithTestMode makes the Dispatcher take every poke as flagged Test, e.g. in staging,
+// so nothing is sent to real recipients.
+func WithTestMode() DispatcherOption {
+	return func(d *Dispatcher) {
+		d.testMode = true
+	}
+}
+
+// costEstimate is a cost of a send, see WithCostEstimate
+type costEstimate struct {
+	cost     float64
+	currency string
+}
+
+// WithCostEstimate makes the Dispatcher take cost in currency as the Cost of pokes sent
+// by tunnels of typ, whose records have no cost, marked by MetaCostEstimated.
+func WithCostEstimate(typ string, cost float64, currency string) DispatcherOption {
+	return func(d *Dispatcher) {
+		if d.estimates == nil {
+			d.estimates = make(map[string]costEstimate)
+		}
+		d.estimates[typ] = costEstimate{cost, currency}
+	}
+}
+
+// WithLock makes Run take lock name of l for ttl before sending, so of dispatchers sharing the lock,
+// one runs at a time; the others find the lock taken, and return from Run without sending.
+// The lock is renewed while Run goes on, and released after. If a renewal fails, the lock may
+// be taken by another dispatcher, so Run aborts: its context is cancelled, sends in flight are
+// aborted, pokes not started stay queued, and Run returns ErrLockLost.
+// ttl should be well over the time to renew it.
+func WithLock(l *Locker, name string, ttl time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.locker = l
+		d.lockName = name
+		d.lockTTL = ttl
+	}
+}
+
+// WithConcurrency makes the Dispatcher send up to n pokes at the same time. The default is 1.
+func WithConcurrency(n int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.concurrency = n
+	}
+}
+
+// WithClaim makes the Dispatcher claim pokes as workerID for lease before sending them,
+// so several dispatchers can run at the same time without sending a poke twice.
+func WithClaim(workerID string, lease time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.workerID = workerID
+		d.lease = lease
+	}
+}
+
+// maxBackoff caps the delay between attempts of a poke.
+const maxBackoff = 24 * time.Hour
+
+// WithRetry makes the Dispatcher retry pokes failed transiently, up to maxAttempts sends in all.
+// A failed poke is rescheduled after backoff, doubled on every attempt, and kept in the store,
+// so retries survive restarts. It is dead lettered when it runs out of attempts, see ListDeadLettered.
+// Pokes with a MaxAttempts are retried up to it instead, after a minute doubled without WithRetry.
+// Sends are transient failures if their status is StatusFailed, they time out, or are rate limited.
+// Pokes rate limited with a RateLimitError telling when to retry are retried then, instead of after backoff.
+func WithRetry(maxAttempts int, backoff time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.backoff = backoff
+	}
+}
+
+// defaultBackoff is the first delay of retries, for pokes of a MaxAttempts sent without WithRetry.
+const defaultBackoff = time.Minute
+
+// transientSend reports whether a send, failed with status and err, may go through if retried.
+func transientSend(status string, err error) bool {
+	return err != nil && (status == StatusFailed || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRateLimited))
+}
+
+// maxAttemptsOf returns the sends p gets: its MaxAttempts, or else the one of WithRetry.
+func (d *Dispatcher) maxAttemptsOf(p *Poke) int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return d.maxAttempts
+}
+
+// retryAt returns when to retry p, failed with status and err.
+// It returns false if p should not be retried.
+func (d *Dispatcher) retryAt(p *Poke, status string, err error) (time.Time, bool) {
+	if !transientSend(status, err) || p.Attempts+1 >= d.maxAttemptsOf(p) {
+		return time.Time{}, false
+	}
+	var limited *RateLimitError
+	if errors.As(err, &limited) && limited.RetryAfter > 0 {
+		if limited.RetryAfter > maxBackoff {
+			return time.Now().Add(maxBackoff), true
+		}
+		return time.Now().Add(limited.RetryAfter), true
+	}
+	backoff := d.backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	delay := maxBackoff
+	if p.Attempts < 32 {
+		if b := backoff << uint(p.Attempts); b > 0 && b < maxBackoff {
+			delay = b
+		}
+	}
+	return time.Now().Add(delay), true
+}
+
+// NewDispatcher returns a Dispatcher. A poke is sent by the tunnel registered under
+// the poke's Tunnel, or else by a tunnel whose Type is the poke's Tunnel.
+func NewDispatcher(store PokeStore, tunnels *Registry, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		store:   store,
+		tunnels: tunnels,
+	}
+	for _, o := range opts {
+		o(d)
+	}
+	return d
+}
+
+// due returns pokes to send in a run.
+func (d *Dispatcher) due(ctx context.Context) ([]*Poke, error) {
+	if d.workerID != "" {
+		return d.store.ClaimToSend(ctx, d.workerID, d.lease, 0)
+	}
+	return d.store.ListToSend(ctx)
+}
+
+// Run sends all due pokes once. It keeps going when a poke fails,
+// and returns errors of all failed pokes. With WithLock, it sends nothing if the lock is taken.
+// Pokes through the same tunnel to the same recipient are sent one at a time, oldest due first,
+// so sequential reminders arrive in order; pokes to different recipients are sent concurrently,
+// up to WithConcurrency, in no set order.
+// After Shutdown, Run starts no more sends; pokes not started stay queued.
+// To stop sending, call Shutdown rather than cancel ctx, which aborts sends in flight.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	if d.locker != nil {
+		held, release, acquired, err := d.locker.Lock(ctx, d.lockName, d.lockTTL)
+		if err != nil {
+			return fmt.Errorf("lock %s: %w", d.lockName, err)
+		}
+		if !acquired {
+			return nil
+		}
+		defer release()
+		ctx = held
+	}
+	if !d.begin() {
+		return ErrDispatcherClosed
+	}
+	pokes, err := d.due(ctx)
+	d.inflight.Done()
+	if err != nil {
+		return err
+	}
+
+	n := d.concurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, queue := range recipientQueues(pokes) {
+		wg.Add(1)
+		go func(queue []*Poke) {
+			defer wg.Done()
+			for _, p := range queue {
+				started, err := d.sendOne(ctx, sem, p)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("dispatch %s: %w", p.ID, err))
+					mu.Unlock()
+				}
+				if !started {
+					return
+				}
+			}
+		}(queue)
+	}
+	wg.Wait()
+	if cause := context.Cause(ctx); errors.Is(cause, ErrLockLost) {
+		errs = append(errs, cause)
+	}
+	return errors.Join(errs...)
+}
+
+// sendOne dispatches p, in a slot of its tunnel and of sem. It reports false if p is not started,
+// as d is shut down or the lock of Run lost; then pokes not started stay queued.
+func (d *Dispatcher) sendOne(ctx context.Context, sem chan struct{}, p *Poke) (bool, error) {
+	// wait for the tunnel before taking a slot of d,
+	// so pokes of a busy tunnel do not hold up pokes of others.
+	release := d.tunnels.acquire(p)
+	defer release()
+	sem <- struct{}{}
+	defer func() { <-sem }()
+	if errors.Is(context.Cause(ctx), ErrLockLost) || !d.begin() {
+		return false, nil
+	}
+	defer d.inflight.Done()
+	return true, d.dispatch(ctx, p)
+}
+
+// recipientQueues splits pokes, in due order, into queues of pokes through the same tunnel to
+// the same recipient, see recipientKey, in due order, ordered by their first poke.
+func recipientQueues(pokes []*Poke) [][]*Poke {
+	type key struct{ tunnel, to string }
+	idx := make(map[key]int)
+	var queues [][]*Poke
+	for _, p := range pokes {
+		k := key{p.Tunnel, recipientKey(p.To)}
+		i, ok := idx[k]
+		if !ok {
+			i = len(queues)
+			idx[k] = i
+			queues = append(queues, nil)
+		}
+		queues[i] = append(queues[i], p)
+	}
+	return queues
+}
+
+// begin counts a piece of work in flight. It reports false if d is shut down.
+func (d *Dispatcher) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.inflight.Add(1)
+	return true
+}
+
+// Shutdown stops d from starting sends, and waits for sends in flight to finish.
+// It returns ctx.Err() if ctx is done first; the sends go on in the background.
+// Records are written as sends finish; with WithRecordWriter, they are flushed after.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if d.records != nil {
+		return d.records.Flush(ctx)
+	}
+	return nil
+}
+
+// record writes rec of a poke staying queued, through the record writer of d if any.
+// Records of pokes about to leave the queue must not be buffered, as the poke is not sent again
+// if the record is lost; they are written with the archive, see CompleteSend.
+func (d *Dispatcher) record(ctx context.Context, rec Record) (Record, error) {
+	if d.records != nil {
+		// a failed flush keeps rec buffered, so only a closed writer loses it
+		if err := d.records.Write(ctx, rec); errors.Is(err, ErrWriterClosed) {
+			return rec, err
+		}
+		return rec, nil
+	}
+	return d.store.CreateRecord(ctx, rec)
+}
+
+// dispatch sends a poke, records the result and archives it.
+// Failed pokes are rescheduled, with WithRetry. Expired pokes, or past their NotAfter, and pokes
+// without a tunnel, are recorded as StatusExpired and StatusSkipped, and archived without sending.
+func (d *Dispatcher) dispatch(ctx context.Context, p *Poke) error {
+	now := time.Now()
+	if !p.Expiry.IsZero() && now.After(p.Expiry) {
+		_, err := d.skip(ctx, p, StatusExpired, "", nil)
+		return err
+	}
+	if p.late(now) {
+		_, err := d.skip(ctx, p, StatusExpired, "", errors.New("send window ended"))
+		return err
+	}
+
+	t, err := d.tunnels.ResolveTunnel(p)
+	if err != nil {
+		if _, serr := d.skip(ctx, p, StatusSkipped, "", err); serr != nil {
+			return serr
+		}
+		return err
+	}
+	_, err = d.deliver(ctx, t, p)
+	if shouldRequeue(err) {
+		return nil
+	}
+	return err
+}
+
+// SendNow sends p through t right away, without waiting for a run, and returns its Record.
+// p is validated and created in the store first, then sent, recorded and archived as
+// Run does, with the hooks of d. Tunnels refusing to send for now, like an open
+// CircuitBreakerTunnel, leave p queued for a run, and their error is returned.
+// A p due later is sent now too, unless t schedules it at the provider, like an SMSTunnel
+// WithMessagingService; this is the only way pokes are scheduled at twilio.
+func (d *Dispatcher) SendNow(ctx context.Context, t Tunnel, p *Poke) (Record, error) {
+	if err := p.Validate(); err != nil {
+		return Record{}, err
+	}
+	created, err := d.store.Create(ctx, p)
+	if err != nil {
+		return Record{}, err
+	}
+	return d.deliver(ctx, t, created)
+}
+
+// deliver runs the hooks, sends p through t, records the result and archives p.
+// The record of an archived poke is written with the archive, and has no ID.
+func (d *Dispatcher) deliver(ctx context.Context, t Tunnel, p *Poke) (Record, error) {
+	for _, h := range d.hooks {
+		err := h(ctx, p)
+		if errors.Is(err, ErrSuppressed) {
+			return d.skip(ctx, p, StatusSuppressed, t.Type(), err)
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+
+	send := p
+	test := p.Test || d.testMode
+	if test {
+		if d.testRecipient == "" {
+			return d.skip(ctx, p, StatusSkipped, t.Type(), errors.New("test poke without a test recipient"))
+		}
+		q := *p
+		q.To = d.testRecipient
+		send = &q
+	}
+
+	rec, sendErr := t.Send(ctx, send)
+	if shouldRequeue(sendErr) {
+		return rec, sendErr
+	}
+	rec.Type = t.Type()
+	if est, ok := d.estimates[rec.Type]; ok && rec.Cost == 0 && sendErr == nil {
+		rec.Cost = est.cost
+		rec.Currency = est.currency
+		rec.setMeta(MetaCostEstimated, "true")
+	}
+	rec = withPokeMetadata(rec, p)
+	if test {
+		rec.setMeta(MetaOriginalTo, p.To)
+	}
+	if next, ok := d.retryAt(p, rec.Status, sendErr); ok {
+		saved, err := d.record(ctx, rec)
+		if err != nil {
+			return rec, err
+		}
+		rec = saved
+		if err := d.store.Reschedule(ctx, p.ID, next); err != nil {
+			return rec, err
+		}
+		return rec, sendErr
+	}
+	if d.maxAttemptsOf(p) > 0 && transientSend(rec.Status, sendErr) {
+		// out of attempts. a failed send is not sent again, so the record is written first
+		saved, err := d.store.CreateRecord(ctx, rec)
+		if err != nil {
+			return rec, err
+		}
+		rec = saved
+		reason := fmt.Sprintf("failed %d attempts: %v", p.Attempts+1, sendErr)
+		if _, err := d.store.DeadLetter(ctx, p.ID, reason); err != nil {
+			return rec, err
+		}
+		return rec, sendErr
+	}
+	// recorded and archived at once, so a poke recorded as sent is never left queued to send again
+	if _, err := d.store.CompleteSend(ctx, p.ID, rec); err != nil {
+		return rec, err
+	}
+	return rec, sendErr
+}
+
+// skip records p, to send by a tunnel of typ, as not sent with status for reason, and archives it.
+// reason may be nil.
+func (d *Dispatcher) skip(ctx context.Context, p *Poke, status, typ string, reason error) (Record, error) {
+	rec := Record{
+		MessageID: p.ID,
+		Status:    status,
+		TimeStamp: time.Now(),
+		Type:      typ,
+	}
+	if reason != nil {
+		rec.setMeta(MetaReason, reason.Error())
+	}
+	rec = withPokeMetadata(rec, p)
+	_, err := d.store.CompleteSend(ctx, p.ID, rec)
+	return rec, err
+}
@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTunnel is a Tunnel sending every poke with status and err.
+type fakeTunnel struct {
+	status string
+	err    error
+	sent   int
+}
+
+func (t *fakeTunnel) describe() string { return "fake" }
+func (t *fakeTunnel) Type() string     { return TypeSMS }
+func (t *fakeTunnel) ID() string       { return "fake" }
+
+func (t *fakeTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	t.sent++
+	return Record{MessageID: p.ID, Status: t.status, TimeStamp: time.Now()}, t.err
+}
+
+func TestDispatcherRecordWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		err         error
+		wantRecords int // records created before a flush
+		wantPending int
+	}{
+		{"delivered", StatusDelivered, nil, 1, 0},
+		{"undelivered", StatusUndelivered, errors.New("rejected"), 1, 0},
+		{"retried", StatusFailed, errors.New("unavailable"), 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newFakeStore(t)
+			ctx := context.Background()
+			w := NewBufferedRecordWriter(s, 100, time.Hour, nil)
+			defer w.Close(ctx)
+			d := NewDispatcher(s, NewRegistry(), WithRecordWriter(w), WithRetry(3, time.Minute))
+
+			tun := &fakeTunnel{status: tt.status, err: tt.err}
+			_, err := d.SendNow(ctx, tun, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("SendNow error = %v, want %v", err, tt.err)
+			}
+			if n := f.count("records"); n != tt.wantRecords {
+				t.Errorf("%d records before flush, want %d", n, tt.wantRecords)
+			}
+			if n := f.count("pokes"); n != tt.wantPending {
+				t.Errorf("%d pending pokes, want %d", n, tt.wantPending)
+			}
+			if err := w.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if n := f.count("records"); n != 1 {
+				t.Errorf("%d records after flush, want 1", n)
+			}
+		})
+	}
+}
+
+// countingStore is a PokeStore counting the writes of records and archives.
+type countingStore struct {
+	PokeStore
+	completed, archived, recorded int
+}
+
+func (s *countingStore) CompleteSend(ctx context.Context, id string, rec Record) (*ArchivedPoke, error) {
+	s.completed++
+	return s.PokeStore.CompleteSend(ctx, id, rec)
+}
+
+func (s *countingStore) Archive(ctx context.Context, id string) (*ArchivedPoke, error) {
+	s.archived++
+	return s.PokeStore.Archive(ctx, id)
+}
+
+func (s *countingStore) CreateRecord(ctx context.Context, rec Record) (Record, error) {
+	s.recorded++
+	return s.PokeStore.CreateRecord(ctx, rec)
+}
+
+func TestDispatcherCompleteSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []DispatcherOption
+		status     string
+		err        error
+		wantStatus string
+	}{
+		{"delivered", nil, StatusDelivered, nil, StatusDelivered},
+		{"undelivered", nil, StatusUndelivered, errors.New("rejected"), StatusUndelivered},
+		{"skipped", []DispatcherOption{WithTestMode()}, StatusDelivered, nil, StatusSkipped},
+		{"suppressed", []DispatcherOption{WithPreSendHook(func(context.Context, *Poke) error { return ErrSuppressed })}, StatusDelivered, nil, StatusSuppressed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, f := newFakeStore(t)
+			s := &countingStore{PokeStore: fs}
+			ctx := context.Background()
+			d := NewDispatcher(s, NewRegistry(), tt.opts...)
+
+			rec, err := d.SendNow(ctx, &fakeTunnel{status: tt.status, err: tt.err}, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("SendNow error = %v, want %v", err, tt.err)
+			}
+			if rec.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", rec.Status, tt.wantStatus)
+			}
+			if s.completed != 1 || s.archived != 0 || s.recorded != 0 {
+				t.Errorf("%d CompleteSend, %d Archive and %d CreateRecord, want 1 CompleteSend only", s.completed, s.archived, s.recorded)
+			}
+			if f.count("pokes") != 0 || f.count("archives") != 1 || f.count("records") != 1 {
+				t.Errorf("%d pokes, %d archives and %d records, want 0, 1 and 1", f.count("pokes"), f.count("archives"), f.count("records"))
+			}
+		})
+	}
+}
+
+// orderTunnel is a Tunnel recording the bodies it sends by recipient, in order,
+// and whether pokes to a recipient are ever sent at the same time.
+type orderTunnel struct {
+	mu      sync.Mutex
+	sent    map[string][]string
+	sending map[string]bool
+	overlap bool
+}
+
+func (t *orderTunnel) describe() string { return "order" }
+func (t *orderTunnel) Type() string     { return TypeSMS }
+func (t *orderTunnel) ID() string       { return "order" }
+
+func (t *orderTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	t.mu.Lock()
+	t.overlap = t.overlap || t.sending[p.To]
+	t.sending[p.To] = true
+	t.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	t.mu.Lock()
+	t.sending[p.To] = false
+	t.sent[p.To] = append(t.sent[p.To], p.Body)
+	t.mu.Unlock()
+	return Record{MessageID: p.ID, Status: StatusDelivered, TimeStamp: time.Now()}, nil
+}
+
+func TestDispatcherRecipientOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		recipients  int
+		pokes       int // a recipient
+	}{
+		{"one at a time", 1, 3, 4},
+		{"concurrent", 8, 3, 4},
+		{"concurrent one recipient", 8, 1, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			tun := &orderTunnel{sent: make(map[string][]string), sending: make(map[string]bool)}
+			reg := NewRegistry()
+			reg.Register(TypeSMS, tun)
+			d := NewDispatcher(s, reg, WithConcurrency(tt.concurrency))
+
+			base := time.Now().Add(-time.Hour)
+			want := make(map[string][]string)
+			// created latest due first, so the order sent is of due times, not of creation
+			for i := tt.pokes - 1; i >= 0; i-- {
+				for r := 0; r < tt.recipients; r++ {
+					to := fmt.Sprintf("+1555555010%d", r)
+					body := fmt.Sprintf("reminder %d", i)
+					if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: to, Body: body, DateToSend: base.Add(time.Duration(i) * time.Minute)}); err != nil {
+						t.Fatal(err)
+					}
+					want[to] = append([]string{body}, want[to]...)
+				}
+			}
+			if err := d.Run(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tun.sent, want) {
+				t.Errorf("sent %v, want %v", tun.sent, want)
+			}
+			if tun.overlap {
+				t.Error("pokes to a recipient sent at the same time")
+			}
+		})
+	}
+}
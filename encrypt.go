@@ -0,0 +1,552 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrKeyMismatch is returned when a poke is encrypted by a key an EncryptingStore does not have.
+var ErrKeyMismatch = errors.New("notify: poke encrypted by another key")
+
+// EncryptingStore is a PokeStore keeping subjects and bodies of pokes encrypted at rest.
+// Pokes are encrypted by Create and Update, and decrypted by reads, so tunnels see plaintext.
+// Archived pokes keep the KeyRef of their poke, and are decrypted by reads too.
+// Records keep bodies in metadata, MetaSanitized and MetaReplyBody; those are encrypted too,
+// and the key is named by MetaKeyRef.
+// Pokes and records written without encryption, having no key ref, are read as is.
+// Every method of PokeStore is implemented here, not embedded, so a read added to PokeStore
+// does not return ciphertext unnoticed.
+type EncryptingStore struct {
+	store  PokeStore
+	keyRef string
+	aead   cipher.AEAD
+}
+
+var _ PokeStore = (*EncryptingStore)(nil)
+
+// NewEncryptingStore returns an EncryptingStore over s, encrypting with AES-GCM key,
+// which must be 16, 24 or 32 bytes. keyRef names the key, e.g. a KMS key version,
+// and is stored in the KeyRef of pokes; the key itself is not.
+func NewEncryptingStore(s PokeStore, keyRef string, key []byte) (*EncryptingStore, error) {
+	if keyRef == "" {
+		return nil, errors.New("encrypting store needs a key ref")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptingStore{store: s, keyRef: keyRef, aead: aead}, nil
+}
+
+func (s *EncryptingStore) seal(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+func (s *EncryptingStore) open(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	bs, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	n := s.aead.NonceSize()
+	if len(bs) < n {
+		return "", errors.New("encrypted field too short")
+	}
+	plain, err := s.aead.Open(nil, bs[:n], bs[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// encrypt returns a copy of p with its content encrypted
+func (s *EncryptingStore) encrypt(p *Poke) (*Poke, error) {
+	e := *p
+	var err error
+	for _, f := range []*string{&e.Subject, &e.Body, &e.HTML} {
+		if *f, err = s.seal(*f); err != nil {
+			return nil, fmt.Errorf("encrypt poke %s: %w", p.ID, err)
+		}
+	}
+	e.KeyRef = s.keyRef
+	return &e, nil
+}
+
+// decrypt decrypts the content of p in place
+func (s *EncryptingStore) decrypt(p *Poke) error {
+	if p.KeyRef == "" {
+		return nil
+	}
+	if p.KeyRef != s.keyRef {
+		return fmt.Errorf("%w: poke %s by %s", ErrKeyMismatch, p.ID, p.KeyRef)
+	}
+	var err error
+	for _, f := range []*string{&p.Subject, &p.Body, &p.HTML} {
+		if *f, err = s.open(*f); err != nil {
+			return fmt.Errorf("decrypt poke %s: %w", p.ID, err)
+		}
+	}
+	p.KeyRef = ""
+	return nil
+}
+
+// decryptArchived decrypts the content of a in place
+func (s *EncryptingStore) decryptArchived(a *ArchivedPoke) error {
+	if a.KeyRef == "" {
+		return nil
+	}
+	if a.KeyRef != s.keyRef {
+		return fmt.Errorf("%w: archived poke %s by %s", ErrKeyMismatch, a.ID, a.KeyRef)
+	}
+	var err error
+	for _, f := range []*string{&a.Subject, &a.Body, &a.HTML} {
+		if *f, err = s.open(*f); err != nil {
+			return fmt.Errorf("decrypt archived poke %s: %w", a.ID, err)
+		}
+	}
+	a.KeyRef = ""
+	return nil
+}
+
+// contentMeta are the record metadata keys holding content of pokes, encrypted by EncryptingStore
+var contentMeta = []string{MetaSanitized, MetaReplyBody}
+
+// encryptRecord returns a copy of r with its content metadata encrypted.
+// Records without content metadata are returned as they are.
+func (s *EncryptingStore) encryptRecord(r Record) (Record, error) {
+	meta := make(map[string]string, len(r.Metadata)+1)
+	var content bool
+	for k, v := range r.Metadata {
+		meta[k] = v
+	}
+	for _, k := range contentMeta {
+		v, ok := meta[k]
+		if !ok {
+			continue
+		}
+		var err error
+		if meta[k], err = s.seal(v); err != nil {
+			return Record{}, fmt.Errorf("encrypt record of %s: %w", r.MessageID, err)
+		}
+		content = true
+	}
+	if !content {
+		return r, nil
+	}
+	meta[MetaKeyRef] = s.keyRef
+	r.Metadata = meta
+	return r, nil
+}
+
+// decryptMeta decrypts the content of record metadata meta, of message id, in place
+func (s *EncryptingStore) decryptMeta(id string, meta map[string]string) error {
+	ref, ok := meta[MetaKeyRef]
+	if !ok {
+		return nil
+	}
+	if ref != s.keyRef {
+		return fmt.Errorf("%w: record of %s by %s", ErrKeyMismatch, id, ref)
+	}
+	for _, k := range contentMeta {
+		v, ok := meta[k]
+		if !ok {
+			continue
+		}
+		var err error
+		if meta[k], err = s.open(v); err != nil {
+			return fmt.Errorf("decrypt record of %s: %w", id, err)
+		}
+	}
+	delete(meta, MetaKeyRef)
+	return nil
+}
+
+// decryptRecord decrypts the content metadata of r, and of its history, in place
+func (s *EncryptingStore) decryptRecord(r *Record) error {
+	if err := s.decryptMeta(r.MessageID, r.Metadata); err != nil {
+		return err
+	}
+	for _, e := range r.History {
+		if err := s.decryptMeta(r.MessageID, e.Metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *EncryptingStore) decryptRecords(recs []*Record, err error) ([]*Record, error) {
+	if err != nil {
+		return recs, err
+	}
+	for _, r := range recs {
+		if err := s.decryptRecord(r); err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+func (s *EncryptingStore) decryptRecordMap(recs map[string][]*Record, err error) (map[string][]*Record, error) {
+	if err != nil {
+		return recs, err
+	}
+	for _, rs := range recs {
+		if _, err := s.decryptRecords(rs, nil); err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+func (s *EncryptingStore) decryptArchive(a *ArchivedPoke, err error) (*ArchivedPoke, error) {
+	if err != nil || a == nil {
+		return a, err
+	}
+	if err := s.decryptArchived(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *EncryptingStore) decryptArchives(archived []*ArchivedPoke, err error) ([]*ArchivedPoke, error) {
+	for _, a := range archived {
+		if derr := s.decryptArchived(a); derr != nil {
+			return nil, derr
+		}
+	}
+	return archived, err
+}
+
+func (s *EncryptingStore) decryptAll(pokes []*Poke, err error) ([]*Poke, error) {
+	if err != nil {
+		return pokes, err
+	}
+	for _, p := range pokes {
+		if err := s.decrypt(p); err != nil {
+			return nil, err
+		}
+	}
+	return pokes, nil
+}
+
+// Create encrypts p and creates it. p is not changed, but its ID.
+func (s *EncryptingStore) Create(ctx context.Context, p *Poke) (*Poke, error) {
+	e, err := s.encrypt(p)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.store.Create(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = created.ID
+	return p, nil
+}
+
+// Update encrypts p and updates it. p is not changed.
+func (s *EncryptingStore) Update(ctx context.Context, p *Poke) (*Poke, error) {
+	e, err := s.encrypt(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Update(ctx, e); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Get gets and decrypts pokes
+func (s *EncryptingStore) Get(ctx context.Context, IDs ...string) ([]*Poke, error) {
+	return s.decryptAll(s.store.Get(ctx, IDs...))
+}
+
+// GetAt gets and decrypts pokes as they were at readTime.
+func (s *EncryptingStore) GetAt(ctx context.Context, readTime time.Time, IDs ...string) ([]*Poke, error) {
+	return s.decryptAll(s.store.GetAt(ctx, readTime, IDs...))
+}
+
+// ListToSend lists and decrypts pokes that can be sent
+func (s *EncryptingStore) ListToSend(ctx context.Context) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListToSend(ctx))
+}
+
+// ClaimToSend claims and decrypts pokes that can be sent
+func (s *EncryptingStore) ClaimToSend(ctx context.Context, workerID string, lease time.Duration, limit int) ([]*Poke, error) {
+	return s.decryptAll(s.store.ClaimToSend(ctx, workerID, lease, limit))
+}
+
+// ListExpired lists and decrypts expired pokes
+func (s *EncryptingStore) ListExpired(ctx context.Context) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListExpired(ctx))
+}
+
+// ListByMetadata lists and decrypts pokes by metadata
+func (s *EncryptingStore) ListByMetadata(ctx context.Context, key, value string, limit int) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListByMetadata(ctx, key, value, limit))
+}
+
+// ListByOwner lists and decrypts pokes of a user
+func (s *EncryptingStore) ListByOwner(ctx context.Context, uid string) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListByOwner(ctx, uid))
+}
+
+// ListScheduledBetween lists and decrypts pokes scheduled in a time window
+func (s *EncryptingStore) ListScheduledBetween(ctx context.Context, from, to time.Time, limit int) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListScheduledBetween(ctx, from, to, limit))
+}
+
+// ListSLABreaches lists and decrypts pokes past their SLA
+func (s *EncryptingStore) ListSLABreaches(ctx context.Context) ([]*Poke, error) {
+	return s.decryptAll(s.store.ListSLABreaches(ctx))
+}
+
+// ExportByRecipient exports pokes to recipient to, decrypted.
+// Content of pokes archived without their KeyRef, before archived pokes kept it, is exported as stored.
+func (s *EncryptingStore) ExportByRecipient(ctx context.Context, to string) (RecipientExport, error) {
+	exp, err := s.store.ExportByRecipient(ctx, to)
+	if err != nil {
+		return exp, err
+	}
+	if exp.Pending, err = s.decryptAll(exp.Pending, nil); err != nil {
+		return RecipientExport{}, err
+	}
+	if exp.Archived, err = s.decryptArchives(exp.Archived, nil); err != nil {
+		return RecipientExport{}, err
+	}
+	if exp.Records, err = s.decryptRecordMap(exp.Records, nil); err != nil {
+		return RecipientExport{}, err
+	}
+	return exp, nil
+}
+
+// StreamToSend streams and decrypts pokes that can be sent.
+// A poke failed to decrypt ends the stream with its error.
+func (s *EncryptingStore) StreamToSend(ctx context.Context) (<-chan *Poke, <-chan error) {
+	ctx, cancel := context.WithCancel(ctx)
+	in, inErrs := s.store.StreamToSend(ctx)
+	return s.decryptStream(ctx, cancel, in, inErrs)
+}
+
+// Watch watches and decrypts pokes as they become due.
+// A poke failed to decrypt ends the watch with its error.
+func (s *EncryptingStore) Watch(ctx context.Context) (<-chan *Poke, <-chan error) {
+	ctx, cancel := context.WithCancel(ctx)
+	in, inErrs := s.store.Watch(ctx)
+	return s.decryptStream(ctx, cancel, in, inErrs)
+}
+
+// Delete is a method of PokeStore interface
+func (s *EncryptingStore) Delete(ctx context.Context, IDs ...string) error {
+	return s.store.Delete(ctx, IDs...)
+}
+
+// DeleteBestEffort is a method of PokeStore interface
+func (s *EncryptingStore) DeleteBestEffort(ctx context.Context, IDs ...string) ([]string, map[string]error) {
+	return s.store.DeleteBestEffort(ctx, IDs...)
+}
+
+// Reschedule is a method of PokeStore interface
+func (s *EncryptingStore) Reschedule(ctx context.Context, id string, nextAttempt time.Time) error {
+	return s.store.Reschedule(ctx, id, nextAttempt)
+}
+
+// ListToSendSummary is a method of PokeStore interface. Summaries have no content.
+func (s *EncryptingStore) ListToSendSummary(ctx context.Context) ([]PokeSummary, error) {
+	return s.store.ListToSendSummary(ctx)
+}
+
+// CancelByRecipient is a method of PokeStore interface
+func (s *EncryptingStore) CancelByRecipient(ctx context.Context, to string) (int, error) {
+	return s.store.CancelByRecipient(ctx, to)
+}
+
+// CountPending is a method of PokeStore interface
+func (s *EncryptingStore) CountPending(ctx context.Context) (int, error) {
+	return s.store.CountPending(ctx)
+}
+
+// MigrateDueFields is a method of PokeStore interface
+func (s *EncryptingStore) MigrateDueFields(ctx context.Context) (int, error) {
+	return s.store.MigrateDueFields(ctx)
+}
+
+// CreateRecord encrypts the content metadata of r and creates it. It returns the record decrypted.
+func (s *EncryptingStore) CreateRecord(ctx context.Context, r Record) (Record, error) {
+	e, err := s.encryptRecord(r)
+	if err != nil {
+		return Record{}, err
+	}
+	created, err := s.store.CreateRecord(ctx, e)
+	if err != nil {
+		return created, err
+	}
+	if err := s.decryptRecord(&created); err != nil {
+		return Record{}, err
+	}
+	return created, nil
+}
+
+// CreateRecords encrypts the content metadata of recs and creates them, as CreateRecord does.
+func (s *EncryptingStore) CreateRecords(ctx context.Context, recs ...Record) ([]Record, error) {
+	enc := make([]Record, len(recs))
+	for i, r := range recs {
+		var err error
+		if enc[i], err = s.encryptRecord(r); err != nil {
+			return nil, err
+		}
+	}
+	created, err := s.store.CreateRecords(ctx, enc...)
+	for i := range created {
+		if derr := s.decryptRecord(&created[i]); derr != nil {
+			return nil, derr
+		}
+	}
+	return created, err
+}
+
+// GetRecord gets records, with their content metadata decrypted
+func (s *EncryptingStore) GetRecord(ctx context.Context, messageID string) ([]*Record, error) {
+	return s.decryptRecords(s.store.GetRecord(ctx, messageID))
+}
+
+// GetRecords gets records, with their content metadata decrypted
+func (s *EncryptingStore) GetRecords(ctx context.Context, messageIDs ...string) (map[string][]*Record, error) {
+	return s.decryptRecordMap(s.store.GetRecords(ctx, messageIDs...))
+}
+
+// GetRecordsByProviderID gets records, with their content metadata decrypted
+func (s *EncryptingStore) GetRecordsByProviderID(ctx context.Context, providerIDs ...string) (map[string][]*Record, error) {
+	return s.decryptRecordMap(s.store.GetRecordsByProviderID(ctx, providerIDs...))
+}
+
+// LatestRecord gets the latest record, with its content metadata decrypted
+func (s *EncryptingStore) LatestRecord(ctx context.Context, messageID string) (*Record, error) {
+	r, err := s.store.LatestRecord(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptRecord(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CompactRecords is a method of PokeStore interface
+func (s *EncryptingStore) CompactRecords(ctx context.Context, messageID string) error {
+	return s.store.CompactRecords(ctx, messageID)
+}
+
+// RecordStats is a method of PokeStore interface
+func (s *EncryptingStore) RecordStats(ctx context.Context, from, to time.Time) (map[string]map[string]int, error) {
+	return s.store.RecordStats(ctx, from, to)
+}
+
+// SumCost is a method of PokeStore interface
+func (s *EncryptingStore) SumCost(ctx context.Context, from, to time.Time, tenant string) (float64, error) {
+	return s.store.SumCost(ctx, from, to, tenant)
+}
+
+// UpdateCost is a method of PokeStore interface
+func (s *EncryptingStore) UpdateCost(ctx context.Context, messageID string, cost float64, currency string) error {
+	return s.store.UpdateCost(ctx, messageID, cost, currency)
+}
+
+// CampaignStatus is a method of PokeStore interface
+func (s *EncryptingStore) CampaignStatus(ctx context.Context, campaign string) (CampaignStats, error) {
+	return s.store.CampaignStatus(ctx, campaign)
+}
+
+// Archive archives a poke, and returns it decrypted
+func (s *EncryptingStore) Archive(ctx context.Context, id string) (*ArchivedPoke, error) {
+	return s.decryptArchive(s.store.Archive(ctx, id))
+}
+
+// DeadLetter dead letters a poke, and returns it decrypted
+func (s *EncryptingStore) DeadLetter(ctx context.Context, id, reason string) (*ArchivedPoke, error) {
+	return s.decryptArchive(s.store.DeadLetter(ctx, id, reason))
+}
+
+// CompleteSend records and archives a poke, and returns it decrypted.
+// The content metadata of rec is encrypted, as CreateRecord does.
+func (s *EncryptingStore) CompleteSend(ctx context.Context, id string, rec Record) (*ArchivedPoke, error) {
+	e, err := s.encryptRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptArchive(s.store.CompleteSend(ctx, id, e))
+}
+
+// ArchiveBatch archives pokes, and returns them decrypted, with errors of pokes failed to archive
+func (s *EncryptingStore) ArchiveBatch(ctx context.Context, IDs ...string) ([]*ArchivedPoke, error) {
+	return s.decryptArchives(s.store.ArchiveBatch(ctx, IDs...))
+}
+
+// ListArchivedBefore lists and decrypts pokes archived before a time
+func (s *EncryptingStore) ListArchivedBefore(ctx context.Context, before time.Time, limit int) ([]*ArchivedPoke, error) {
+	return s.decryptArchives(s.store.ListArchivedBefore(ctx, before, limit))
+}
+
+// ListDeadLettered lists and decrypts dead lettered pokes
+func (s *EncryptingStore) ListDeadLettered(ctx context.Context) ([]*ArchivedPoke, error) {
+	return s.decryptArchives(s.store.ListDeadLettered(ctx))
+}
+
+// ListByRecipient lists and decrypts pokes archived to a recipient
+func (s *EncryptingStore) ListByRecipient(ctx context.Context, to string, limit int) ([]*ArchivedPoke, error) {
+	return s.decryptArchives(s.store.ListByRecipient(ctx, to, limit))
+}
+
+// DeleteArchived is a method of PokeStore interface
+func (s *EncryptingStore) DeleteArchived(ctx context.Context, IDs ...string) error {
+	return s.store.DeleteArchived(ctx, IDs...)
+}
+
+// decryptStream decrypts pokes from in. After the first error, the inner stream is
+// stopped by cancel and drained.
+func (s *EncryptingStore) decryptStream(ctx context.Context, cancel context.CancelFunc, in <-chan *Poke, inErrs <-chan error) (<-chan *Poke, <-chan error) {
+	pokes := make(chan *Poke)
+	errs := make(chan error, 1)
+	go func() {
+		defer cancel()
+		defer close(errs)
+		defer close(pokes)
+		for p := range in {
+			if err := s.decrypt(p); err != nil {
+				errs <- err
+				// stop and drain, so the inner stream can end
+				cancel()
+				for range in {
+				}
+				return
+			}
+			select {
+			case pokes <- p:
+			case <-ctx.Done():
+			}
+		}
+		if err := <-inErrs; err != nil {
+			errs <- err
+		}
+	}()
+	return pokes, errs
+}
@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEncryptingStoreReads(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		read func(s PokeStore, id string) (string, error) // body of the poke read
+	}{
+		{"Get", func(s PokeStore, id string) (string, error) {
+			pokes, err := s.Get(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return pokes[0].Body, nil
+		}},
+		{"ListToSend", func(s PokeStore, id string) (string, error) {
+			pokes, err := s.ListToSend(ctx)
+			if err != nil || len(pokes) == 0 {
+				return "", err
+			}
+			return pokes[0].Body, nil
+		}},
+		{"ListByOwner", func(s PokeStore, id string) (string, error) {
+			pokes, err := s.ListByOwner(ctx, "u1")
+			if err != nil || len(pokes) == 0 {
+				return "", err
+			}
+			return pokes[0].Body, nil
+		}},
+		{"Archive", func(s PokeStore, id string) (string, error) {
+			a, err := s.Archive(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			return a.Body, nil
+		}},
+		{"ListByRecipient", func(s PokeStore, id string) (string, error) {
+			if _, err := s.Archive(ctx, id); err != nil {
+				return "", err
+			}
+			archived, err := s.ListByRecipient(ctx, "+15555550100", 10)
+			if err != nil || len(archived) == 0 {
+				return "", err
+			}
+			return archived[0].Body, nil
+		}},
+		{"ListArchivedBefore", func(s PokeStore, id string) (string, error) {
+			if _, err := s.Archive(ctx, id); err != nil {
+				return "", err
+			}
+			archived, err := s.ListArchivedBefore(ctx, time.Now().Add(time.Hour), 0)
+			if err != nil || len(archived) == 0 {
+				return "", err
+			}
+			return archived[0].Body, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _ := newFakeStore(t, WithArchiveRetainBody(true))
+			s, err := NewEncryptingStore(fs, "k1", make([]byte, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "secret", OwnerUID: "u1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := fs.Get(ctx, p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored[0].Body == "secret" {
+				t.Fatal("body stored in plaintext")
+			}
+
+			got, err := tt.read(s, p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "secret" {
+				t.Errorf("body read %q, want it decrypted", got)
+			}
+		})
+	}
+}
+
+func TestEncryptingStoreRecords(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		key    string
+		create func(s PokeStore, r Record) error
+		read   func(s PokeStore, id string) (*Record, error)
+	}{
+		{"CreateRecord", MetaSanitized, func(s PokeStore, r Record) error {
+			_, err := s.CreateRecord(ctx, r)
+			return err
+		}, func(s PokeStore, id string) (*Record, error) {
+			recs, err := s.GetRecord(ctx, id)
+			if err != nil || len(recs) == 0 {
+				return nil, err
+			}
+			return recs[0], nil
+		}},
+		{"CreateRecords", MetaReplyBody, func(s PokeStore, r Record) error {
+			_, err := s.CreateRecords(ctx, r)
+			return err
+		}, func(s PokeStore, id string) (*Record, error) {
+			recs, err := s.GetRecords(ctx, id)
+			if err != nil || len(recs[id]) == 0 {
+				return nil, err
+			}
+			return recs[id][0], nil
+		}},
+		{"CompleteSend", MetaSanitized, func(s PokeStore, r Record) error {
+			_, err := s.CompleteSend(ctx, r.MessageID, r)
+			return err
+		}, func(s PokeStore, id string) (*Record, error) {
+			return s.LatestRecord(ctx, id)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _ := newFakeStore(t)
+			s, err := NewEncryptingStore(fs, "k1", make([]byte, 32))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "secret"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := Record{MessageID: p.ID, Status: StatusDelivered, Type: TypeSMS, TimeStamp: time.Now()}
+			r.setMeta(tt.key, "secret")
+			if err := tt.create(s, r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Metadata[tt.key] != "secret" {
+				t.Error("record given changed")
+			}
+
+			stored, err := tt.read(fs, p.ID)
+			if err != nil || stored == nil {
+				t.Fatalf("stored record = %v, %v", stored, err)
+			}
+			if stored.Metadata[tt.key] == "secret" || stored.Metadata[MetaKeyRef] != "k1" {
+				t.Errorf("stored metadata %v, want %s encrypted by k1", stored.Metadata, tt.key)
+			}
+			got, err := tt.read(s, p.ID)
+			if err != nil || got == nil {
+				t.Fatalf("read record = %v, %v", got, err)
+			}
+			if got.Metadata[tt.key] != "secret" {
+				t.Errorf("read %s = %q, want it decrypted", tt.key, got.Metadata[tt.key])
+			}
+		})
+	}
+}
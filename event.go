@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Types of StoreEvent
+const (
+	PokeCreated     = "poke_created"
+	PokeUpdated     = "poke_updated"
+	PokeRescheduled = "poke_rescheduled"
+	PokeClaimed     = "poke_claimed"
+	PokeDeleted     = "poke_deleted"
+	PokeArchived    = "poke_archived"
+	ArchiveDeleted  = "archive_deleted"
+)
+
+// StoreEvent is a mutation of a PokeStore
+type StoreEvent struct {
+	Type      string    `firestore:"type" json:"type"`
+	ID        string    `firestore:"id" json:"id"` // ID of the poke
+	TimeStamp time.Time `firestore:"timestamp" json:"timestamp"`
+}
+
+// EventSink receives events of store mutations, e.g. to stream them to analytics.
+// Events are appended after mutations succeed, in the order they are made by a caller.
+// A failed append does not fail the mutation, which is done already: callers retrying it
+// would make it again, e.g. create a poke twice. Events are at most once.
+type EventSink interface {
+	Append(ctx context.Context, event StoreEvent) error
+}
+
+// NopEventSink is an EventSink dropping all events
+type NopEventSink struct{}
+
+// Append is a method of EventSink interface
+func (NopEventSink) Append(context.Context, StoreEvent) error { return nil }
+
+// FireEventSink is an EventSink appending events to a firestore collection
+type FireEventSink struct {
+	col *firestore.CollectionRef
+}
+
+// NewFireEventSink returns a FireEventSink appending to collection col
+func NewFireEventSink(c *firestore.Client, col string) *FireEventSink {
+	return &FireEventSink{col: c.Collection(col)}
+}
+
+// Append is a method of EventSink interface
+func (s *FireEventSink) Append(ctx context.Context, event StoreEvent) error {
+	_, err := s.col.NewDoc().Create(ctx, event)
+	return err
+}
+
+// emit appends events of typ for ids to the sink of s, after the mutation is committed.
+// Failures are logged.
+func (s *firePokeStore) emit(ctx context.Context, typ string, ids ...string) {
+	if s.sink == nil {
+		return
+	}
+	now := time.Now()
+	for _, id := range ids {
+		err := s.sink.Append(ctx, StoreEvent{Type: typ, ID: id, TimeStamp: now})
+		if err == nil {
+			continue
+		}
+		s.logger.LogAttrs(ctx, slog.LevelError, "store event failed",
+			slog.String("event", typ),
+			slog.String("poke_id", id),
+			slog.Any("error", err),
+		)
+	}
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingSink is an EventSink keeping the types of events appended, failing every append with err.
+type recordingSink struct {
+	types []string
+	err   error
+}
+
+func (s *recordingSink) Append(ctx context.Context, e StoreEvent) error {
+	s.types = append(s.types, e.Type)
+	return s.err
+}
+
+func TestEventSink(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"appended", nil},
+		{"sink failed", errors.New("unavailable")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{err: tt.err}
+			s, f := newFakeStore(t, WithEventSink(sink))
+			ctx := context.Background()
+
+			p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+			if err != nil {
+				t.Fatalf("Create error = %v", err)
+			}
+			p.Body = "hello"
+			if _, err := s.Update(ctx, p); err != nil {
+				t.Fatalf("Update error = %v", err)
+			}
+			if _, err := s.ClaimToSend(ctx, "w1", time.Minute, 0); err != nil {
+				t.Fatalf("ClaimToSend error = %v", err)
+			}
+			if err := s.Reschedule(ctx, p.ID, time.Now().Add(-time.Second)); err != nil {
+				t.Fatalf("Reschedule error = %v", err)
+			}
+			if _, err := s.Archive(ctx, p.ID); err != nil {
+				t.Fatalf("Archive error = %v", err)
+			}
+			if err := s.DeleteArchived(ctx, p.ID); err != nil {
+				t.Fatalf("DeleteArchived error = %v", err)
+			}
+
+			want := []string{PokeCreated, PokeUpdated, PokeClaimed, PokeRescheduled, PokeArchived, ArchiveDeleted}
+			if !reflect.DeepEqual(sink.types, want) {
+				t.Errorf("events %v, want %v", sink.types, want)
+			}
+			if n := f.count("pokes") + f.count("archives"); n != 0 {
+				t.Errorf("%d pokes left, want none", n)
+			}
+		})
+	}
+}
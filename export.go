@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// RecipientExport is all a store holds about a recipient, as returned by ExportByRecipient.
+// It is marshaled to JSON in a stable order, for data subject access requests.
+type RecipientExport struct {
+	To         string               `json:"to"`
+	ExportedAt time.Time            `json:"exported_at"`
+	Pending    []*Poke              `json:"pending"`  // pokes not sent yet, by date to send
+	Archived   []*ArchivedPoke      `json:"archived"` // pokes sent, expired or skipped, by archive time
+	Records    map[string][]*Record `json:"records"`  // records of the pokes by message ID, by timestamp
+}
+
+// ExportByRecipient returns pokes queued and archived to recipient to, and the records of them.
+// Records are found by message ID, that is the ID of their poke; records without a poke are not exported.
+// Phone numbers with a country code match however they are written, see recipientDocs.
+// All pokes of to are read at once, without a list limit.
+func (s *firePokeStore) ExportByRecipient(ctx context.Context, to string) (RecipientExport, error) {
+	exp := RecipientExport{To: to, ExportedAt: time.Now()}
+
+	docs, err := s.recipientDocs(ctx, s.pokeQuery(), to, 0)
+	if err == nil {
+		exp.Pending, err = s.pokesFromDocs(docs, "export_by_recipient")
+	}
+	if err == nil {
+		docs, err = s.recipientDocs(ctx, s.archiveQuery(), to, 0)
+	}
+	if err == nil {
+		exp.Archived, err = s.archivedFromDocs(docs, "export_by_recipient")
+	}
+	if err != nil {
+		return RecipientExport{}, firePokeStoreErr{
+			err,
+			"export_by_recipient",
+			to,
+		}
+	}
+
+	sort.Slice(exp.Pending, func(i, j int) bool {
+		a, b := exp.Pending[i], exp.Pending[j]
+		if !a.DateToSend.Equal(b.DateToSend) {
+			return a.DateToSend.Before(b.DateToSend)
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(exp.Archived, func(i, j int) bool {
+		a, b := exp.Archived[i], exp.Archived[j]
+		if !a.ArchivedAt.Equal(b.ArchivedAt) {
+			return a.ArchivedAt.Before(b.ArchivedAt)
+		}
+		return a.ID < b.ID
+	})
+
+	ids := make([]string, 0, len(exp.Pending)+len(exp.Archived))
+	for _, p := range exp.Pending {
+		ids = append(ids, p.ID)
+	}
+	for _, a := range exp.Archived {
+		ids = append(ids, a.ID)
+	}
+	// GetRecords errors are store errors of its own
+	if exp.Records, err = s.GetRecords(ctx, ids...); err != nil {
+		return RecipientExport{}, err
+	}
+	for _, recs := range exp.Records {
+		sort.SliceStable(recs, func(i, j int) bool {
+			if !recs[i].TimeStamp.Equal(recs[j].TimeStamp) {
+				return recs[i].TimeStamp.Before(recs[j].TimeStamp)
+			}
+			return recs[i].ID < recs[j].ID
+		})
+	}
+	return exp, nil
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExportByRecipient(t *testing.T) {
+	tests := []struct {
+		name         string
+		to           string
+		wantPending  int
+		wantArchived int
+	}{
+		{"same", "+15550100000", 1, 1},
+		{"written differently", "+1 (555) 010-0000", 1, 1},
+		{"other number", "+15550100001", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			for _, to := range []string{"+15550100000", "+1 555.010.0000"} {
+				if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: to, Body: "hi"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pokes, err := s.ListToSend(ctx)
+			if err != nil || len(pokes) != 2 {
+				t.Fatalf("ListToSend = %d pokes, %v", len(pokes), err)
+			}
+			if _, err := s.Archive(ctx, pokes[0].ID); err != nil {
+				t.Fatal(err)
+			}
+
+			exp, err := s.ExportByRecipient(ctx, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(exp.Pending) != tt.wantPending || len(exp.Archived) != tt.wantArchived {
+				t.Errorf("export = %d pending, %d archived, want %d and %d",
+					len(exp.Pending), len(exp.Archived), tt.wantPending, tt.wantArchived)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// FieldMap names the fields of poke documents the store queries,
+// for collections not written by this package. Empty names are the default ones.
+type FieldMap struct {
+	DateToSend string // default "date_to_send"
+	Expiry     string // default "expiry"
+
+	// DueAt is the field of the date to send, or the NotBefore if later, which pokes to send are
+	// queried and ordered by. Collections without such a field may name DateToSend here,
+	// then NotBefore is not waited for. Default "due_at".
+	DueAt string
+}
+
+// DefaultFieldMap is the FieldMap of pokes written by this package.
+var DefaultFieldMap = FieldMap{
+	DateToSend: "date_to_send",
+	Expiry:     "expiry",
+	DueAt:      "due_at",
+}
+
+// withDefaults returns m, with empty names set to the default ones.
+func (m FieldMap) withDefaults() FieldMap {
+	if m.DateToSend == "" {
+		m.DateToSend = DefaultFieldMap.DateToSend
+	}
+	if m.Expiry == "" {
+		m.Expiry = DefaultFieldMap.Expiry
+	}
+	if m.DueAt == "" {
+		m.DueAt = DefaultFieldMap.DueAt
+	}
+	return m
+}
+
+// renames returns the default field names mapped to other names in m.
+func (m FieldMap) renames() map[string]string {
+	r := make(map[string]string)
+	if m.DateToSend != DefaultFieldMap.DateToSend {
+		r[DefaultFieldMap.DateToSend] = m.DateToSend
+	}
+	if m.Expiry != DefaultFieldMap.Expiry {
+		r[DefaultFieldMap.Expiry] = m.Expiry
+	}
+	if m.DueAt != DefaultFieldMap.DueAt {
+		r[DefaultFieldMap.DueAt] = m.DueAt
+	}
+	return r
+}
+
+// decodePoke unmarshals d into p, reading mapped fields from their names.
+func (s *firePokeStore) decodePoke(d *firestore.DocumentSnapshot, p *Poke) error {
+	if err := d.DataTo(p); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{s.fields.DateToSend, &p.DateToSend},
+		{s.fields.Expiry, &p.Expiry},
+	} {
+		v, err := d.DataAt(f.name)
+		if err != nil {
+			continue
+		}
+		if t, ok := v.(time.Time); ok {
+			*f.dst = t
+		}
+	}
+	return nil
+}
+
+// pokeData returns the document data of p, with mapped fields under their names.
+func (s *firePokeStore) pokeData(p *Poke) interface{} {
+	m := p.toFirestore()
+	// queried by CancelByRecipient and ExportByRecipient, see recipientDocs
+	m["recipient"] = recipientKey(p.To)
+	if p.SLA > 0 {
+		m[slaDeadlineField] = slaDeadline(p, time.Now())
+	}
+	if s.fields.DueAt != s.fields.DateToSend {
+		m[DefaultFieldMap.DueAt] = p.dueAt()
+	}
+	for from, to := range s.fields.renames() {
+		if v, ok := m[from]; ok {
+			delete(m, from)
+			m[to] = v
+		}
+	}
+	return m
+}
+
+// toFirestore returns the document data of p. Fields are mapped one by one,
+// so a field added to Poke is not stored until it is added here;
+// the firestore tags of Poke are for reading, and must agree with the names here.
+// Empty fields tagged omitempty are left out, as firestore does.
+func (p *Poke) toFirestore() map[string]interface{} {
+	m := map[string]interface{}{
+		"tunnel":       p.Tunnel,
+		"to":           p.To,
+		"body":         p.Body,
+		"date_to_send": p.DateToSend,
+		"expiry":       p.Expiry,
+		// zero if unclaimed, so ClaimToSend can query unclaimed pokes
+		"claim_expires": p.ClaimExpires,
+	}
+	for k, v := range map[string]string{
+		"subject":      p.Subject,
+		"html":         p.HTML,
+		"callback_url": p.CallbackURL,
+		"in_reply_to":  p.InReplyTo,
+		"thread_id":    p.ThreadID,
+		"key_ref":      p.KeyRef,
+		"claimed_by":   p.ClaimedBy,
+		"tenant_id":    p.TenantID,
+		"campaign_id":  p.CampaignID,
+		"owner_uid":    p.OwnerUID,
+	} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	if len(p.MediaURL) > 0 {
+		m["media_url"] = p.MediaURL
+	}
+	if p.Event != nil {
+		m["event"] = p.Event
+	}
+	if p.Marketing {
+		m["marketing"] = true
+	}
+	if p.Test {
+		m["test"] = true
+	}
+	if !p.NotBefore.IsZero() {
+		m["not_before"] = p.NotBefore
+	}
+	if !p.NotAfter.IsZero() {
+		m["not_after"] = p.NotAfter
+	}
+	if p.SLA != 0 {
+		m["sla"] = p.SLA
+	}
+	if p.Attempts != 0 {
+		m["attempts"] = p.Attempts
+	}
+	if p.MaxAttempts != 0 {
+		m["max_attempts"] = p.MaxAttempts
+	}
+	if len(p.Metadata) > 0 {
+		m["metadata"] = p.Metadata
+	}
+	return m
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fill sets every exported field of the struct v points to, recursively, to a value other than zero.
+func fill(t *testing.T, v reflect.Value) {
+	t.Helper()
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(t, v.Elem())
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(t, v.Field(i))
+			}
+		}
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(t, v.Index(0))
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(t, k)
+		fill(t, e)
+		m.SetMapIndex(k, e)
+		v.Set(m)
+	default:
+		t.Fatalf("cannot fill a %s", v.Type())
+	}
+}
+
+// firestoreNames returns the firestore names of the fields of struct type typ, failing t on a field without one.
+func firestoreNames(t *testing.T, typ reflect.Type) []string {
+	t.Helper()
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("firestore")
+		name, _, _ := strings.Cut(tag, ",")
+		if !ok || name == "" {
+			t.Errorf("%s.%s has no firestore name", typ.Name(), f.Name)
+			continue
+		}
+		if name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestToFirestoreFields(t *testing.T) {
+	var p Poke
+	fill(t, reflect.ValueOf(&p).Elem())
+	want := firestoreNames(t, reflect.TypeOf(p))
+
+	var got []string
+	for k := range p.toFirestore() {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("toFirestore stores fields\n%v\nwant the firestore fields of Poke\n%v", got, want)
+	}
+}
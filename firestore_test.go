@@ -0,0 +1,646 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeFirestore is an in-memory firestore server, enough for the queries and writes of this package.
+// Transactions are not isolated; tests run one at a time.
+type fakeFirestore struct {
+	pb.UnimplementedFirestoreServer
+
+	mu    sync.Mutex
+	docs  map[string]*pb.Document // by full name
+	clock time.Time
+	txs   int
+	aggs  int           // aggregation queries run
+	hold  chan struct{} // if not nil, aggregation queries wait for it to close
+}
+
+// newFakeClient returns a firestore client of a new fakeFirestore, closed when t ends.
+func newFakeClient(t *testing.T) (*firestore.Client, *fakeFirestore) {
+	t.Helper()
+	f := &fakeFirestore{
+		docs:  make(map[string]*pb.Document),
+		clock: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterFirestoreServer(srv, f)
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := firestore.NewClient(context.Background(), "test", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		srv.Stop()
+	})
+	return c, f
+}
+
+// newFakeStore returns a firePokeStore of collections "pokes", "records" and "archives" of a fakeFirestore.
+func newFakeStore(t *testing.T, opts ...StoreOption) (*firePokeStore, *fakeFirestore) {
+	t.Helper()
+	c, f := newFakeClient(t)
+	s, err := NewFirePokeStore(c, "pokes", "records", "archives", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*firePokeStore), f
+}
+
+const fakeRoot = "projects/test/databases/(default)/documents"
+
+// count returns the number of documents of collection col.
+func (f *fakeFirestore) count(col string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for name := range f.docs {
+		if parentOf(name) == fakeRoot+"/"+col {
+			n++
+		}
+	}
+	return n
+}
+
+// now returns the next time of f, so update times differ.
+func (f *fakeFirestore) now() *timestamppb.Timestamp {
+	f.clock = f.clock.Add(time.Millisecond)
+	return timestamppb.New(f.clock)
+}
+
+func (f *fakeFirestore) BeginTransaction(ctx context.Context, req *pb.BeginTransactionRequest) (*pb.BeginTransactionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txs++
+	return &pb.BeginTransactionResponse{Transaction: []byte(fmt.Sprint(f.txs))}, nil
+}
+
+func (f *fakeFirestore) Rollback(ctx context.Context, req *pb.RollbackRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeFirestore) BatchGetDocuments(req *pb.BatchGetDocumentsRequest, stream pb.Firestore_BatchGetDocumentsServer) error {
+	f.mu.Lock()
+	var res []*pb.BatchGetDocumentsResponse
+	for _, name := range req.Documents {
+		r := &pb.BatchGetDocumentsResponse{ReadTime: timestamppb.New(f.clock)}
+		if d, ok := f.docs[name]; ok {
+			r.Result = &pb.BatchGetDocumentsResponse_Found{Found: proto.Clone(d).(*pb.Document)}
+		} else {
+			r.Result = &pb.BatchGetDocumentsResponse_Missing{Missing: name}
+		}
+		res = append(res, r)
+	}
+	f.mu.Unlock()
+	for _, r := range res {
+		if err := stream.Send(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs := make(map[string]*pb.Document, len(f.docs))
+	for k, v := range f.docs {
+		docs[k] = v
+	}
+	now := f.now()
+	res := &pb.CommitResponse{CommitTime: now}
+	for _, w := range req.Writes {
+		if err := applyWrite(docs, w, now); err != nil {
+			return nil, err
+		}
+		res.WriteResults = append(res.WriteResults, &pb.WriteResult{UpdateTime: now})
+	}
+	f.docs = docs
+	return res, nil
+}
+
+// applyWrite applies w to docs at now.
+func applyWrite(docs map[string]*pb.Document, w *pb.Write, now *timestamppb.Timestamp) error {
+	var name string
+	switch op := w.Operation.(type) {
+	case *pb.Write_Update:
+		name = op.Update.Name
+	case *pb.Write_Delete:
+		name = op.Delete
+	default:
+		return status.Errorf(codes.Unimplemented, "write %T", op)
+	}
+	old, exists := docs[name]
+	if pre := w.CurrentDocument; pre != nil {
+		if e, ok := pre.ConditionType.(*pb.Precondition_Exists); ok {
+			if e.Exists && !exists {
+				return status.Errorf(codes.NotFound, "no document to update: %s", name)
+			}
+			if !e.Exists && exists {
+				return status.Errorf(codes.AlreadyExists, "document already exists: %s", name)
+			}
+		}
+		if u, ok := pre.ConditionType.(*pb.Precondition_UpdateTime); ok && (!exists || !proto.Equal(old.UpdateTime, u.UpdateTime)) {
+			return status.Errorf(codes.FailedPrecondition, "document updated since: %s", name)
+		}
+	}
+	if _, ok := w.Operation.(*pb.Write_Delete); ok {
+		delete(docs, name)
+		return nil
+	}
+
+	upd := w.GetUpdate()
+	d := &pb.Document{Name: name, Fields: map[string]*pb.Value{}, CreateTime: now, UpdateTime: now}
+	if exists {
+		d.CreateTime = old.CreateTime
+	}
+	if w.UpdateMask == nil {
+		for k, v := range upd.Fields {
+			d.Fields[k] = v
+		}
+	} else {
+		if exists {
+			d.Fields = proto.Clone(&pb.MapValue{Fields: old.Fields}).(*pb.MapValue).Fields
+			if d.Fields == nil {
+				d.Fields = map[string]*pb.Value{}
+			}
+		}
+		for _, p := range w.UpdateMask.FieldPaths {
+			path := splitFieldPath(p)
+			if v, ok := getPath(upd.Fields, path); ok {
+				setPath(d.Fields, path, v)
+			} else {
+				deletePath(d.Fields, path)
+			}
+		}
+	}
+	for _, t := range w.UpdateTransforms {
+		path := splitFieldPath(t.FieldPath)
+		cur, _ := getPath(d.Fields, path)
+		switch tt := t.TransformType.(type) {
+		case *pb.DocumentTransform_FieldTransform_SetToServerValue:
+			setPath(d.Fields, path, &pb.Value{ValueType: &pb.Value_TimestampValue{TimestampValue: now}})
+		case *pb.DocumentTransform_FieldTransform_Increment:
+			setPath(d.Fields, path, addValues(cur, tt.Increment))
+		default:
+			return status.Errorf(codes.Unimplemented, "transform %T", tt)
+		}
+	}
+	docs[name] = d
+	return nil
+}
+
+// addValues adds numbers a and b; a missing or not a number is zero.
+func addValues(a, b *pb.Value) *pb.Value {
+	ai, aInt := a.GetValueType().(*pb.Value_IntegerValue)
+	bi, bInt := b.GetValueType().(*pb.Value_IntegerValue)
+	if (aInt || !isNumber(a)) && bInt {
+		var n int64
+		if aInt {
+			n = ai.IntegerValue
+		}
+		return &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: n + bi.IntegerValue}}
+	}
+	x, _ := number(a)
+	y, _ := number(b)
+	return &pb.Value{ValueType: &pb.Value_DoubleValue{DoubleValue: x + y}}
+}
+
+func isNumber(v *pb.Value) bool {
+	_, ok := number(v)
+	return ok
+}
+
+func number(v *pb.Value) (float64, bool) {
+	switch x := v.GetValueType().(type) {
+	case *pb.Value_IntegerValue:
+		return float64(x.IntegerValue), true
+	case *pb.Value_DoubleValue:
+		return x.DoubleValue, true
+	}
+	return 0, false
+}
+
+// splitFieldPath splits a field path like "metadata.`a.b`" into its names.
+func splitFieldPath(p string) []string {
+	var names []string
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == '`':
+			quoted = !quoted
+		case c == '\\' && quoted && i+1 < len(p):
+			i++
+			b.WriteByte(p[i])
+		case c == '.' && !quoted:
+			names = append(names, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(names, b.String())
+}
+
+func getPath(fields map[string]*pb.Value, path []string) (*pb.Value, bool) {
+	v, ok := fields[path[0]]
+	if !ok {
+		return nil, false
+	}
+	if len(path) == 1 {
+		return v, true
+	}
+	m := v.GetMapValue()
+	if m == nil {
+		return nil, false
+	}
+	return getPath(m.Fields, path[1:])
+}
+
+func setPath(fields map[string]*pb.Value, path []string, v *pb.Value) {
+	if len(path) == 1 {
+		fields[path[0]] = v
+		return
+	}
+	m := fields[path[0]].GetMapValue()
+	if m == nil {
+		m = &pb.MapValue{}
+		fields[path[0]] = &pb.Value{ValueType: &pb.Value_MapValue{MapValue: m}}
+	}
+	if m.Fields == nil {
+		m.Fields = map[string]*pb.Value{}
+	}
+	setPath(m.Fields, path[1:], v)
+}
+
+func deletePath(fields map[string]*pb.Value, path []string) {
+	if len(path) == 1 {
+		delete(fields, path[0])
+		return
+	}
+	if m := fields[path[0]].GetMapValue(); m != nil {
+		deletePath(m.Fields, path[1:])
+	}
+}
+
+// parentOf returns the collection of document name.
+func parentOf(name string) string {
+	return name[:strings.LastIndex(name, "/")]
+}
+
+// query returns documents matching q under parent, in order.
+func (f *fakeFirestore) query(parent string, q *pb.StructuredQuery) ([]*pb.Document, error) {
+	if q.StartAt != nil || q.EndAt != nil {
+		return nil, status.Error(codes.Unimplemented, "cursors")
+	}
+	var out []*pb.Document
+	for name, d := range f.docs {
+		if !inFrom(parent, name, q.From) {
+			continue
+		}
+		ok, err := matches(d, q.Where)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		has := true
+		for _, o := range q.OrderBy {
+			if _, ok := fieldOf(d, o.Field.FieldPath); !ok {
+				has = false
+			}
+		}
+		if has {
+			out = append(out, d)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		for _, o := range q.OrderBy {
+			a, _ := fieldOf(out[i], o.Field.FieldPath)
+			b, _ := fieldOf(out[j], o.Field.FieldPath)
+			c := compareValues(a, b)
+			if o.Direction == pb.StructuredQuery_DESCENDING {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return out[i].Name < out[j].Name
+	})
+	if q.Offset > 0 {
+		if int(q.Offset) >= len(out) {
+			out = nil
+		} else {
+			out = out[q.Offset:]
+		}
+	}
+	if q.Limit != nil && int(q.Limit.Value) < len(out) {
+		out = out[:q.Limit.Value]
+	}
+	res := make([]*pb.Document, len(out))
+	for i, d := range out {
+		d = proto.Clone(d).(*pb.Document)
+		if q.Select != nil {
+			fields := map[string]*pb.Value{}
+			for _, p := range q.Select.Fields {
+				if p.FieldPath == "__name__" {
+					continue
+				}
+				if v, ok := getPath(d.Fields, splitFieldPath(p.FieldPath)); ok {
+					setPath(fields, splitFieldPath(p.FieldPath), v)
+				}
+			}
+			d.Fields = fields
+		}
+		res[i] = d
+	}
+	return res, nil
+}
+
+func inFrom(parent, name string, from []*pb.StructuredQuery_CollectionSelector) bool {
+	col := parentOf(name)
+	for _, sel := range from {
+		if sel.AllDescendants {
+			if strings.HasPrefix(name, parent+"/") && col[strings.LastIndex(col, "/")+1:] == sel.CollectionId {
+				return true
+			}
+			continue
+		}
+		if col == parent+"/"+sel.CollectionId {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldOf returns the field of d at path, or its name for "__name__".
+func fieldOf(d *pb.Document, path string) (*pb.Value, bool) {
+	if path == "__name__" {
+		return &pb.Value{ValueType: &pb.Value_ReferenceValue{ReferenceValue: d.Name}}, true
+	}
+	return getPath(d.Fields, splitFieldPath(path))
+}
+
+func matches(d *pb.Document, f *pb.StructuredQuery_Filter) (bool, error) {
+	if f == nil {
+		return true, nil
+	}
+	switch ft := f.FilterType.(type) {
+	case *pb.StructuredQuery_Filter_CompositeFilter:
+		and := ft.CompositeFilter.Op != pb.StructuredQuery_CompositeFilter_OR
+		for _, sub := range ft.CompositeFilter.Filters {
+			ok, err := matches(d, sub)
+			if err != nil {
+				return false, err
+			}
+			if and && !ok {
+				return false, nil
+			}
+			if !and && ok {
+				return true, nil
+			}
+		}
+		return and, nil
+	case *pb.StructuredQuery_Filter_FieldFilter:
+		return matchField(d, ft.FieldFilter)
+	case *pb.StructuredQuery_Filter_UnaryFilter:
+		v, ok := fieldOf(d, ft.UnaryFilter.GetField().FieldPath)
+		_, null := v.GetValueType().(*pb.Value_NullValue)
+		switch ft.UnaryFilter.Op {
+		case pb.StructuredQuery_UnaryFilter_IS_NULL:
+			return ok && null, nil
+		case pb.StructuredQuery_UnaryFilter_IS_NOT_NULL:
+			return ok && !null, nil
+		case pb.StructuredQuery_UnaryFilter_IS_NAN:
+			n, isNum := number(v)
+			return ok && isNum && math.IsNaN(n), nil
+		}
+	}
+	return false, status.Errorf(codes.Unimplemented, "filter %T", f.FilterType)
+}
+
+func matchField(d *pb.Document, ff *pb.StructuredQuery_FieldFilter) (bool, error) {
+	v, ok := fieldOf(d, ff.Field.FieldPath)
+	if !ok {
+		return false, nil
+	}
+	want := ff.Value
+	switch ff.Op {
+	case pb.StructuredQuery_FieldFilter_EQUAL:
+		return compareValues(v, want) == 0, nil
+	case pb.StructuredQuery_FieldFilter_NOT_EQUAL:
+		_, null := v.GetValueType().(*pb.Value_NullValue)
+		return !null && compareValues(v, want) != 0, nil
+	case pb.StructuredQuery_FieldFilter_IN, pb.StructuredQuery_FieldFilter_NOT_IN:
+		in := false
+		for _, w := range want.GetArrayValue().GetValues() {
+			if compareValues(v, w) == 0 {
+				in = true
+			}
+		}
+		return in == (ff.Op == pb.StructuredQuery_FieldFilter_IN), nil
+	case pb.StructuredQuery_FieldFilter_ARRAY_CONTAINS:
+		for _, e := range v.GetArrayValue().GetValues() {
+			if compareValues(e, want) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	// range filters match values of the same type only
+	if typeOrder(v) != typeOrder(want) {
+		return false, nil
+	}
+	c := compareValues(v, want)
+	switch ff.Op {
+	case pb.StructuredQuery_FieldFilter_LESS_THAN:
+		return c < 0, nil
+	case pb.StructuredQuery_FieldFilter_LESS_THAN_OR_EQUAL:
+		return c <= 0, nil
+	case pb.StructuredQuery_FieldFilter_GREATER_THAN:
+		return c > 0, nil
+	case pb.StructuredQuery_FieldFilter_GREATER_THAN_OR_EQUAL:
+		return c >= 0, nil
+	}
+	return false, status.Errorf(codes.Unimplemented, "operator %v", ff.Op)
+}
+
+// typeOrder returns the order of the type of v among types, as firestore orders them.
+func typeOrder(v *pb.Value) int {
+	switch v.GetValueType().(type) {
+	case *pb.Value_NullValue:
+		return 0
+	case *pb.Value_BooleanValue:
+		return 1
+	case *pb.Value_IntegerValue, *pb.Value_DoubleValue:
+		return 2
+	case *pb.Value_TimestampValue:
+		return 3
+	case *pb.Value_StringValue:
+		return 4
+	case *pb.Value_BytesValue:
+		return 5
+	case *pb.Value_ReferenceValue:
+		return 6
+	case *pb.Value_GeoPointValue:
+		return 7
+	case *pb.Value_ArrayValue:
+		return 8
+	}
+	return 9
+}
+
+// compareValues compares a and b as firestore orders values.
+func compareValues(a, b *pb.Value) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return cmpInt(int64(ta), int64(tb))
+	}
+	switch x := a.GetValueType().(type) {
+	case *pb.Value_BooleanValue:
+		y := b.GetBooleanValue()
+		switch {
+		case x.BooleanValue == y:
+			return 0
+		case !x.BooleanValue:
+			return -1
+		}
+		return 1
+	case *pb.Value_IntegerValue, *pb.Value_DoubleValue:
+		m, _ := number(a)
+		n, _ := number(b)
+		switch {
+		case m < n:
+			return -1
+		case m > n:
+			return 1
+		}
+		return 0
+	case *pb.Value_TimestampValue:
+		y := b.GetTimestampValue()
+		if c := cmpInt(x.TimestampValue.Seconds, y.Seconds); c != 0 {
+			return c
+		}
+		return cmpInt(int64(x.TimestampValue.Nanos), int64(y.Nanos))
+	case *pb.Value_StringValue:
+		return strings.Compare(x.StringValue, b.GetStringValue())
+	case *pb.Value_BytesValue:
+		return strings.Compare(string(x.BytesValue), string(b.GetBytesValue()))
+	case *pb.Value_ReferenceValue:
+		return strings.Compare(x.ReferenceValue, b.GetReferenceValue())
+	case *pb.Value_ArrayValue:
+		av, bv := x.ArrayValue.GetValues(), b.GetArrayValue().GetValues()
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compareValues(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(int64(len(av)), int64(len(bv)))
+	case *pb.Value_MapValue:
+		if proto.Equal(a, b) {
+			return 0
+		}
+		return strings.Compare(a.String(), b.String())
+	}
+	return 0
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (f *fakeFirestore) RunQuery(req *pb.RunQueryRequest, stream pb.Firestore_RunQueryServer) error {
+	f.mu.Lock()
+	docs, err := f.query(req.Parent, req.GetStructuredQuery())
+	readTime := timestamppb.New(f.clock)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return stream.Send(&pb.RunQueryResponse{ReadTime: readTime})
+	}
+	for _, d := range docs {
+		if err := stream.Send(&pb.RunQueryResponse{Document: d, ReadTime: readTime}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) RunAggregationQuery(req *pb.RunAggregationQueryRequest, stream pb.Firestore_RunAggregationQueryServer) error {
+	agg := req.GetStructuredAggregationQuery()
+	f.mu.Lock()
+	f.aggs++
+	hold := f.hold
+	f.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	f.mu.Lock()
+	docs, err := f.query(req.Parent, agg.GetStructuredQuery())
+	readTime := timestamppb.New(f.clock)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	fields := map[string]*pb.Value{}
+	for _, a := range agg.Aggregations {
+		switch op := a.Operator.(type) {
+		case *pb.StructuredAggregationQuery_Aggregation_Count_:
+			fields[a.Alias] = &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: int64(len(docs))}}
+		case *pb.StructuredAggregationQuery_Aggregation_Sum_:
+			sum := &pb.Value{ValueType: &pb.Value_IntegerValue{}}
+			for _, d := range docs {
+				if v, ok := fieldOf(d, op.Sum.Field.FieldPath); ok && isNumber(v) {
+					sum = addValues(sum, v)
+				}
+			}
+			fields[a.Alias] = sum
+		default:
+			return status.Errorf(codes.Unimplemented, "aggregation %T", op)
+		}
+	}
+	return stream.Send(&pb.RunAggregationQueryResponse{
+		Result:   &pb.AggregationResult{AggregateFields: fields},
+		ReadTime: readTime,
+	})
+}
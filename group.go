@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// NewFireCollectionGroupStore returns a PokeStore over all poke collections named pokeCol,
+// e.g. per-tenant subcollections "tenants/{tenant}/pokes", for one dispatcher of all tenants.
+//
+// IDs of pokes are their document paths, e.g. "tenants/acme/pokes/123", so Create needs
+// the path of the new poke in its ID. Pokes are archived into the collection named arcCol
+// next to their poke collection, e.g. "tenants/acme/archived/123", and get the same ID
+// when archived. Records of all tenants are kept in recCol, by poke ID.
+func NewFireCollectionGroupStore(c *firestore.Client, pokeCol, recCol, arcCol string, opts ...StoreOption) (PokeStore, error) {
+	if c == nil {
+		return nil, firePokeStoreErr{
+			fmt.Errorf("not created"),
+			"newfirecollectiongroupstore",
+			"initialize",
+		}
+	}
+	if strings.Contains(pokeCol, "/") || strings.Contains(arcCol, "/") {
+		return nil, firePokeStoreErr{
+			fmt.Errorf("collection group %q and archive %q must be collection IDs", pokeCol, arcCol),
+			"newfirecollectiongroupstore",
+			"initialize",
+		}
+	}
+	s := &firePokeStore{
+		c:          c,
+		group:      pokeCol,
+		pokeCol:    c.Collection(pokeCol),
+		recCol:     c.Collection(recCol),
+		archiveCol: c.Collection(arcCol),
+		logger:     slog.Default(),
+		listLimit:  defaultListLimit,
+		fields:     DefaultFieldMap,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.tracer != nil {
+		return &tracedStore{s: s, tracer: s.tracer}, nil
+	}
+	return s, nil
+}
+
+// pokeQuery returns the query of all pokes
+func (s *firePokeStore) pokeQuery() firestore.Query {
+	if s.group != "" {
+		return s.c.CollectionGroup(s.group).Query
+	}
+	return s.pokeCol.Query
+}
+
+// archiveQuery returns the query of all archived pokes
+func (s *firePokeStore) archiveQuery() firestore.Query {
+	if s.group != "" {
+		return s.c.CollectionGroup(s.archiveCol.ID).Query
+	}
+	return s.archiveCol.Query
+}
+
+// pokeRef returns the document of poke id. It is nil if id is not a valid document path.
+func (s *firePokeStore) pokeRef(id string) *firestore.DocumentRef {
+	if s.group != "" {
+		return s.c.Doc(id)
+	}
+	return s.pokeCol.Doc(id)
+}
+
+// newPokeRef returns the document of a new poke, with an ID generated if id is empty.
+// Collection groups need id to be the path of the new poke.
+func (s *firePokeStore) newPokeRef(id string) *firestore.DocumentRef {
+	if s.group != "" {
+		return s.c.Doc(id)
+	}
+	return s.newDoc(s.pokeCol, id)
+}
+
+// archiveRef returns the document of archived poke id
+func (s *firePokeStore) archiveRef(id string) *firestore.DocumentRef {
+	if s.group == "" {
+		return s.archiveCol.Doc(id)
+	}
+	ref := s.c.Doc(id)
+	if ref == nil {
+		return nil
+	}
+	if tenant := ref.Parent.Parent; tenant != nil {
+		return tenant.Collection(s.archiveCol.ID).Doc(ref.ID)
+	}
+	return s.c.Collection(s.archiveCol.ID).Doc(ref.ID)
+}
+
+// idOf returns the ID of the poke of ref
+func (s *firePokeStore) idOf(ref *firestore.DocumentRef) string {
+	if s.group == "" {
+		return ref.ID
+	}
+	if i := strings.Index(ref.Path, "/documents/"); i >= 0 {
+		return ref.Path[i+len("/documents/"):]
+	}
+	return ref.Path
+}
+
+// archivedIDOf returns the ID of the archived poke of ref, which is the ID of the poke.
+func (s *firePokeStore) archivedIDOf(ref *firestore.DocumentRef) string {
+	if s.group == "" {
+		return ref.ID
+	}
+	if tenant := ref.Parent.Parent; tenant != nil {
+		return s.idOf(tenant.Collection(s.group).Doc(ref.ID))
+	}
+	return s.group + "/" + ref.ID
+}
@@ -0,0 +1,171 @@
+package notify
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative notifypb/notify.proto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/markxp/notify/notifypb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer is a notifypb.NotifyServiceServer backed by a PokeStore
+type grpcServer struct {
+	notifypb.UnimplementedNotifyServiceServer
+	store PokeStore
+}
+
+// NewGRPCServer returns a NotifyService server of store.
+// Register it with notifypb.RegisterNotifyServiceServer.
+func NewGRPCServer(store PokeStore) notifypb.NotifyServiceServer {
+	return &grpcServer{store: store}
+}
+
+// CreatePoke is a method of notifypb.NotifyServiceServer
+func (s *grpcServer) CreatePoke(ctx context.Context, req *notifypb.CreatePokeRequest) (*notifypb.Poke, error) {
+	if req.GetPoke() == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing poke")
+	}
+	p, err := pokeFromProto(req.GetPoke())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the store gives the ID
+	p.ID = ""
+	if err := p.Validate(); err != nil {
+		return nil, grpcError(err)
+	}
+	p, err = s.store.Create(ctx, p)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pokeToProto(p)
+}
+
+// GetPoke is a method of notifypb.NotifyServiceServer
+func (s *grpcServer) GetPoke(ctx context.Context, req *notifypb.GetPokeRequest) (*notifypb.Poke, error) {
+	pokes, err := s.store.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return pokeToProto(pokes[0])
+}
+
+// CancelPoke is a method of notifypb.NotifyServiceServer.
+// A poke not queuing, e.g. sent or cancelled already, is not found, as by the HTTP handler.
+func (s *grpcServer) CancelPoke(ctx context.Context, req *notifypb.CancelPokeRequest) (*emptypb.Empty, error) {
+	if _, err := s.store.Get(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := s.store.Delete(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ListRecords is a method of notifypb.NotifyServiceServer
+func (s *grpcServer) ListRecords(ctx context.Context, req *notifypb.ListRecordsRequest) (*notifypb.ListRecordsResponse, error) {
+	recs, err := s.store.GetRecord(ctx, req.GetMessageId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &notifypb.ListRecordsResponse{
+		Records: make([]*notifypb.Record, 0, len(recs)),
+	}
+	for _, r := range recs {
+		ts, err := timestampProto(r.TimeStamp)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		resp.Records = append(resp.Records, &notifypb.Record{
+			MessageId: r.MessageID,
+			Id:        r.ID,
+			Status:    r.Status,
+			Timestamp: ts,
+			Metadata:  r.Metadata,
+		})
+	}
+	return resp, nil
+}
+
+// grpcError maps errors of the package to grpc status errors
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidPoke):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func pokeToProto(p *Poke) (*notifypb.Poke, error) {
+	dateToSend, err := timestampProto(p.DateToSend)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	expiry, err := timestampProto(p.Expiry)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &notifypb.Poke{
+		Id:          p.ID,
+		Tunnel:      p.Tunnel,
+		To:          p.To,
+		Subject:     p.Subject,
+		Body:        p.Body,
+		Html:        p.HTML,
+		DateToSend:  dateToSend,
+		Expiry:      expiry,
+		CallbackUrl: p.CallbackURL,
+		Metadata:    p.Metadata,
+	}, nil
+}
+
+func pokeFromProto(pb *notifypb.Poke) (*Poke, error) {
+	dateToSend, err := timestampFromProto(pb.GetDateToSend())
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := timestampFromProto(pb.GetExpiry())
+	if err != nil {
+		return nil, err
+	}
+	return &Poke{
+		ID:          pb.GetId(),
+		Tunnel:      pb.GetTunnel(),
+		To:          pb.GetTo(),
+		Subject:     pb.GetSubject(),
+		Body:        pb.GetBody(),
+		HTML:        pb.GetHtml(),
+		DateToSend:  dateToSend,
+		Expiry:      expiry,
+		CallbackURL: pb.GetCallbackUrl(),
+		Metadata:    pb.GetMetadata(),
+	}, nil
+}
+
+// timestampProto converts t. A zero t is a nil timestamp.
+func timestampProto(t time.Time) (*timestamppb.Timestamp, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	ts := timestamppb.New(t)
+	return ts, ts.CheckValid()
+}
+
+// timestampFromProto converts ts. A nil ts is a zero time.
+func timestampFromProto(ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, err
+	}
+	return ts.AsTime(), nil
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/markxp/notify/notifypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient returns a client of a NotifyService server of store, stopped when t ends.
+func newGRPCClient(t *testing.T, store PokeStore) notifypb.NotifyServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	notifypb.RegisterNotifyServiceServer(srv, NewGRPCServer(store))
+	go srv.Serve(lis)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	return notifypb.NewNotifyServiceClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c notifypb.NotifyServiceClient, id string) error // id of a queuing poke
+		code codes.Code
+	}{
+		{"get", func(c notifypb.NotifyServiceClient, id string) error {
+			p, err := c.GetPoke(context.Background(), &notifypb.GetPokeRequest{Id: id})
+			if err == nil && p.GetBody() != "hi" {
+				t.Errorf("body = %q, want hi", p.GetBody())
+			}
+			return err
+		}, codes.OK},
+		{"get missing", func(c notifypb.NotifyServiceClient, id string) error {
+			_, err := c.GetPoke(context.Background(), &notifypb.GetPokeRequest{Id: "missing"})
+			return err
+		}, codes.NotFound},
+		{"cancel", func(c notifypb.NotifyServiceClient, id string) error {
+			if _, err := c.CancelPoke(context.Background(), &notifypb.CancelPokeRequest{Id: id}); err != nil {
+				return err
+			}
+			_, err := c.GetPoke(context.Background(), &notifypb.GetPokeRequest{Id: id})
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("get cancelled poke error = %v, want NotFound", err)
+			}
+			return nil
+		}, codes.OK},
+		{"cancel missing", func(c notifypb.NotifyServiceClient, id string) error {
+			_, err := c.CancelPoke(context.Background(), &notifypb.CancelPokeRequest{Id: "missing"})
+			return err
+		}, codes.NotFound},
+		{"cancel twice", func(c notifypb.NotifyServiceClient, id string) error {
+			if _, err := c.CancelPoke(context.Background(), &notifypb.CancelPokeRequest{Id: id}); err != nil {
+				return err
+			}
+			_, err := c.CancelPoke(context.Background(), &notifypb.CancelPokeRequest{Id: id})
+			return err
+		}, codes.NotFound},
+		{"create without poke", func(c notifypb.NotifyServiceClient, id string) error {
+			_, err := c.CreatePoke(context.Background(), &notifypb.CreatePokeRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"create invalid", func(c notifypb.NotifyServiceClient, id string) error {
+			_, err := c.CreatePoke(context.Background(), &notifypb.CreatePokeRequest{Poke: &notifypb.Poke{Tunnel: TypeSMS, Body: "hi"}})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			c := newGRPCClient(t, s)
+			p, err := c.CreatePoke(context.Background(), &notifypb.CreatePokeRequest{
+				Poke: &notifypb.Poke{Id: "given", Tunnel: TypeSMS, To: "+15555550100", Body: "hi"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.GetId() == "" || p.GetId() == "given" {
+				t.Fatalf("created poke ID = %q, want one given by the store", p.GetId())
+			}
+			if err := tt.call(c, p.GetId()); status.Code(err) != tt.code {
+				t.Errorf("error = %v, want code %s", err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Handler returns an http.Handler serving a REST API of store:
+//
+//	POST   /pokes              creates a poke from a JSON body
+//	GET    /pokes/{id}         returns a poke
+//	DELETE /pokes/{id}         cancels a poke
+//	GET    /pokes/{id}/records returns records of a poke
+func Handler(store PokeStore) http.Handler {
+	h := &apiHandler{store: store}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pokes", h.pokes)
+	mux.HandleFunc("/pokes/", h.poke)
+	return mux
+}
+
+type apiHandler struct {
+	store PokeStore
+}
+
+// pokes serves /pokes
+func (h *apiHandler) pokes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := new(Poke)
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the store gives the ID
+	p.ID = ""
+	if err := p.Validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	p, err := h.store.Create(r.Context(), p)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// poke serves /pokes/{id} and /pokes/{id}/records
+func (h *apiHandler) poke(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/pokes/"), "/")
+	id := parts[0]
+	if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "records") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		recs, err := h.store.GetRecord(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, recs)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		pokes, err := h.store.Get(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, pokes[0])
+	case http.MethodDelete:
+		// firestore deletes missing documents without error; a missing poke is not found
+		if _, err := h.store.Get(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := h.store.Delete(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// httpStatus maps errors of the package to http status codes
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidPoke):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), httpStatus(err))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
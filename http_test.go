@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		code   int
+	}{
+		{"queued", true, http.StatusNoContent},
+		{"missing", false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newFakeStore(t)
+			id := "missing"
+			if tt.exists {
+				p, err := s.Create(context.Background(), &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				id = p.ID
+			}
+			rec := httptest.NewRecorder()
+			Handler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/pokes/"+id, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if n := f.count("pokes"); n != 0 {
+				t.Errorf("%d pokes left, want none", n)
+			}
+		})
+	}
+}
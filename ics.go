@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CalendarEvent is an event sent as an ICS invite with email pokes.
+type CalendarEvent struct {
+	UID         string    `firestore:"uid,omitempty" json:"uid,omitempty"` // defaults to the poke ID
+	Start       time.Time `firestore:"start" json:"start"`
+	End         time.Time `firestore:"end" json:"end"`
+	Summary     string    `firestore:"summary" json:"summary"`
+	Location    string    `firestore:"location,omitempty" json:"location,omitempty"`
+	Description string    `firestore:"description,omitempty" json:"description,omitempty"`
+}
+
+// Validate checks e has what an invite needs.
+func (e *CalendarEvent) Validate() error {
+	switch {
+	case e.Summary == "":
+		return errors.New("calendar event: missing summary")
+	case e.Start.IsZero():
+		return errors.New("calendar event: missing start")
+	case e.End.IsZero():
+		return errors.New("calendar event: missing end")
+	case !e.End.After(e.Start):
+		return errors.New("calendar event: end is not after start")
+	}
+	return nil
+}
+
+// icsTime is the UTC date-time format of ICS
+const icsTime = "20060102T150405Z"
+
+// icsEscape escapes a TEXT value of ICS
+var icsEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// ics returns a METHOD:REQUEST calendar of e, organized by organizer and attended by attendee.
+func (e *CalendarEvent) ics(uid, organizer, attendee string) []byte {
+	if e.UID != "" {
+		uid = e.UID
+	}
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//markxp//notify//EN",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		"UID:" + icsEscape.Replace(uid),
+		"DTSTAMP:" + time.Now().UTC().Format(icsTime),
+		"DTSTART:" + e.Start.UTC().Format(icsTime),
+		"DTEND:" + e.End.UTC().Format(icsTime),
+		"SUMMARY:" + icsEscape.Replace(e.Summary),
+	}
+	if e.Location != "" {
+		lines = append(lines, "LOCATION:"+icsEscape.Replace(e.Location))
+	}
+	if e.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+icsEscape.Replace(e.Description))
+	}
+	lines = append(lines,
+		fmt.Sprintf("ORGANIZER:mailto:%s", organizer),
+		fmt.Sprintf("ATTENDEE;RSVP=TRUE:mailto:%s", attendee),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	)
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(icsFold(l))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// icsFold folds a content line longer than 75 octets, without splitting a character.
+func icsFold(l string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range l {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// IDGenerator generates document IDs
+type IDGenerator interface {
+	Generate() string
+}
+
+// crockford is the Crockford's base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator is an IDGenerator of ULIDs, which sort by creation time.
+type ULIDGenerator struct{}
+
+// Generate is a method of IDGenerator interface
+func (ULIDGenerator) Generate() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	// 48 bits of time, then 80 bits of randomness
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+
+	// 128 bits in 26 characters, 5 bits each, with 2 padding bits in front
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
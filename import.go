@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportError is an error of a row of an import.
+type ImportError struct {
+	Line int // line of the row in the imported file, from 1
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the error of the row
+func (e *ImportError) Unwrap() error { return e.Err }
+
+// importTimeLayouts are layouts of times in imported files. Times without a zone are UTC.
+var importTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseImportTime parses v by importTimeLayouts. An empty v is the zero time.
+func parseImportTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	for _, l := range importTimeLayouts {
+		if t, err := time.Parse(l, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+// csvColumns set fields of a poke from columns of ImportCSV.
+var csvColumns = map[string]func(p *Poke, v string) error{
+	"tunnel":       func(p *Poke, v string) error { p.Tunnel = v; return nil },
+	"to":           func(p *Poke, v string) error { p.To = v; return nil },
+	"subject":      func(p *Poke, v string) error { p.Subject = v; return nil },
+	"body":         func(p *Poke, v string) error { p.Body = v; return nil },
+	"html":         func(p *Poke, v string) error { p.HTML = v; return nil },
+	"callback_url": func(p *Poke, v string) error { p.CallbackURL = v; return nil },
+	"campaign_id":  func(p *Poke, v string) error { p.CampaignID = v; return nil },
+	"owner_uid":    func(p *Poke, v string) error { p.OwnerUID = v; return nil },
+	"date_to_send": func(p *Poke, v string) (err error) { p.DateToSend, err = parseImportTime(v); return },
+	"expiry":       func(p *Poke, v string) (err error) { p.Expiry, err = parseImportTime(v); return },
+}
+
+// ImportCSV creates a poke of every row of a CSV file r, with a header row naming the columns.
+// Columns are the snake case names of Poke fields: to, subject, body, html, date_to_send, expiry,
+// tunnel, callback_url, campaign_id and owner_uid; columns named "metadata.<key>" set a metadata label.
+// Pokes without a tunnel are sent by tunnel, and without a date to send are sent at once.
+// Times are RFC 3339, or "2006-01-02 15:04:05" in UTC.
+//
+// Rows failed to parse, validate or create are skipped and reported as *ImportError.
+// An unreadable file, or an unknown column, stops the import.
+func ImportCSV(ctx context.Context, store PokeStore, r io.Reader, tunnel string) (created int, errs []error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return 0, []error{&ImportError{1, err}}
+	}
+	sets := make([]func(p *Poke, v string) error, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if key := strings.TrimPrefix(h, "metadata."); key != h && key != "" {
+			sets[i] = func(p *Poke, v string) error {
+				if v == "" {
+					return nil
+				}
+				if p.Metadata == nil {
+					p.Metadata = make(map[string]string)
+				}
+				p.Metadata[key] = v
+				return nil
+			}
+			continue
+		}
+		set, ok := csvColumns[h]
+		if !ok {
+			return 0, []error{&ImportError{1, fmt.Errorf("unknown column %q", header[i])}}
+		}
+		sets[i] = set
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return created, append(errs, err)
+			}
+			if errors.Is(perr.Err, csv.ErrFieldCount) {
+				errs = append(errs, &ImportError{perr.StartLine, err})
+				continue
+			}
+			// the row can not be told from the next any more
+			return created, append(errs, &ImportError{perr.Line, err})
+		}
+		line, _ := cr.FieldPos(0)
+
+		p := &Poke{Tunnel: tunnel}
+		for i, v := range row {
+			if err = sets[i](p, strings.TrimSpace(v)); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = importPoke(ctx, store, p)
+		}
+		if err != nil {
+			errs = append(errs, &ImportError{line, err})
+			continue
+		}
+		created++
+	}
+	return created, errs
+}
+
+// ImportJSON creates a poke of every element of a JSON array r of pokes, as encoded by Poke.
+// Pokes without a tunnel are sent by tunnel. IDs of pokes are ignored; the store gives them.
+//
+// Elements failed to decode, validate or create are skipped and reported as *ImportError,
+// with the line the element ends at. Malformed JSON stops the import.
+func ImportJSON(ctx context.Context, store PokeStore, r io.Reader, tunnel string) (created int, errs []error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, []error{err}
+	}
+	lineAt := func(off int64) int {
+		return bytes.Count(data[:off], []byte("\n")) + 1
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return 0, []error{&ImportError{lineAt(dec.InputOffset()), errors.New("not a JSON array")}}
+	}
+	for dec.More() {
+		p := new(Poke)
+		err := dec.Decode(p)
+		line := lineAt(dec.InputOffset())
+		var terr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &terr):
+			// the element is consumed, the next can be decoded
+			errs = append(errs, &ImportError{line, err})
+			continue
+		case err != nil:
+			return created, append(errs, &ImportError{line, err})
+		}
+
+		p.ID = ""
+		if p.Tunnel == "" {
+			p.Tunnel = tunnel
+		}
+		if err := importPoke(ctx, store, p); err != nil {
+			errs = append(errs, &ImportError{line, err})
+			continue
+		}
+		created++
+	}
+	return created, errs
+}
+
+// importPoke validates and creates p.
+func importPoke(ctx context.Context, store PokeStore, p *Poke) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	_, err := store.Create(ctx, p)
+	return err
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+// inboundLookback is how many of the latest pokes to a number are looked at to find the one replied to
+const inboundLookback = 10
+
+// emptyTwiML is a TwiML response of no reply
+const emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+// InboundSMSHandler records inbound SMS posted by twilio as replies to the pokes they answer.
+// A reply from a number answers the poke most recently sent to it, and is recorded as a StatusReplied
+// Record of that poke, with the reply body in MetaReplyBody. Pokes archived without being sent,
+// e.g. suppressed, skipped or cancelled, are not answered; see sentStatus.
+// Replies from numbers no poke was sent to are not recorded. Twilio may post a message more than once;
+// a reply is recorded once. It responds an empty TwiML, so twilio does not answer the reply.
+//
+// Messages are checked to be signed by c, with baseURL, e.g. "https://example.com",
+// prepended to the request url. If c is nil, signatures are NOT checked: anyone can post forged
+// replies to any number. Pass nil in tests only; a warning is logged when such a handler is made.
+func InboundSMSHandler(store PokeStore, c *twilio.Twilio, baseURL string) http.HandlerFunc {
+	if c == nil {
+		slog.Warn("twilio inbound messages are not checked to be signed by twilio")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if c != nil {
+			ok, err := c.CheckRequestSignature(r, baseURL)
+			if err != nil || !ok {
+				http.Error(w, "invalid twilio signature", http.StatusForbidden)
+				return
+			}
+		}
+		from := r.PostFormValue("From")
+		sid := r.PostFormValue("MessageSid")
+		if from == "" || sid == "" {
+			http.Error(w, "missing from or message sid", http.StatusBadRequest)
+			return
+		}
+
+		orig, err := repliedPoke(r.Context(), store, from)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "find poke replied to failed", slog.String("message_sid", sid), slog.Any("error", err))
+			http.Error(w, "could not record reply", http.StatusInternalServerError)
+			return
+		}
+		if orig != nil {
+			rec := Record{
+				MessageID:  orig.ID,
+				Status:     StatusReplied,
+				TimeStamp:  time.Now(),
+				Type:       TypeSMS,
+				TenantID:   orig.TenantID,
+				CampaignID: orig.CampaignID,
+				OwnerUID:   orig.OwnerUID,
+			}
+			// not MetaProviderID: the sid is of the reply, not of the message of the poke
+			rec.setMeta(MetaEventID, "inbound/"+sid)
+			rec.setMeta(MetaReplyBody, r.PostFormValue("Body"))
+			if _, err := store.CreateRecord(r.Context(), rec); err != nil {
+				slog.ErrorContext(r.Context(), "record reply failed", slog.String("poke_id", orig.ID), slog.Any("error", err))
+				http.Error(w, "could not record reply", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(emptyTwiML))
+	}
+}
+
+// repliedPoke returns the latest poke sent to from, or nil if there is none.
+// from, given by twilio in E.164, matches pokes to the number however written, see ListByRecipient.
+func repliedPoke(ctx context.Context, store PokeStore, from string) (*ArchivedPoke, error) {
+	archived, err := store.ListByRecipient(ctx, from, inboundLookback)
+	if err != nil || len(archived) == 0 {
+		return nil, err
+	}
+	ids := make([]string, len(archived))
+	for i, a := range archived {
+		ids[i] = a.ID
+	}
+	recs, err := store.GetRecords(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	// expired and dead lettered pokes never reached the recipient
+	for _, a := range archived {
+		if a.Expired || a.DeadLettered {
+			continue
+		}
+		for _, rec := range recs[a.ID] {
+			if rec.Type != "" && sentStatus(rec.Status) {
+				return a, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// sentStatus reports whether a record of a tunnel with status tells its poke reached the provider
+// to be delivered: not suppressed, skipped, expired, failed or undelivered, and not a reply.
+// Statuses passed on from the provider, like twilio "sent", are sent.
+func sentStatus(status string) bool {
+	switch status {
+	case StatusSuppressed, StatusSkipped, StatusExpired, StatusError, StatusFailed, StatusUndelivered,
+		StatusReplied, StatusSLABreached:
+		return false
+	}
+	return true
+}
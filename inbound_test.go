@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+func TestInboundSMSHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		pokes  []string // statuses of the send records of pokes to the number, oldest first; "" for none
+		client *twilio.Twilio
+		want   int // index in pokes of the poke replied to, -1 for none
+		code   int
+	}{
+		{name: "sent", pokes: []string{StatusQueued}, want: 0, code: http.StatusOK},
+		{name: "no poke", want: -1, code: http.StatusOK},
+		{name: "latest sent", pokes: []string{StatusQueued, StatusDelivered}, want: 1, code: http.StatusOK},
+		{name: "latest suppressed", pokes: []string{StatusQueued, StatusSuppressed}, want: 0, code: http.StatusOK},
+		{name: "latest skipped", pokes: []string{"sent", StatusSkipped}, want: 0, code: http.StatusOK},
+		{name: "latest cancelled", pokes: []string{StatusQueued, ""}, want: 0, code: http.StatusOK},
+		{name: "none sent", pokes: []string{StatusError, StatusUndelivered}, want: -1, code: http.StatusOK},
+		{name: "unsigned", pokes: []string{StatusQueued}, client: twilio.NewTwilioClient("AC1", "token"), want: -1, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			var ids []string
+			for _, st := range tt.pokes {
+				// pokes store the number as given; twilio posts it in E.164
+				p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+1 (555) 555-0100", Body: "hi"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, p.ID)
+				if st == "" {
+					_, err = s.Archive(ctx, p.ID)
+				} else {
+					_, err = s.CompleteSend(ctx, p.ID, Record{Status: st, Type: TypeSMS, TimeStamp: time.Now()})
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			form := url.Values{"From": {"+15555550100"}, "MessageSid": {"SM1"}, "Body": {"yes"}}
+			req := httptest.NewRequest(http.MethodPost, "/inbound", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			InboundSMSHandler(s, tt.client, "https://example.com").ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+
+			for i, id := range ids {
+				recs, err := s.GetRecord(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var replied bool
+				for _, r := range recs {
+					replied = replied || r.Status == StatusReplied && r.Metadata[MetaReplyBody] == "yes"
+				}
+				if replied != (i == tt.want) {
+					t.Errorf("poke %d replied = %v, want %v", i, replied, i == tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// PubSubIngester creates Pokes from Pub/Sub messages.
+// A message is a JSON encoded Poke.
+type PubSubIngester struct {
+	sub        *pubsub.Subscription
+	store      PokeStore
+	deadLetter *pubsub.Topic
+}
+
+// NewPubSubIngester returns a PubSubIngester receiving from sub.
+// Malformed messages are published to deadLetter and acked. With a nil deadLetter they are dropped.
+func NewPubSubIngester(sub *pubsub.Subscription, store PokeStore, deadLetter *pubsub.Topic) *PubSubIngester {
+	return &PubSubIngester{
+		sub:        sub,
+		store:      store,
+		deadLetter: deadLetter,
+	}
+}
+
+// Run receives messages until ctx is done. It is usually run in its own goroutine.
+func (i *PubSubIngester) Run(ctx context.Context) error {
+	return i.sub.Receive(ctx, i.handle)
+}
+
+// handle creates a poke from m. It acks when the poke is created,
+// and nacks on store errors so the message is redelivered.
+func (i *PubSubIngester) handle(ctx context.Context, m *pubsub.Message) {
+	p := new(Poke)
+	if err := json.Unmarshal(m.Data, p); err != nil {
+		i.reject(ctx, m, err)
+		return
+	}
+	if err := p.Validate(); err != nil {
+		i.reject(ctx, m, err)
+		return
+	}
+	// the store gives the ID
+	p.ID = ""
+
+	if _, err := i.store.Create(ctx, p); err != nil {
+		m.Nack()
+		return
+	}
+	m.Ack()
+}
+
+// reject dead-letters a malformed message, so it is not redelivered.
+func (i *PubSubIngester) reject(ctx context.Context, m *pubsub.Message, reason error) {
+	if i.deadLetter == nil {
+		m.Ack()
+		return
+	}
+	res := i.deadLetter.Publish(ctx, &pubsub.Message{
+		Data: m.Data,
+		Attributes: map[string]string{
+			"message_id": m.ID,
+			"error":      reason.Error(),
+		},
+	})
+	if _, err := res.Get(ctx); err != nil {
+		m.Nack()
+		return
+	}
+	m.Ack()
+}
@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+
+	"github.com/jordan-wright/email"
+)
+
+// InlineImage is an image embedded in HTML emails, referenced by src="cid:<CID>".
+type InlineImage struct {
+	CID         string // content ID, e.g. "logo"
+	ContentType string // e.g. "image/png"
+	Data        []byte
+}
+
+// cidRe is the format of content IDs of inline images. It keeps them safe in headers.
+var cidRe = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// cidRefRe matches references to content IDs in HTML, like src="cid:logo", src=cid:logo or url(cid:logo)
+var cidRefRe = regexp.MustCompile(`(?i)(?:["'(]|=\s*)cid:([^"')\s>]+)`)
+
+// embedImages returns the images the HTML of msg references by cid, to embed by messageBytes.
+// A reference to an image not in images is an ErrInvalidPoke, as it would render broken.
+// Images are embedded once, however often they are referenced, and only if referenced.
+func embedImages(msg *email.Email, images map[string]InlineImage) ([]InlineImage, error) {
+	if len(msg.HTML) == 0 {
+		return nil, nil
+	}
+	var inline []InlineImage
+	seen := make(map[string]bool)
+	for _, m := range cidRefRe.FindAllSubmatch(msg.HTML, -1) {
+		cid := string(m[1])
+		if seen[cid] {
+			continue
+		}
+		seen[cid] = true
+		img, ok := images[cid]
+		if !ok || !cidRe.MatchString(cid) {
+			return nil, fmt.Errorf("%w: html references unknown image cid:%s", ErrInvalidPoke, cid)
+		}
+		inline = append(inline, img)
+	}
+	return inline, nil
+}
+
+// messageBytes returns msg in RFC 5322 format, with inline images embedded by the HTML
+// in a multipart/related part, see RFC 2387:
+//
+//	multipart/mixed, if msg has attachments
+//	  multipart/alternative, if msg has text
+//	    text/plain
+//	    multipart/related
+//	      text/html
+//	      images
+//	  attachments
+//
+// jordan-wright/email, at the version in go.mod, writes no multipart/related, so only the headers
+// of msg are written by it. Without inline images, msg is written by it as is.
+func messageBytes(msg *email.Email, inline []InlineImage) ([]byte, error) {
+	if len(inline) == 0 || len(msg.HTML) == 0 {
+		return msg.Bytes()
+	}
+	head := *msg
+	head.Text, head.HTML, head.Attachments = nil, nil, nil
+	raw, err := head.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	contentType, err := writeRelated(&body, msg, inline)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Attachments) > 0 {
+		var mixed bytes.Buffer
+		w := multipart.NewWriter(&mixed)
+		part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+		if err == nil {
+			_, err = body.WriteTo(part)
+		}
+		for _, a := range msg.Attachments {
+			if err != nil {
+				break
+			}
+			if part, err = w.CreatePart(a.Header); err == nil {
+				err = writeBase64(part, a.Content)
+			}
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = mixed, "multipart/mixed; boundary="+w.Boundary()
+	}
+
+	var buf bytes.Buffer
+	m.Header["Content-Type"] = []string{contentType}
+	delete(m.Header, "Content-Transfer-Encoding")
+	keys := make([]string, 0, len(m.Header))
+	for k := range m.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range m.Header[k] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	body.WriteTo(&buf)
+	return buf.Bytes(), nil
+}
+
+// writeRelated writes to w the text and the HTML of msg with inline images, and returns its content type.
+func writeRelated(w io.Writer, msg *email.Email, inline []InlineImage) (string, error) {
+	var related bytes.Buffer
+	rw := multipart.NewWriter(&related)
+	err := writeText(rw, "text/html", msg.HTML)
+	for _, img := range inline {
+		if err != nil {
+			break
+		}
+		var part io.Writer
+		part, err = rw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {img.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Id":                {"<" + img.CID + ">"},
+			"Content-Disposition":       {fmt.Sprintf("inline; filename=%q", img.CID)},
+		})
+		if err == nil {
+			err = writeBase64(part, img.Data)
+		}
+	}
+	if err == nil {
+		err = rw.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	relatedType := `multipart/related; type="text/html"; boundary=` + rw.Boundary()
+	if len(msg.Text) == 0 {
+		_, err := related.WriteTo(w)
+		return relatedType, err
+	}
+
+	aw := multipart.NewWriter(w)
+	if err := writeText(aw, "text/plain", msg.Text); err != nil {
+		return "", err
+	}
+	part, err := aw.CreatePart(textproto.MIMEHeader{"Content-Type": {relatedType}})
+	if err != nil {
+		return "", err
+	}
+	if _, err := related.WriteTo(part); err != nil {
+		return "", err
+	}
+	return "multipart/alternative; boundary=" + aw.Boundary(), aw.Close()
+}
+
+// writeText writes text of media type typ, quoted-printable, as a part of w.
+func writeText(w *multipart.Writer, typ string, text []byte) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {typ + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(text); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes b to w in base64, in lines of 76 characters as RFC 2045 requires.
+func writeBase64(w io.Writer, b []byte) error {
+	s := base64.StdEncoding.EncodeToString(b)
+	for len(s) > 76 {
+		if _, err := io.WriteString(w, s[:76]+"\r\n"); err != nil {
+			return err
+		}
+		s = s[76:]
+	}
+	_, err := io.WriteString(w, s+"\r\n")
+	return err
+}
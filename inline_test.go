@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mimeTree returns the media types of the parts of a message with header h and body r, nested in brackets,
+// e.g. "multipart/alternative[text/plain multipart/related[text/html image/png]]".
+func mimeTree(t *testing.T, h map[string][]string, r io.Reader) string {
+	t.Helper()
+	typ, params, err := mime.ParseMediaType(mail.Header(h).Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(typ, "multipart/") {
+		return typ
+	}
+	mr := multipart.NewReader(r, params["boundary"])
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimeTree(t, p.Header, p))
+	}
+	return typ + "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestInlineImages(t *testing.T) {
+	logo := InlineImage{CID: "logo", ContentType: "image/png", Data: []byte("png")}
+	event := &CalendarEvent{Summary: "call", Start: time.Now(), End: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name    string
+		html    string
+		event   *CalendarEvent
+		want    string
+		wantErr error
+	}{
+		{"quoted", `<img src="cid:logo">`, nil, "multipart/alternative[text/plain multipart/related[text/html image/png]]", nil},
+		{"unquoted", `<img src=cid:logo>`, nil, "multipart/alternative[text/plain multipart/related[text/html image/png]]", nil},
+		{"css", `<div style="background:url(cid:logo)"></div><img src='cid:logo'>`, nil, "multipart/alternative[text/plain multipart/related[text/html image/png]]", nil},
+		{"with invite", `<img src="cid:logo">`, event, "multipart/mixed[multipart/alternative[text/plain multipart/related[text/html image/png]] text/calendar]", nil},
+		{"not referenced", `<p>hi</p>`, nil, "multipart/alternative[text/plain text/html]", nil},
+		{"unknown", `<img src=cid:banner>`, nil, "", ErrInvalidPoke},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tun := GMailTunnel{email: "from@example.com", opts: tunnelOptions{images: map[string]InlineImage{"logo": logo}}}
+			msg, inline, err := tun.compose(&Poke{ID: "p1", To: "to@example.com", Subject: "hi", Body: "hi", HTML: tt.html, Event: tt.event})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("compose error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			raw, err := messageBytes(msg, inline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Header.Get("Subject"); got != "hi" {
+				t.Errorf("Subject = %q, want hi", got)
+			}
+			if got := mimeTree(t, m.Header, m.Body); got != tt.want {
+				t.Errorf("message is\n%s\nwant\n%s", got, tt.want)
+			}
+			if len(inline) > 0 && !bytes.Contains(raw, []byte("Content-Id: <logo>")) {
+				t.Errorf("image has no content id:\n%s", raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Shortener replaces a url in the body of a poke with a short one.
+type Shortener interface {
+	Shorten(ctx context.Context, p *Poke, long string) (string, error)
+}
+
+// TrackedLink is a short link of a url sent in a poke.
+type TrackedLink struct {
+	Code       string    `firestore:"-" json:"code"`
+	URL        string    `firestore:"url" json:"url"`
+	MessageID  string    `firestore:"message_id" json:"message_id"`
+	CampaignID string    `firestore:"campaign_id,omitempty" json:"campaign_id,omitempty"`
+	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// LinkClick is a click of a TrackedLink.
+type LinkClick struct {
+	Code       string    `firestore:"code" json:"code"`
+	URL        string    `firestore:"url" json:"url"`
+	MessageID  string    `firestore:"message_id" json:"message_id"`
+	CampaignID string    `firestore:"campaign_id,omitempty" json:"campaign_id,omitempty"`
+	TimeStamp  time.Time `firestore:"timestamp" json:"timestamp"`
+	UserAgent  string    `firestore:"user_agent,omitempty" json:"user_agent,omitempty"`
+}
+
+// linkCodeLen is the length of codes of short links, 40 bits of crockford base32
+const linkCodeLen = 8
+
+// LinkTracker is a Shortener keeping short links and their clicks in firestore collections.
+// Short links are served by ClickHandler.
+// It should be initialized by NewLinkTracker.
+type LinkTracker struct {
+	links   *firestore.CollectionRef
+	clicks  *firestore.CollectionRef
+	baseURL string
+}
+
+// NewLinkTracker returns a LinkTracker keeping links in collection linkCol and clicks in clickCol.
+// Short links are baseURL, e.g. "https://ex.co/l", followed by "/" and the code of the link.
+func NewLinkTracker(c *firestore.Client, linkCol, clickCol, baseURL string) *LinkTracker {
+	return &LinkTracker{
+		links:   c.Collection(linkCol),
+		clicks:  c.Collection(clickCol),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Shorten is a method of Shortener interface. It keeps long as a TrackedLink of p.
+func (l *LinkTracker) Shorten(ctx context.Context, p *Poke, long string) (string, error) {
+	link := TrackedLink{
+		URL:        long,
+		MessageID:  p.ID,
+		CampaignID: p.CampaignID,
+		CreatedAt:  time.Now(),
+	}
+	var err error
+	// codes are random; retry the rare collision
+	for i := 0; i < 3; i++ {
+		code := linkCode()
+		_, err = l.links.Doc(code).Create(ctx, link)
+		if err == nil {
+			return l.baseURL + "/" + code, nil
+		}
+		if status.Code(err) != codes.AlreadyExists {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// linkCode returns a random code of a short link.
+func linkCode() string {
+	var b [linkCodeLen]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = crockford[b[i]&0x1f]
+	}
+	return string(b[:])
+}
+
+// Resolve returns the link of code, or ErrNotFound.
+func (l *LinkTracker) Resolve(ctx context.Context, code string) (*TrackedLink, error) {
+	doc, err := l.links.Doc(code).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	link := new(TrackedLink)
+	if err := doc.DataTo(link); err != nil {
+		return nil, err
+	}
+	link.Code = doc.Ref.ID
+	return link, nil
+}
+
+// Links returns the links sent in message messageID.
+func (l *LinkTracker) Links(ctx context.Context, messageID string) ([]*TrackedLink, error) {
+	docs, err := l.links.Where("message_id", "==", messageID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	links := make([]*TrackedLink, 0, len(docs))
+	for _, d := range docs {
+		link := new(TrackedLink)
+		if err := d.DataTo(link); err != nil {
+			return nil, err
+		}
+		link.Code = d.Ref.ID
+		links = append(links, link)
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].CreatedAt.Before(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+// Clicks returns the clicks of links sent in message messageID, ordered by timestamp.
+func (l *LinkTracker) Clicks(ctx context.Context, messageID string) ([]*LinkClick, error) {
+	docs, err := l.clicks.Where("message_id", "==", messageID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	clicks := make([]*LinkClick, 0, len(docs))
+	for _, d := range docs {
+		c := new(LinkClick)
+		if err := d.DataTo(c); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, c)
+	}
+	sort.SliceStable(clicks, func(i, j int) bool {
+		return clicks[i].TimeStamp.Before(clicks[j].TimeStamp)
+	})
+	return clicks, nil
+}
+
+// ClickHandler records a click of the short link whose code is the last element of the request path,
+// then redirects to the url of the link. As a broken link is worse than a lost click,
+// the redirect is made even if the click fails to record.
+func ClickHandler(l *LinkTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		link, err := l.Resolve(r.Context(), path.Base(r.URL.Path))
+		if errors.Is(err, ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// link previews of messengers make HEAD requests, they are not clicks
+		if r.Method == http.MethodGet {
+			l.clicks.NewDoc().Create(r.Context(), LinkClick{
+				Code:       link.Code,
+				URL:        link.URL,
+				MessageID:  link.MessageID,
+				CampaignID: link.CampaignID,
+				TimeStamp:  time.Now(),
+				UserAgent:  r.UserAgent(),
+			})
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, link.URL, http.StatusFound)
+	}
+}
+
+// linkPattern matches the urls of a body
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// shortenLinks returns body with its urls replaced by short links of s.
+// A url sent more than once in body is shortened once. Punctuation ending a sentence is not of the url.
+func shortenLinks(ctx context.Context, s Shortener, p *Poke, body string) (string, error) {
+	short := make(map[string]string)
+	var err error
+	out := linkPattern.ReplaceAllStringFunc(body, func(long string) string {
+		trimmed := strings.TrimRight(long, ".,;:!?)'")
+		tail := long[len(trimmed):]
+		if err != nil || trimmed == "" {
+			return long
+		}
+		if u, ok := short[trimmed]; ok {
+			return u + tail
+		}
+		var u string
+		if u, err = s.Shorten(ctx, p, trimmed); err != nil {
+			return long
+		}
+		short[trimmed] = u
+		return u + tail
+	})
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
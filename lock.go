@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lease is a held lock
+type lease struct {
+	Holder  string    `firestore:"holder"`
+	Expires time.Time `firestore:"expires"`
+}
+
+// Locker hands out named locks, held by leases in a firestore collection,
+// to elect one of several replicas, e.g. the one dispatching.
+// A lease expires if it is not renewed, so a lock of a crashed holder can be taken again.
+type Locker struct {
+	c   *firestore.Client
+	col *firestore.CollectionRef
+}
+
+// NewLocker returns a Locker keeping leases in collection col.
+func NewLocker(c *firestore.Client, col string) *Locker {
+	return &Locker{c: c, col: c.Collection(col)}
+}
+
+// ErrLockLost is the cause of the context of a held lock done because its lease could not be renewed.
+var ErrLockLost = errors.New("notify: lock lost")
+
+// Lock takes lock name for ttl, if it is not held by others. acquired reports whether it is taken.
+// While held, the lease is renewed every half ttl, until release is called or ctx is done.
+// held, of ctx, is done when the lock is released or lost: if a renewal fails, held is
+// cancelled with ErrLockLost as its cause, as the lease may expire, and be taken by others,
+// before the next renewal. Work done under the lock should be done with held.
+// A holder failing to renew the lease, e.g. crashed or cut off, loses it when it expires.
+// release gives up the lock. held and release are nil if the lock is not taken.
+func (l *Locker) Lock(ctx context.Context, name string, ttl time.Duration) (held context.Context, release func(), acquired bool, err error) {
+	ref := l.col.Doc(name)
+	holder := ULIDGenerator{}.Generate()
+	if err := l.renew(ctx, ref, holder, ttl, true); err != nil {
+		if err == errLockHeld {
+			return nil, nil, false, nil
+		}
+		return nil, nil, false, err
+	}
+
+	held, cancel := context.WithCancelCause(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		tick := time.NewTicker(ttl / 2)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := l.renew(held, ref, holder, ttl, false); err != nil {
+					if held.Err() == nil {
+						cancel(fmt.Errorf("%w: renew %s: %v", ErrLockLost, name, err))
+					}
+					return
+				}
+			case <-held.Done():
+				return
+			}
+		}
+	}()
+	return held, func() {
+		cancel(nil)
+		<-stopped
+		l.release(context.WithoutCancel(ctx), ref, holder)
+	}, true, nil
+}
+
+// errLockHeld is returned by renew if the lease is held by another holder.
+var errLockHeld = status.Error(codes.FailedPrecondition, "lock held by another holder")
+
+// renew extends the lease of ref for holder by ttl. If take, a lease free or expired is taken.
+func (l *Locker) renew(ctx context.Context, ref *firestore.DocumentRef, holder string, ttl time.Duration, take bool) error {
+	return l.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		d, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		now := time.Now()
+		var cur lease
+		if d != nil && d.Exists() {
+			if err := d.DataTo(&cur); err != nil {
+				return err
+			}
+		}
+		mine := cur.Holder == holder
+		free := cur.Holder == "" || !cur.Expires.After(now)
+		if !mine && !(take && free) {
+			return errLockHeld
+		}
+		return tx.Set(ref, lease{Holder: holder, Expires: now.Add(ttl)})
+	})
+}
+
+// release deletes the lease of ref, if it is still of holder.
+// A failed release is left to expire.
+func (l *Locker) release(ctx context.Context, ref *firestore.DocumentRef, holder string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_ = l.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		d, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var cur lease
+		if err := d.DataTo(&cur); err != nil || cur.Holder != holder {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+}
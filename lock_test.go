@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	tests := []struct {
+		name   string
+		holder string // of a lease held before Lock, "" for none
+		want   bool
+	}{
+		{"free", "", true},
+		{"held", "other", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeClient(t)
+			l := NewLocker(c, "locks")
+			ctx := context.Background()
+			if tt.holder != "" {
+				if _, err := c.Collection("locks").Doc("dispatch").Set(ctx, lease{Holder: tt.holder, Expires: time.Now().Add(time.Hour)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			held, release, acquired, err := l.Lock(ctx, "dispatch", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if acquired != tt.want {
+				t.Fatalf("acquired = %v, want %v", acquired, tt.want)
+			}
+			if !acquired {
+				return
+			}
+			release()
+			if held.Err() == nil {
+				t.Error("held not done after release")
+			}
+			if errors.Is(context.Cause(held), ErrLockLost) {
+				t.Errorf("released lock lost: %v", context.Cause(held))
+			}
+		})
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	c, _ := newFakeClient(t)
+	l := NewLocker(c, "locks")
+	ctx := context.Background()
+	held, release, acquired, err := l.Lock(ctx, "dispatch", 100*time.Millisecond)
+	if err != nil || !acquired {
+		t.Fatalf("Lock = %v, %v", acquired, err)
+	}
+	defer release()
+	// another holder takes the lease, so the next renewal fails
+	if _, err := c.Collection("locks").Doc("dispatch").Set(ctx, lease{Holder: "other", Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-held.Done():
+	case <-time.After(time.Second):
+		t.Fatal("held not done after the lease is lost")
+	}
+	if !errors.Is(context.Cause(held), ErrLockLost) {
+		t.Errorf("cause = %v, want ErrLockLost", context.Cause(held))
+	}
+}
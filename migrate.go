@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// migratePage is the number of pokes read at a time by MigrateDueFields
+const migratePage = 500
+
+// dueMigration records the tenants whose pokes the store has migrated, see migrateDue.
+type dueMigration struct {
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// MigrateDueFields writes the due time and the claim expiry, which pokes to send are queried by,
+// to the pokes of the tenant of ctx stored without them: pokes stored before the store wrote them,
+// or written by others to a collection read with WithFieldMap. Firestore queries leave out
+// documents missing a field they filter by, so such pokes are not sent until they are migrated.
+// It returns the number of pokes migrated. A poke written while it is migrated is left as written.
+//
+// The store migrates the pokes of a tenant itself before it first lists pokes to send for it.
+// Call MigrateDueFields for pokes written by others since.
+func (s *firePokeStore) MigrateDueFields(ctx context.Context) (int, error) {
+	start := time.Now()
+	n, err := s.migrateDueFields(ctx)
+	s.logOp(ctx, "migrate_due_fields", start, err, slog.Int("migrated", n))
+	if err != nil {
+		return n, firePokeStoreErr{
+			err,
+			"migrate_due_fields",
+			"",
+		}
+	}
+	return n, nil
+}
+
+func (s *firePokeStore) migrateDueFields(ctx context.Context) (int, error) {
+	missing, err := s.missingDueFields(ctx)
+	if err != nil || !missing {
+		return 0, err
+	}
+	q, err := s.scope(ctx, s.pokeQuery().OrderBy(firestore.DocumentID, firestore.Asc).Limit(migratePage))
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for page := q; ; {
+		docs, err := s.queryDocs(ctx, page)
+		if err != nil {
+			return n, err
+		}
+		for _, d := range docs {
+			updates, err := s.dueUpdates(d)
+			if err != nil {
+				return n, err
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			// a poke written since it was read has the fields already
+			_, err = d.Ref.Update(ctx, updates, firestore.LastUpdateTime(d.UpdateTime))
+			if status.Code(err) == codes.FailedPrecondition {
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(docs) < migratePage {
+			return n, nil
+		}
+		page = q.StartAfter(docs[len(docs)-1])
+	}
+}
+
+// missingDueFields reports whether pokes of the tenant of ctx miss the due time or the claim expiry,
+// by counting those having them, as the least timestamp is the zero time, against all.
+func (s *firePokeStore) missingDueFields(ctx context.Context) (bool, error) {
+	fields := []string{"claim_expires"}
+	if s.fields.DueAt != s.fields.DateToSend {
+		fields = append(fields, s.fields.DueAt)
+	}
+	all, err := s.countQuery(ctx, s.pokeQuery())
+	if err != nil || all == 0 {
+		return false, err
+	}
+	for _, f := range fields {
+		n, err := s.countQuery(ctx, s.pokeQuery().Where(f, ">=", time.Time{}))
+		if err != nil || n < all {
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+// countQuery counts the documents of q in the tenant of ctx.
+func (s *firePokeStore) countQuery(ctx context.Context, q firestore.Query) (int, error) {
+	q, err := s.scope(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.count(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	v, _ := res["count"].(*firestorepb.Value)
+	return int(v.GetIntegerValue()), nil
+}
+
+// dueUpdates returns the writes of the fields d misses of the due time and the claim expiry.
+func (s *firePokeStore) dueUpdates(d *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	var updates []firestore.Update
+	if _, err := d.DataAt("claim_expires"); err != nil {
+		updates = append(updates, firestore.Update{Path: "claim_expires", Value: time.Time{}})
+	}
+	if s.fields.DueAt != s.fields.DateToSend {
+		if _, err := d.DataAt(s.fields.DueAt); err != nil {
+			p := new(Poke)
+			if err := s.decodePoke(d, p); err != nil {
+				return nil, err
+			}
+			updates = append(updates, firestore.Update{Path: s.fields.DueAt, Value: p.dueAt()})
+		}
+	}
+	return updates, nil
+}
+
+// migrateDue migrates the pokes of the tenant of ctx once, before they are first listed to send,
+// so pokes stored without the fields of dueQuery are sent. A failed migration is logged,
+// and tried again at the next listing.
+func (s *firePokeStore) migrateDue(ctx context.Context) {
+	tenant := TenantFrom(ctx)
+	s.migration.mu.Lock()
+	defer s.migration.mu.Unlock()
+	if s.migration.done[tenant] {
+		return
+	}
+	n, err := s.MigrateDueFields(ctx)
+	if err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "migrate pokes to send failed", slog.Int("migrated", n), slog.Any("error", err))
+		return
+	}
+	if s.migration.done == nil {
+		s.migration.done = make(map[string]bool)
+	}
+	s.migration.done[tenant] = true
+}
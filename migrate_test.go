@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMigrateDueFields(t *testing.T) {
+	due := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		fields FieldMap
+		doc    map[string]interface{} // a poke stored by others, without the fields of dueQuery
+	}{
+		{"stored before due_at", FieldMap{}, map[string]interface{}{"tunnel": TypeSMS, "to": "+15555550100", "body": "hi", "date_to_send": due}},
+		{"mapped", FieldMap{DateToSend: "send_at"}, map[string]interface{}{"tunnel": TypeSMS, "to": "+15555550100", "body": "hi", "send_at": due}},
+		{"mapped due at date to send", FieldMap{DateToSend: "send_at", DueAt: "send_at"}, map[string]interface{}{"tunnel": TypeSMS, "to": "+15555550100", "body": "hi", "send_at": due}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t, WithFieldMap(tt.fields))
+			ctx := context.Background()
+			if _, err := s.pokeCol.Doc("old").Set(ctx, tt.doc); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "new", DateToSend: due}); err != nil {
+				t.Fatal(err)
+			}
+
+			pokes, err := s.ListToSend(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, p := range pokes {
+				found = found || p.ID == "old"
+			}
+			if len(pokes) != 2 || !found {
+				t.Errorf("ListToSend = %d pokes, old listed %v, want 2 with old", len(pokes), found)
+			}
+			if n, err := s.MigrateDueFields(ctx); err != nil || n != 0 {
+				t.Errorf("MigrateDueFields again = %d, %v, want 0 migrated", n, err)
+			}
+		})
+	}
+}
+
+func TestMigrateDueFieldsCount(t *testing.T) {
+	s, _ := newFakeStore(t)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := s.pokeCol.Doc(id).Set(ctx, map[string]interface{}{"tunnel": TypeSMS, "to": "+15555550100", "date_to_send": time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := s.MigrateDueFields(ctx); err != nil || n != 3 {
+		t.Errorf("MigrateDueFields = %d, %v, want 3 migrated", n, err)
+	}
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"log/slog"
+	"time"
+)
+
+// TunnelOption configures a Tunnel. Tunnels ignore options they do not support.
+type TunnelOption func(*tunnelOptions)
+
+type tunnelOptions struct {
+	trackingURL string
+	region      string
+	callbackURL string
+	logger      *slog.Logger
+	checkMedia  bool
+	sanitizers  []Sanitizer
+
+	transliterate bool
+	dropNonGSM    bool
+
+	unsubscribeURL string
+	unsubscribeKey []byte
+
+	images map[string]InlineImage // by content ID
+
+	parseMode string
+
+	messagingService string
+
+	shortener Shortener
+}
+
+// log returns the logger of tunnel, falling back to slog.Default()
+func (o tunnelOptions) log() *slog.Logger {
+	if o.logger == nil {
+		return slog.Default()
+	}
+	return o.logger
+}
+
+// WithTrackingPixel makes email tunnels inject a tracking pixel into HTML bodies.
+// url should be served by ReadReceiptHandler; the poke ID is passed as query "id".
+func WithTrackingPixel(url string) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.trackingURL = url
+	}
+}
+
+// WithDefaultRegion sets the region (ISO 3166 code, e.g. "US") of phone numbers
+// given without a country code.
+func WithDefaultRegion(region string) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.region = region
+	}
+}
+
+// WithCallbackURL sets the default status callback URL of sms tunnels.
+// Poke.CallbackURL overrides it.
+func WithCallbackURL(url string) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.callbackURL = url
+	}
+}
+
+// WithLogger sets the logger of a tunnel. The default is slog.Default().
+func WithLogger(l *slog.Logger) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.logger = l
+	}
+}
+
+// StoreOption configures the PokeStore returned by NewFirePokeStore
+type StoreOption func(*firePokeStore)
+
+// WithStoreLogger sets the logger of the store. The default is slog.Default().
+func WithStoreLogger(l *slog.Logger) StoreOption {
+	return func(s *firePokeStore) {
+		s.logger = l
+	}
+}
+
+// WithArchiveRetainBody makes Archive keep subject, bodies and date to send of pokes.
+// It is off by default, so message content is not kept after sending.
+func WithArchiveRetainBody(retain bool) StoreOption {
+	return func(s *firePokeStore) {
+		s.retainBody = retain
+	}
+}
+
+// WithIDGenerator makes the store give pokes and records IDs of g.
+// The default is firestore auto IDs.
+func WithIDGenerator(g IDGenerator) StoreOption {
+	return func(s *firePokeStore) {
+		s.idGen = g
+	}
+}
+
+// WithListLimit sets the max number of pokes listed by ListToSend and ListExpired.
+// The default is 1000. n <= 0 lists all pokes.
+func WithListLimit(n int) StoreOption {
+	return func(s *firePokeStore) {
+		s.listLimit = n
+	}
+}
+
+// WithMessagingService makes sms tunnels schedule pokes due 15 minutes to 7 days ahead
+// at twilio, through messaging service sid, rather than sending them now.
+// Scheduled pokes are recorded as StatusQueued.
+// Only pokes sent before they are due are scheduled, i.e. by Dispatcher.SendNow or by calling Send:
+// Run sends pokes once they are due, which twilio then sends right away.
+func WithMessagingService(sid string) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.messagingService = sid
+	}
+}
+
+// WithFieldMap makes the store query and write the fields of pokes under the names of m,
+// to use a poke collection whose documents name them otherwise. Pokes of the collection are
+// given the due time and claim expiry the store queries by, see MigrateDueFields.
+func WithFieldMap(m FieldMap) StoreOption {
+	return func(s *firePokeStore) {
+		s.fields = m.withDefaults()
+	}
+}
+
+// WithJitter makes Create put off pokes by a random duration up to window,
+// spreading pokes due at the same time, like a mass send, over the window.
+// Pokes are not put off past their expiry.
+func WithJitter(window time.Duration) StoreOption {
+	return func(s *firePokeStore) {
+		s.jitter = window
+	}
+}
+
+// WithDefaultExpiry makes Create give pokes without an expiry one of d after their date to send.
+// Without it, such pokes never expire.
+func WithDefaultExpiry(d time.Duration) StoreOption {
+	return func(s *firePokeStore) {
+		s.defaultExpiry = d
+	}
+}
+
+// WithReadRetry makes the store retry reads outside transactions, like Get and the lists,
+// up to n times on codes.Unavailable and codes.DeadlineExceeded, waiting base before the first
+// retry and doubling it after. Retries stop at the deadline of the context.
+// Transactions are retried by firestore, and are not affected.
+func WithReadRetry(n int, base time.Duration) StoreOption {
+	return func(s *firePokeStore) {
+		s.readRetries = n
+		s.readBackoff = base
+	}
+}
+
+// WithRecordBatching makes CreateRecord gather records created within window, up to 500,
+// and create them in one transaction, to cut writes of bursts like status callback storms.
+// CreateRecord still returns after its record is written, so it waits up to window longer;
+// records of a message are written in the order they are created.
+func WithRecordBatching(window time.Duration) StoreOption {
+	return func(s *firePokeStore) {
+		s.recBatch = &recordBatcher{s: s, window: window}
+	}
+}
+
+// WithDefaultMaxAttempts makes Create give pokes without a MaxAttempts one of n.
+func WithDefaultMaxAttempts(n int) StoreOption {
+	return func(s *firePokeStore) {
+		s.defaultMaxAttempts = n
+	}
+}
+
+// WithMaxBacklog makes Create fail with ErrBacklogFull while max or more pokes are pending,
+// so a runaway producer can not flood the queue. The backlog is counted by CountPending
+// at most once per ttl, and counted up by creates in between; so it is cheap, but may be
+// off by pokes sent since, or created by other processes. Tenants have backlogs of their own.
+func WithMaxBacklog(max int, ttl time.Duration) StoreOption {
+	return func(s *firePokeStore) {
+		s.backlog = &backlogCounter{max: max, ttl: ttl, counts: make(map[string]backlogCount)}
+	}
+}
+
+// WithTenantIsolation makes the store keep tenants apart. Every operation needs a tenant in
+// its context, given by WithTenant, or fails with ErrNoTenant. Pokes and records are tagged with
+// the tenant when created, queries only match documents of the tenant, and documents of other
+// tenants are not found. Handlers, like TwilioCallbackHandler, need a middleware putting
+// the tenant in request contexts, and a Dispatcher runs for the tenant of its context.
+// Queries filter by tenant_id, so they need composite indexes beginning with it.
+func WithTenantIsolation() StoreOption {
+	return func(s *firePokeStore) {
+		s.tenants = true
+	}
+}
+
+// WithEventSink makes the store append an event of every mutation of pokes to sink:
+// create, update, reschedule, claim, delete and archive. A failed append is logged.
+func WithEventSink(sink EventSink) StoreOption {
+	return func(s *firePokeStore) {
+		s.sink = sink
+	}
+}
+
+// WithMediaCheck makes sms tunnels check media urls of MMS are reachable before sending.
+func WithMediaCheck(check bool) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.checkMedia = check
+	}
+}
+
+// WithSanitizer makes sms tunnels run fns on bodies before sending.
+// Without fns, DefaultSanitizers are run.
+func WithSanitizer(fns ...Sanitizer) TunnelOption {
+	if len(fns) == 0 {
+		fns = DefaultSanitizers
+	}
+	return func(o *tunnelOptions) {
+		o.sanitizers = fns
+	}
+}
+
+// WithUnsubscribe makes email tunnels add an unsubscribe link and a List-Unsubscribe header
+// to marketing pokes. url should be served by UnsubscribeHandler with the same key;
+// the signed token is passed as query "token".
+func WithUnsubscribe(url string, key []byte) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.unsubscribeURL = url
+		o.unsubscribeKey = key
+	}
+}
+
+// WithInlineImages makes email tunnels embed images, e.g. logos, in HTML bodies referencing them
+// by src="cid:<CID>", rather than have clients load them. They are attached to the emails using them.
+// A body referencing a content ID not given is not sent. Content IDs are letters, digits and "._@-".
+func WithInlineImages(images ...InlineImage) TunnelOption {
+	return func(o *tunnelOptions) {
+		if o.images == nil {
+			o.images = make(map[string]InlineImage, len(images))
+		}
+		for _, img := range images {
+			o.images[img.CID] = img
+		}
+	}
+}
+
+// WithParseMode sets the parse mode of telegram messages, e.g. "MarkdownV2" or "HTML".
+// The default is "Markdown". An empty mode sends bodies as plain text.
+func WithParseMode(mode string) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.parseMode = mode
+	}
+}
+
+// WithLinkShortener makes sms tunnels replace urls in bodies with short links of s, e.g. a LinkTracker,
+// to take fewer segments and to track clicks. The body sent is recorded in MetaSanitized.
+func WithLinkShortener(s Shortener) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.shortener = s
+	}
+}
+
+// WithTransliteration makes sms tunnels Transliterate bodies to GSM 03.38 before sending,
+// so they are not sent as UCS-2 which takes about twice the segments.
+// Characters left outside GSM are dropped if drop, otherwise the poke is invalid.
+func WithTransliteration(drop bool) TunnelOption {
+	return func(o *tunnelOptions) {
+		o.transliterate = true
+		o.dropNonGSM = drop
+	}
+}
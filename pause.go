@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrTunnelPaused is returned by PausableTunnel when it is paused.
+var ErrTunnelPaused = errors.New("notify: tunnel paused")
+
+// PausableTunnel is a Tunnel that holds sends while paused, e.g. during a provider incident.
+// The Dispatcher keeps pokes refused by a paused tunnel queued, to send after Resume.
+// It should be initialized by NewPausableTunnel.
+type PausableTunnel struct {
+	t      Tunnel
+	paused int32
+}
+
+// NewPausableTunnel returns a PausableTunnel wrapping t, not paused.
+func NewPausableTunnel(t Tunnel) *PausableTunnel {
+	return &PausableTunnel{t: t}
+}
+
+// Pause makes t refuse sends until Resume.
+func (t *PausableTunnel) Pause() { atomic.StoreInt32(&t.paused, 1) }
+
+// Resume makes t send again.
+func (t *PausableTunnel) Resume() { atomic.StoreInt32(&t.paused, 0) }
+
+// IsPaused reports whether t is paused.
+func (t *PausableTunnel) IsPaused() bool { return atomic.LoadInt32(&t.paused) == 1 }
+
+// Type is a method of Tunnel interface
+func (t *PausableTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t *PausableTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t *PausableTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// While paused, it returns a StatusQueued Record and ErrTunnelPaused without calling the wrapped tunnel.
+func (t *PausableTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	if t.IsPaused() {
+		return Record{
+			MessageID: p.ID,
+			Status:    StatusQueued,
+			TimeStamp: time.Now(),
+		}, ErrTunnelPaused
+	}
+	return t.t.Send(ctx, p)
+}
+
+// Follow pauses and resumes t as the bool field "paused" of the document ref changes,
+// so an operator can hold a tunnel on every instance by writing one document.
+// A missing document or field means not paused. Follow blocks until ctx is done or listening fails.
+func (t *PausableTunnel) Follow(ctx context.Context, ref *firestore.DocumentRef) error {
+	iter := ref.Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if err != nil {
+			if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+				return ctx.Err()
+			}
+			return err
+		}
+		paused := false
+		if snap.Exists() {
+			if v, err := snap.DataAt("paused"); err == nil {
+				paused, _ = v.(bool)
+			}
+		}
+		if paused {
+			t.Pause()
+		} else {
+			t.Resume()
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPhone is returned when a phone number can not be normalized.
+var ErrInvalidPhone = errors.New("notify: invalid phone number")
+
+// phoneRegion is the dialing plan of a region
+type phoneRegion struct {
+	code  string // country calling code
+	intl  string // international call prefix
+	trunk string // national trunk prefix
+}
+
+// phoneRegions are the known regions, keyed by ISO 3166 code.
+var phoneRegions = map[string]phoneRegion{
+	"US": {"1", "011", "1"},
+	"CA": {"1", "011", "1"},
+	"GB": {"44", "00", "0"},
+	"IE": {"353", "00", "0"},
+	"DE": {"49", "00", "0"},
+	"FR": {"33", "00", "0"},
+	"IT": {"39", "00", ""},
+	"ES": {"34", "00", ""},
+	"PT": {"351", "00", ""},
+	"NL": {"31", "00", "0"},
+	"BE": {"32", "00", "0"},
+	"CH": {"41", "00", "0"},
+	"AT": {"43", "00", "0"},
+	"SE": {"46", "00", "0"},
+	"NO": {"47", "00", ""},
+	"DK": {"45", "00", ""},
+	"FI": {"358", "00", "0"},
+	"PL": {"48", "00", ""},
+	"RU": {"7", "810", "8"},
+	"TR": {"90", "00", "0"},
+	"IL": {"972", "00", "0"},
+	"AE": {"971", "00", "0"},
+	"ZA": {"27", "00", "0"},
+	"IN": {"91", "00", "0"},
+	"CN": {"86", "00", "0"},
+	"HK": {"852", "001", ""},
+	"TW": {"886", "002", "0"},
+	"JP": {"81", "010", "0"},
+	"KR": {"82", "001", "0"},
+	"SG": {"65", "000", ""},
+	"MY": {"60", "00", "0"},
+	"TH": {"66", "001", "0"},
+	"VN": {"84", "00", "0"},
+	"PH": {"63", "00", "0"},
+	"ID": {"62", "001", "0"},
+	"AU": {"61", "0011", "0"},
+	"NZ": {"64", "00", "0"},
+	"BR": {"55", "0021", "0"},
+	"MX": {"52", "00", ""},
+	"AR": {"54", "00", "0"},
+}
+
+// recipientKey returns recipient to as archived pokes are matched by: normalized, if a phone number
+// with a country code, so numbers written differently match; or else as is.
+func recipientKey(to string) string {
+	if n, err := NormalizePhone(to, ""); err == nil {
+		return n
+	}
+	return to
+}
+
+// NormalizePhone returns raw in E.164 format, e.g. "+15551234567".
+// Spaces, dots, dashes and parentheses are ignored.
+// Numbers without "+" are dialed from defaultRegion: its international prefix
+// or trunk prefix is stripped, and its country code is added. Numbers dialed by 00,
+// the international prefix of most regions, are invalid in regions dialing abroad otherwise, e.g. US.
+func NormalizePhone(raw, defaultRegion string) (string, error) {
+	var b strings.Builder
+	s := strings.TrimSpace(raw)
+	plus := strings.HasPrefix(s, "+")
+	if plus {
+		s = s[1:]
+	}
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return "", fmt.Errorf("%w: %q has invalid character %q", ErrInvalidPhone, raw, r)
+		}
+	}
+	digits := b.String()
+
+	if !plus {
+		region, ok := phoneRegions[strings.ToUpper(defaultRegion)]
+		if !ok {
+			return "", fmt.Errorf("%w: %q has no country code and region %q is unknown", ErrInvalidPhone, raw, defaultRegion)
+		}
+		switch {
+		case strings.HasPrefix(digits, region.intl):
+			digits = strings.TrimPrefix(digits, region.intl)
+		case strings.HasPrefix(digits, "00"):
+			// most regions dial abroad by 00; taken as national, e.g. +1 0044..., it would be another number
+			return "", fmt.Errorf("%w: %q is dialed by 00, but region %q dials abroad by %s",
+				ErrInvalidPhone, raw, defaultRegion, region.intl)
+		case region.trunk != "" && strings.HasPrefix(digits, region.trunk):
+			digits = region.code + strings.TrimPrefix(digits, region.trunk)
+		default:
+			digits = region.code + digits
+		}
+	}
+
+	// E.164 is at most 15 digits. the shortest numbers in use are around 8.
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPhone, raw)
+	}
+	return "+" + digits, nil
+}
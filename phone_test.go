@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw, region string
+		want        string // "" for invalid
+	}{
+		{"+1 (555) 555-0100", "", "+15555550100"},
+		{"(555) 555-0100", "US", "+15555550100"},
+		{"1 555 555 0100", "US", "+15555550100"},
+		{"011 44 20 7946 0958", "US", "+442079460958"},
+		{"0044 20 7946 0958", "US", ""},
+		{"0044 20 7946 0958", "GB", "+442079460958"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"06 1234 5678", "IT", "+390612345678"},
+		{"8 912 345 67 89", "RU", "+79123456789"},
+		{"555 0100", "", ""},
+		{"+1 555 CALL NOW", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw+" "+tt.region, func(t *testing.T) {
+			got, err := NormalizePhone(tt.raw, tt.region)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidPhone) {
+					t.Errorf("NormalizePhone = %q, %v, want ErrInvalidPhone", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizePhone = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"context"
+	"strings"
+)
+
+// PreviewResult is what a recipient would receive of a poke.
+type PreviewResult struct {
+	Subject  string `json:"subject,omitempty"`
+	Body     string `json:"body"`
+	Raw      []byte `json:"raw,omitempty"`      // email only. the full MIME message.
+	Segments int    `json:"segments,omitempty"` // sms only. number of messages the body is billed as.
+}
+
+// Previewer is a Tunnel that can compose a poke without sending it.
+type Previewer interface {
+	Preview(ctx context.Context, p *Poke) (PreviewResult, error)
+}
+
+// Preview returns what t would send for p, without contacting the provider.
+// Tunnels not implementing Previewer preview the subject and body of p as is.
+// Wrapping tunnels, like TimeoutTunnel, do not implement Previewer; preview with the wrapped tunnel.
+func Preview(ctx context.Context, t Tunnel, p *Poke) (PreviewResult, error) {
+	if pv, ok := t.(Previewer); ok {
+		return pv.Preview(ctx, p)
+	}
+	return PreviewResult{Subject: p.Subject, Body: p.Body}, nil
+}
+
+// Preview is a method of Previewer interface. The body is sanitized and transliterated as Send does.
+func (t SMSTunnel) Preview(ctx context.Context, p *Poke) (PreviewResult, error) {
+	body, _, err := t.body(p)
+	if err != nil {
+		return PreviewResult{}, err
+	}
+	return PreviewResult{Body: body, Segments: smsSegments(body)}, nil
+}
+
+// Preview is a method of Previewer interface. Raw is the message Send would send.
+func (t GMailTunnel) Preview(ctx context.Context, p *Poke) (PreviewResult, error) {
+	msg, inline, err := t.compose(p)
+	if err != nil {
+		return PreviewResult{}, err
+	}
+	raw, err := messageBytes(msg, inline)
+	if err != nil {
+		return PreviewResult{}, err
+	}
+	return PreviewResult{Subject: p.Subject, Body: string(msg.Text), Raw: raw}, nil
+}
+
+// Preview is a method of Previewer interface. It previews with the first sender.
+func (t *RotatingEmailTunnel) Preview(ctx context.Context, p *Poke) (PreviewResult, error) {
+	return t.tunnels[0].Preview(ctx, p)
+}
+
+// gsmBasic and gsmExtended are the GSM 03.38 characters. Extended ones take two septets.
+const (
+	gsmBasic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtended = "^{}\\[~]|€\f"
+)
+
+// smsSegments returns how many sms body is sent as.
+// GSM 7-bit bodies fit 160 characters in one sms, 153 each if split;
+// other bodies are UCS-2, which fit 70, 67 if split.
+func smsSegments(body string) int {
+	septets := 0
+	gsm := true
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsmBasic, r):
+			septets++
+		case strings.ContainsRune(gsmExtended, r):
+			septets += 2
+		default:
+			gsm = false
+		}
+	}
+	if !gsm {
+		// UCS-2 counts UTF-16 units; characters beyond the BMP take two.
+		units := 0
+		for _, r := range body {
+			units++
+			if r > 0xFFFF {
+				units++
+			}
+		}
+		return segments(units, 70, 67)
+	}
+	return segments(septets, 160, 153)
+}
+
+// segments returns how many messages n units are split into.
+func segments(n, single, multi int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n <= single:
+		return 1
+	}
+	return (n + multi - 1) / multi
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRateLimited is returned when a provider refuses a send because of its rate limit.
+var ErrRateLimited = errors.New("notify: rate limited")
+
+// RateLimitError is an error wrapping ErrRateLimited, telling how long to wait before retrying.
+// RetryAfter is zero if the provider does not tell.
+// Dispatcher WithRetry retries after RetryAfter, instead of its backoff.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error // the error of the provider, if any
+}
+
+func (e *RateLimitError) Error() string {
+	msg := ErrRateLimited.Error()
+	if e.RetryAfter > 0 {
+		msg = fmt.Sprintf("%s: retry after %s", msg, e.RetryAfter)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns ErrRateLimited, and the error of the provider if any.
+func (e *RateLimitError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrRateLimited}
+	}
+	return []error{ErrRateLimited, e.Err}
+}
+
+// retryAfter returns the wait of a Retry-After header, given in seconds or as a date.
+// It returns 0 without one.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readRetryable reports whether a failed read may succeed if retried.
+func readRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// retryRead calls read, and calls it again on errors of readRetryable, as set by WithReadRetry.
+// The wait before a retry is doubled every time. It gives up with the last error
+// when ctx is done, or its deadline comes before the next retry.
+func (s *firePokeStore) retryRead(ctx context.Context, read func() error) error {
+	err := read()
+	delay := s.readBackoff
+	for i := 0; i < s.readRetries && err != nil && readRetryable(err); i++ {
+		if ctx.Err() != nil {
+			return err
+		}
+		if dl, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(dl) {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		delay *= 2
+		err = read()
+	}
+	return err
+}
+
+// getDoc reads ref, retrying as retryRead.
+// As ref.Get, a missing document is returned with an error of codes.NotFound.
+func (s *firePokeStore) getDoc(ctx context.Context, ref *firestore.DocumentRef) (d *firestore.DocumentSnapshot, err error) {
+	err = s.retryRead(ctx, func() error {
+		d, err = ref.Get(ctx)
+		return err
+	})
+	return d, err
+}
+
+// getDocs reads refs, retrying as retryRead.
+func (s *firePokeStore) getDocs(ctx context.Context, refs []*firestore.DocumentRef) (docs []*firestore.DocumentSnapshot, err error) {
+	err = s.retryRead(ctx, func() error {
+		docs, err = s.c.GetAll(ctx, refs)
+		return err
+	})
+	return docs, err
+}
+
+// queryDocs reads documents of q, retrying as retryRead.
+// A retry reads q from the start.
+func (s *firePokeStore) queryDocs(ctx context.Context, q firestore.Query) (docs []*firestore.DocumentSnapshot, err error) {
+	err = s.retryRead(ctx, func() error {
+		docs, err = q.Documents(ctx).GetAll()
+		return err
+	})
+	return docs, err
+}
+
+// count counts documents of q by an aggregation query, retrying as retryRead.
+func (s *firePokeStore) count(ctx context.Context, q firestore.Query) (res firestore.AggregationResult, err error) {
+	err = s.retryRead(ctx, func() error {
+		res, err = q.NewAggregationQuery().WithCount("count").Get(ctx)
+		return err
+	})
+	return res, err
+}
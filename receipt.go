@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pixel is a transparent 1x1 gif.
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// ReadReceiptHandler records a StatusRead Record for the message ID given in query "id",
+// then responds a tracking pixel.
+// A message is recorded as read once, no matter how many times it is opened: the read is an
+// event of the message, created once, see CreateRecord.
+func ReadReceiptHandler(store PokeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "missing message id", http.StatusBadRequest)
+			return
+		}
+
+		rec := Record{
+			MessageID: id,
+			Status:    StatusRead,
+			TimeStamp: time.Now(),
+		}
+		rec.setMeta(MetaEventID, "read")
+		if _, err := store.CreateRecord(r.Context(), rec); err != nil {
+			slog.ErrorContext(r.Context(), "record read receipt failed", slog.String("poke_id", id), slog.Any("error", err))
+			http.Error(w, "could not record read receipt", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(pixel)
+	}
+}
+
+// injectTrackingPixel puts a tracking pixel of poke id at the end of the html body.
+// body is returned as is if trackingURL is empty.
+func injectTrackingPixel(body, trackingURL, id string) string {
+	if trackingURL == "" {
+		return body
+	}
+	u, err := url.Parse(trackingURL)
+	if err != nil {
+		return body
+	}
+	q := u.Query()
+	q.Set("id", id)
+	u.RawQuery = q.Encode()
+
+	img := `<img src="` + html.EscapeString(u.String()) + `" width="1" height="1" alt="" style="display:none">`
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + img + body[i:]
+	}
+	return body + img
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadReceiptHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		opens int
+		code  int
+		want  int // read records
+	}{
+		{"opened", 1, http.StatusOK, 1},
+		{"opened again", 3, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			for i := 0; i < tt.opens; i++ {
+				rec := httptest.NewRecorder()
+				ReadReceiptHandler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read?id=p1", nil))
+				if rec.Code != tt.code {
+					t.Fatalf("code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+				}
+			}
+			recs, err := s.GetRecord(context.Background(), "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			for _, r := range recs {
+				if r.Status == StatusRead {
+					n++
+				}
+			}
+			if n != tt.want {
+				t.Errorf("%d read records, want %d", n, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// recordBatcher coalesces records created by CreateRecord within a window into one write.
+// Callers wait for the write of their batch, so CreateRecord returns as it does unbatched,
+// and nothing is left to flush on shutdown once the callers return.
+type recordBatcher struct {
+	s      *firePokeStore
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []*batchedRecord
+	timer   *time.Timer
+
+	flushMu sync.Mutex // one batch at a time, to keep records of a message in order
+}
+
+// batchedRecord is a record waiting for its batch to be written
+type batchedRecord struct {
+	rec  Record
+	err  error
+	done chan struct{}
+}
+
+// create adds r to the batch, and waits until the batch is written, or ctx is done.
+// A record whose ctx is done is still written with its batch.
+func (b *recordBatcher) create(ctx context.Context, r Record) (Record, error) {
+	br := &batchedRecord{rec: r, done: make(chan struct{})}
+	b.mu.Lock()
+	b.pending = append(b.pending, br)
+	switch {
+	case len(b.pending) >= maxTxWrites:
+		if b.timer != nil {
+			b.timer.Stop()
+			b.timer = nil
+		}
+		go b.flush()
+	case b.timer == nil:
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-br.done:
+		return br.rec, br.err
+	case <-ctx.Done():
+		return Record{}, ctx.Err()
+	}
+}
+
+// flush writes the pending records in a transaction. If it fails, e.g. as a record of
+// a given ID exists, the records are created one by one, so each caller gets its own error.
+func (b *recordBatcher) flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	recs := make([]Record, len(batch))
+	for i, br := range batch {
+		recs[i] = br.rec
+	}
+	created, err := b.s.writeRecords(ctx, recs)
+	b.s.logOp(ctx, "create_record_batch", start, err, slog.Int("records", len(recs)))
+	for i, br := range batch {
+		if err == nil {
+			br.rec = created[i]
+		} else {
+			br.rec, br.err = b.s.createRecord(ctx, br.rec)
+		}
+		close(br.done)
+	}
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrWriterClosed is returned by Write after a BufferedRecordWriter is closed.
+var ErrWriterClosed = errors.New("notify: record writer closed")
+
+// defaultFlushInterval is how often a BufferedRecordWriter flushes without an interval.
+const defaultFlushInterval = time.Second
+
+// BufferedRecordWriter buffers records and creates them in batches, to cut writes of bulk sends.
+// Buffered records are flushed when size of them are buffered, every interval, and on Flush and Close.
+// Records failed to flush are kept and flushed again later, so they are written at least once,
+// but records still buffered are lost if the process crashes. Close it on shutdown.
+// It should be initialized by NewBufferedRecordWriter.
+type BufferedRecordWriter struct {
+	store  PokeStore
+	size   int
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	buf    []Record
+	closed bool
+
+	flushMu sync.Mutex // one flush at a time, to keep records in order
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewBufferedRecordWriter returns a BufferedRecordWriter creating records in store.
+// size is capped at 500, the writes of a transaction. interval defaults to a second.
+// Flushes in the background are logged to logger, or slog.Default() if nil.
+func NewBufferedRecordWriter(store PokeStore, size int, interval time.Duration, logger *slog.Logger) *BufferedRecordWriter {
+	if size <= 0 || size > maxTxWrites {
+		size = maxTxWrites
+	}
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	w := &BufferedRecordWriter{
+		store:   store,
+		size:    size,
+		logger:  logger,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.loop(interval)
+	return w
+}
+
+// loop flushes w every interval until w is closed.
+func (w *BufferedRecordWriter) loop(interval time.Duration) {
+	defer close(w.stopped)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			ctx := context.Background()
+			if err := w.Flush(ctx); err != nil {
+				w.logger.LogAttrs(ctx, slog.LevelError, "flush records failed", slog.Any("error", err))
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Write buffers r. If the buffer is full, it is flushed before Write returns;
+// the error is of the flush, and r is kept to flush again.
+func (w *BufferedRecordWriter) Write(ctx context.Context, r Record) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.buf = append(w.buf, r)
+	full := len(w.buf) >= w.size
+	w.mu.Unlock()
+
+	if full {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush creates buffered records, in batches of size.
+// Records failed to create are put back to the buffer, before records buffered since.
+func (w *BufferedRecordWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	recs := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	for i := 0; i < len(recs); i += w.size {
+		end := i + w.size
+		if end > len(recs) {
+			end = len(recs)
+		}
+		created, err := w.store.CreateRecords(ctx, recs[i:end]...)
+		if err != nil {
+			w.mu.Lock()
+			w.buf = append(recs[i+len(created):len(recs):len(recs)], w.buf...)
+			w.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops w from buffering, and flushes what is buffered.
+// If the flush fails, Close can be called again to retry it.
+func (w *BufferedRecordWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+	<-w.stopped
+	return w.Flush(ctx)
+}
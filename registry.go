@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoTunnel is returned when no registered tunnel can send a poke.
+var ErrNoTunnel = errors.New("notify: no tunnel")
+
+// Registry holds tunnels by name. Several tunnels of the same Type can be
+// registered under different names, e.g. "sms-marketing" and "sms-transactional".
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	tunnels map[string]Tunnel
+	names   []string                 // names in registration order
+	slots   map[string]chan struct{} // sends of tunnels with a MaxConcurrency
+}
+
+// RegisterOption configures a registered tunnel
+type RegisterOption func(*registration)
+
+type registration struct {
+	maxConcurrency int
+}
+
+// MaxConcurrency makes a Dispatcher send at most n pokes through the tunnel at the same time,
+// within its own WithConcurrency. n <= 0 means no limit of the tunnel.
+func MaxConcurrency(n int) RegisterOption {
+	return func(r *registration) {
+		r.maxConcurrency = n
+	}
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		tunnels: make(map[string]Tunnel),
+		slots:   make(map[string]chan struct{}),
+	}
+}
+
+// Register registers t under name. It replaces the tunnel registered under the same name.
+func (r *Registry) Register(name string, t Tunnel, opts ...RegisterOption) {
+	var reg registration
+	for _, o := range opts {
+		o(&reg)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tunnels[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.tunnels[name] = t
+	delete(r.slots, name)
+	if reg.maxConcurrency > 0 {
+		r.slots[name] = make(chan struct{}, reg.maxConcurrency)
+	}
+}
+
+// Get returns the tunnel registered under name.
+func (r *Registry) Get(name string) (Tunnel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tunnels[name]
+	return t, ok
+}
+
+// List returns registered names in registration order.
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string{}, r.names...)
+}
+
+// lookup returns the tunnel registered under name, or else the first registered tunnel
+// whose Type is name, and the name it is registered under.
+func (r *Registry) lookup(name string) (string, Tunnel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if t, ok := r.tunnels[name]; ok {
+		return name, t, true
+	}
+	for _, n := range r.names {
+		if t := r.tunnels[n]; t.Type() == name {
+			return n, t, true
+		}
+	}
+	return "", nil, false
+}
+
+// acquire waits for a slot of the tunnel to send p, if it has a MaxConcurrency,
+// and returns a func to release it.
+func (r *Registry) acquire(p *Poke) func() {
+	name, _, ok := r.lookup(p.Tunnel)
+	if !ok {
+		return func() {}
+	}
+	r.mu.RLock()
+	slots := r.slots[name]
+	r.mu.RUnlock()
+	if slots == nil {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// ResolveTunnel returns the tunnel that would send p: the one registered under p.Tunnel,
+// or else the first registered one whose Type is p.Tunnel.
+// It can be used to reject a poke before creating it.
+func (r *Registry) ResolveTunnel(p *Poke) (Tunnel, error) {
+	_, t, ok := r.lookup(p.Tunnel)
+	if !ok {
+		return nil, fmt.Errorf("%w for %q", ErrNoTunnel, p.Tunnel)
+	}
+	return t, nil
+}
+
+// CoveredTypes returns the Types of registered tunnels, sorted, each once.
+func (r *Registry) CoveredTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool, len(r.tunnels))
+	types := make([]string, 0, len(r.tunnels))
+	for _, t := range r.tunnels {
+		if typ := t.Type(); !seen[typ] {
+			seen[typ] = true
+			types = append(types, typ)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ValidateCoverage returns an error wrapping ErrNoTunnel, listing the types of required
+// no registered tunnel is of, or nil if every one is covered.
+// Call it at startup, so a registry missing a tunnel fails before pokes are dispatched to it.
+func (r *Registry) ValidateCoverage(required ...string) error {
+	covered := make(map[string]bool)
+	for _, typ := range r.CoveredTypes() {
+		covered[typ] = true
+	}
+	var missing []string
+	for _, typ := range required {
+		if !covered[typ] {
+			missing = append(missing, typ)
+			covered[typ] = true // listed once
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w of type %s", ErrNoTunnel, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/oauth2/jwt"
+)
+
+// RotatingEmailTunnel sends pokes from several gmail addresses in turn,
+// spreading volume across them. The address used is recorded as MetaSender.
+type RotatingEmailTunnel struct {
+	tunnels []GMailTunnel
+	next    uint64
+}
+
+// NewRotatingEmailTunnel returns a RotatingEmailTunnel sending from senders, round-robin.
+// Each sender is a domain-delegated subject of base, and is checked as NewGMailTunnel does.
+func NewRotatingEmailTunnel(ctx context.Context, senders []string, base *jwt.Config, opts ...TunnelOption) (*RotatingEmailTunnel, error) {
+	if len(senders) == 0 {
+		return nil, errors.New("rotating email tunnel needs a sender")
+	}
+	t := &RotatingEmailTunnel{}
+	for _, sender := range senders {
+		gt, err := NewGMailTunnel(ctx, sender, base, opts...)
+		if err != nil {
+			return nil, err
+		}
+		t.tunnels = append(t.tunnels, gt)
+	}
+	return t, nil
+}
+
+// Type is a method of Tunnel interface
+func (*RotatingEmailTunnel) Type() string { return TypeEmail }
+
+// ID is a method of Tunnel interface. It is the comma separated senders.
+func (t *RotatingEmailTunnel) ID() string {
+	ids := make([]string, 0, len(t.tunnels))
+	for _, gt := range t.tunnels {
+		ids = append(ids, gt.ID())
+	}
+	return strings.Join(ids, ",")
+}
+
+// describe is a method of resource interface
+func (t *RotatingEmailTunnel) describe() string {
+	return fmt.Sprintf("service/%s/tunnel/%s/id/%s", "notify", t.Type(), t.ID())
+}
+
+// Send sends p from the next sender.
+func (t *RotatingEmailTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	i := atomic.AddUint64(&t.next, 1) - 1
+	gt := t.tunnels[i%uint64(len(t.tunnels))]
+	rec, err := gt.Send(ctx, p)
+	rec.setMeta(MetaSender, gt.ID())
+	return rec, err
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sanitizer transforms a message body before sending.
+type Sanitizer func(body string) string
+
+// DefaultSanitizers strip invisible characters, collapse whitespace and trim.
+var DefaultSanitizers = []Sanitizer{StripInvisible, CollapseSpace, strings.TrimSpace}
+
+// Sanitize runs fns on body in order.
+func Sanitize(body string, fns ...Sanitizer) string {
+	for _, fn := range fns {
+		body = fn(body)
+	}
+	return body
+}
+
+// StripInvisible removes control characters other than newlines and tabs,
+// and format characters like zero-width spaces and joiners.
+// They are often pasted from a CMS and make carriers filter messages.
+func StripInvisible(body string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, body)
+}
+
+// CollapseSpace collapses runs of spaces in a line to a single space,
+// and runs of blank lines to a single blank line.
+func CollapseSpace(body string) string {
+	var b strings.Builder
+	spaces, newlines := 0, 0
+	for _, r := range body {
+		switch {
+		case r == '\n':
+			newlines++
+			spaces = 0
+		case unicode.IsSpace(r):
+			spaces++
+		default:
+			if newlines > 2 {
+				newlines = 2
+			}
+			if newlines > 0 {
+				b.WriteString(strings.Repeat("\n", newlines))
+			} else if spaces > 0 {
+				b.WriteByte(' ')
+			}
+			spaces, newlines = 0, 0
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// gsmTransliterations are GSM safe equivalents of common characters outside GSM 03.38.
+var gsmTransliterations = map[rune]string{
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '‹': "'", '›': "'", '´': "'", '`': "'",
+	'“': "\"", '”': "\"", '„': "\"", '‟': "\"", '«': "\"", '»': "\"",
+	'–': "-", '—': "-", '―': "-", '‐': "-", '‑': "-", '−': "-",
+	'…': "...", '•': "*", '\t': " ", '\u00a0': " ", '\u2009': " ",
+	'á': "a", 'â': "a", 'ã': "a", 'ā': "a", 'ą': "a", 'ç': "c", 'č': "c", 'ć': "c",
+	'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e", 'í': "i", 'î': "i", 'ï': "i",
+	'ł': "l", 'ń': "n", 'ó': "o", 'ô': "o", 'õ': "o", 'ő': "ö", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ú': "u", 'û': "u", 'ű': "ü", 'ů': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ā': "A", 'Ą': "A", 'Č': "C", 'Ć': "C",
+	'È': "E", 'Ê': "E", 'Ë': "E", 'Ę': "E", 'Ě': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ł': "L", 'Ń': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ő': "Ö", 'Œ': "OE",
+	'Ř': "R", 'Ś': "S", 'Š': "S", 'Ù': "U", 'Ú': "U", 'Û': "U", 'Ű': "Ü", 'Ů': "U",
+	'Ý': "Y", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+}
+
+// Transliterate replaces common characters outside GSM 03.38, like curly quotes, dashes and
+// accented letters, with GSM safe equivalents, so a body is not sent as UCS-2.
+// changed reports whether any character was replaced. Characters without an equivalent are kept.
+func Transliterate(body string) (translit string, changed bool) {
+	var b strings.Builder
+	for _, r := range body {
+		if gsmChar(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if s, ok := gsmTransliterations[r]; ok {
+			b.WriteString(s)
+			changed = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if !changed {
+		return body, false
+	}
+	return b.String(), true
+}
+
+// gsmChar reports whether r is a GSM 03.38 character.
+func gsmChar(r rune) bool {
+	return strings.ContainsRune(gsmBasic, r) || strings.ContainsRune(gsmExtended, r)
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+)
+
+// twilio accepts messages scheduled this far ahead
+const (
+	minScheduleAhead = 15 * time.Minute
+	maxScheduleAhead = 7 * 24 * time.Hour
+)
+
+// scheduled reports whether t schedules p at twilio rather than sending it now.
+// It errors if p is due too early or too late for twilio to schedule.
+// Pokes listed by a Dispatcher run are due already, so only SendNow, or a caller of Send,
+// schedules at twilio; see WithMessagingService.
+func (t SMSTunnel) scheduled(p *Poke) (bool, error) {
+	if t.opts.messagingService == "" || !p.DateToSend.After(time.Now()) {
+		return false, nil
+	}
+	ahead := time.Until(p.DateToSend)
+	if ahead < minScheduleAhead || ahead > maxScheduleAhead {
+		return false, fmt.Errorf("%w: twilio schedules 15 minutes to 7 days ahead, %s is %s ahead",
+			ErrInvalidPoke, p.ID, ahead.Round(time.Second))
+	}
+	return true, nil
+}
+
+// schedule sends a message of body to to through the messaging service of t at sendAt.
+func (t SMSTunnel) schedule(ctx context.Context, to, body, mediaURL, callbackURL string, sendAt time.Time) (*twilio.SmsResponse, *twilio.Exception, time.Duration, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	form.Set("MessagingServiceSid", t.opts.messagingService)
+	form.Set("ScheduleType", "fixed")
+	form.Set("SendAt", sendAt.UTC().Format(time.RFC3339))
+	if mediaURL != "" {
+		form.Set("MediaUrl", mediaURL)
+	}
+	if callbackURL != "" {
+		form.Set("StatusCallback", callbackURL)
+	}
+
+	return t.twilioMessage(ctx, http.MethodPost, "", form)
+}
+
+// sendMessage sends a message of body to to from t, through the twilio message list.
+// Unlike gotwilio SendSMS, the Retry-After of a refused message is returned, and no ApplicationSid
+// is posted, which would make twilio ignore StatusCallback.
+func (t SMSTunnel) sendMessage(ctx context.Context, to, body, mediaURL, callbackURL string) (*twilio.SmsResponse, *twilio.Exception, time.Duration, error) {
+	form := url.Values{}
+	form.Set("From", t.ID())
+	form.Set("To", to)
+	form.Set("Body", body)
+	if mediaURL != "" {
+		form.Set("MediaUrl", mediaURL)
+	}
+	if callbackURL != "" {
+		form.Set("StatusCallback", callbackURL)
+	}
+
+	return t.twilioMessage(ctx, http.MethodPost, "", form)
+}
+
+// twilioMessage makes a request to the twilio message resource sid, or the message list
+// if sid is empty, and returns the message responded. gotwilio lacks some of the api.
+func (t SMSTunnel) twilioMessage(ctx context.Context, method, sid string, form url.Values) (*twilio.SmsResponse, *twilio.Exception, time.Duration, error) {
+	u := t.c.BaseUrl + "/Accounts/" + t.c.AccountSid + "/Messages"
+	if sid != "" {
+		u += "/" + url.PathEscape(sid)
+	}
+	u += ".json"
+	sms := new(twilio.SmsResponse)
+	ex, wait, err := t.twilioRequest(ctx, method, u, form, sms)
+	if ex != nil || err != nil {
+		return nil, ex, wait, err
+	}
+	return sms, nil, 0, nil
+}
+
+// twilioRequest makes a request to the twilio api url u, posting form if not nil,
+// and decodes the response to v. Twilio errors are returned as an exception,
+// with the wait of the Retry-After header if twilio tells when to retry, e.g. rate limited.
+func (t SMSTunnel) twilioRequest(ctx context.Context, method, u string, form url.Values, v interface{}) (*twilio.Exception, time.Duration, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if t.c.APIKeySid != "" {
+		req.SetBasicAuth(t.c.APIKeySid, t.c.APIKeySecret)
+	} else {
+		req.SetBasicAuth(t.c.AccountSid, t.c.AuthToken)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	client := t.c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		ex := new(twilio.Exception)
+		if err := json.Unmarshal(bs, ex); err != nil {
+			return nil, 0, fmt.Errorf("twilio: %s", resp.Status)
+		}
+		return ex, retryAfter(resp.Header), nil
+	}
+	return nil, 0, json.Unmarshal(bs, v)
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// test message of SendTest
+const (
+	testSubject = "notify test message"
+	testBody    = "This is a test message from notify. If you receive it, the tunnel works."
+)
+
+// SendTest sends a canned test message to to through t. Nothing is written to a PokeStore.
+// It is meant to verify tunnel configuration, e.g. after rotating credentials.
+// Note a LogWrapper still records what it sends.
+func SendTest(ctx context.Context, t Tunnel, to string) (Record, error) {
+	now := time.Now()
+	p := &Poke{
+		Tunnel:     t.Type(),
+		To:         to,
+		Subject:    testSubject,
+		Body:       testBody,
+		DateToSend: now,
+		Expiry:     now.Add(time.Hour),
+	}
+	return t.Send(ctx, p)
+}
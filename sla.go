@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// slaDeadlineField is the field of poke documents the SLA of a poke ends at, see Poke.SLA.
+// Firestore can not add the SLA to the date to send in a query, so the store writes the sum.
+const slaDeadlineField = "sla_deadline"
+
+// slaEventID is the record event ID of SLA breaches, so a breach is recorded once per poke.
+const slaEventID = "sla_breach"
+
+// slaDeadline returns when the SLA of p ends, counting from now for a poke without a date to send.
+func slaDeadline(p *Poke, now time.Time) time.Time {
+	if p.DateToSend.IsZero() {
+		return now.Add(p.SLA)
+	}
+	return p.DateToSend.Add(p.SLA)
+}
+
+// ListSLABreaches lists queuing pokes whose SLA has passed without a delivered record,
+// at most 1000 pokes, or the limit set by WithListLimit, most overdue first.
+// A breach is recorded once per poke, as a record of StatusSLABreached, when it is first listed.
+// The query needs an index of sla_deadline; pokes without an SLA are not in it.
+func (s *firePokeStore) ListSLABreaches(ctx context.Context) ([]*Poke, error) {
+	start := time.Now()
+	q, err := s.scope(ctx, s.pokeQuery().
+		Where(slaDeadlineField, "<", start).
+		OrderBy(slaDeadlineField, firestore.Asc))
+	if err == nil && s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
+	var pokes []*Poke
+	if err == nil {
+		pokes, err = s.pokesFromDocs(docs, "list_sla_breaches")
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_sla_breaches",
+			"",
+		}
+	}
+	if len(pokes) == 0 {
+		return pokes, nil
+	}
+
+	ids := make([]string, len(pokes))
+	for i, p := range pokes {
+		ids[i] = p.ID
+	}
+	recs, err := s.GetRecords(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	breaches := pokes[:0]
+	var breachRecs []Record
+	for _, p := range pokes {
+		var delivered, recorded bool
+		for _, r := range recs[p.ID] {
+			switch {
+			case r.Status == StatusDelivered:
+				delivered = true
+			case r.Status == StatusSLABreached:
+				recorded = true
+			}
+		}
+		if delivered {
+			continue
+		}
+		breaches = append(breaches, p)
+		if !recorded {
+			rec := Record{MessageID: p.ID, Status: StatusSLABreached, TimeStamp: start}
+			rec.setMeta(MetaEventID, slaEventID)
+			rec.setMeta(MetaReason, fmt.Sprintf("not delivered within %s", p.SLA))
+			breachRecs = append(breachRecs, withPokeMetadata(rec, p))
+		}
+	}
+	if len(breachRecs) > 0 {
+		if _, err := s.CreateRecords(ctx, breachRecs...); err != nil {
+			return nil, err
+		}
+	}
+	return breaches, nil
+}
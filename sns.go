@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are credentials of an AWS IAM identity.
+// SessionToken is needed only for temporary credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// SNSTunnel sends pokes by Amazon SNS. Pokes to a topic ARN are published to the topic,
+// with their subject; pokes to others are sent as SMS, to the phone number To.
+// It calls the SNS query api signed by AWS signature version 4, without the AWS SDK.
+type SNSTunnel struct {
+	region string
+	creds  AWSCredentials
+	opts   tunnelOptions
+}
+
+// NewSNSTunnel returns an SNSTunnel of SNS in region, e.g. "us-east-1".
+// Phone numbers without a country code are of the region set by WithDefaultRegion.
+func NewSNSTunnel(region string, creds AWSCredentials, opts ...TunnelOption) *SNSTunnel {
+	t := &SNSTunnel{region: region, creds: creds}
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	return t
+}
+
+// Type is a method of Tunnel interface
+func (SNSTunnel) Type() string { return TypeSNS }
+
+// ID is a method of Tunnel interface. It is the access key ID.
+func (t SNSTunnel) ID() string { return t.creds.AccessKeyID }
+
+// describe is a method of resource interface
+func (t SNSTunnel) describe() string {
+	return fmt.Sprintf("service/%s/tunnel/%s/id/%s", "notify", t.Type(), t.ID())
+}
+
+// snsResponse is a response of the SNS query api, successful or not
+type snsResponse struct {
+	MessageID string `xml:"PublishResult>MessageId"`
+	Error     struct {
+		Type    string `xml:"Type"` // Sender or Receiver
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// Send sends a poke through the SNS Publish action.
+func (t SNSTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t SNSTunnel) send(ctx context.Context, p *Poke) (Record, error) {
+	rec := Record{MessageID: p.ID}
+
+	form := url.Values{}
+	form.Set("Action", "Publish")
+	form.Set("Version", "2010-03-31")
+	form.Set("Message", p.Body)
+	if strings.HasPrefix(p.To, "arn:") {
+		form.Set("TopicArn", p.To)
+		if p.Subject != "" {
+			form.Set("Subject", p.Subject)
+		}
+	} else {
+		to, err := NormalizePhone(p.To, t.opts.region)
+		if err != nil {
+			rec.TimeStamp = time.Now()
+			rec.Status = StatusError
+			return rec, err
+		}
+		form.Set("PhoneNumber", to)
+	}
+	body := form.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, "https://sns."+t.region+".amazonaws.com/", strings.NewReader(body))
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, fmt.Errorf("sns: invalid region %q", t.region)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, body, t.creds, t.region, "sns", time.Now())
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	rec.TimeStamp = time.Now()
+	if err != nil {
+		rec.Status = StatusError
+		return rec, fmt.Errorf("sns: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var sr snsResponse
+	bs, err := io.ReadAll(resp.Body)
+	if err == nil {
+		err = xml.Unmarshal(bs, &sr)
+	}
+	if err != nil {
+		rec.Status = StatusError
+		return rec, fmt.Errorf("sns: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode >= 300 {
+		rec.Status, err = snsError(resp, sr)
+		return rec, err
+	}
+	rec.Status = StatusQueued // SNS accepts messages, delivery is not reported back
+	rec.setMeta(MetaProviderID, sr.MessageID)
+	return rec, nil
+}
+
+// snsError returns the status and the error of a failed SNS response, like twilioErrorStatus:
+// throttling and errors of SNS itself, which may pass, are failed; requests SNS rejects,
+// like InvalidParameter of a malformed number, AuthorizationError or OptedOut, are undelivered,
+// as sending them again fails again.
+func snsError(resp *http.Response, sr snsResponse) (string, error) {
+	err := fmt.Errorf("sns error %s: %s", sr.Error.Code, sr.Error.Message)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || sr.Error.Code == "Throttling" || sr.Error.Code == "ThrottledException":
+		return StatusFailed, &RateLimitError{RetryAfter: retryAfter(resp.Header), Err: err}
+	case resp.StatusCode >= 500 || sr.Error.Type == "Receiver":
+		return StatusFailed, err
+	}
+	return StatusUndelivered, err
+}
+
+// signV4 signs req with body by AWS signature version 4, for service in region at t.
+func signV4(req *http.Request, body string, creds AWSCredentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// headers signed, sorted by name
+	headers := []string{"content-type", "host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signed := strings.Join(headers, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		sha256Hex([]byte(body)),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonReq))
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
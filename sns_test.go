@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// the example of the AWS signature version 4 docs, signing a request to IAM
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, "", creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s, want 20150830T123600Z", got)
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://sns.us-east-1.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+	signV4(req, "Action=Publish", creds, "us-east-1", "sns", time.Now())
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %q, want token", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("session token not signed: %s", got)
+	}
+}
+
+func TestSNSError(t *testing.T) {
+	tests := []struct {
+		code          int
+		errType       string
+		errCode       string
+		wantStatus    string
+		wantRateLimit bool
+	}{
+		{400, "Sender", "InvalidParameter", StatusUndelivered, false},
+		{403, "Sender", "AuthorizationError", StatusUndelivered, false},
+		{400, "Sender", "OptedOut", StatusUndelivered, false},
+		{404, "Sender", "NotFound", StatusUndelivered, false},
+		{400, "Sender", "Throttling", StatusFailed, true},
+		{429, "Sender", "ThrottledException", StatusFailed, true},
+		{500, "Receiver", "InternalError", StatusFailed, false},
+		{503, "Receiver", "ServiceUnavailable", StatusFailed, false},
+		{400, "Receiver", "KMSThrottling", StatusFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.errCode, func(t *testing.T) {
+			var sr snsResponse
+			sr.Error.Type = tt.errType
+			sr.Error.Code = tt.errCode
+			status, err := snsError(&http.Response{StatusCode: tt.code, Header: http.Header{}}, sr)
+			if err == nil {
+				t.Fatal("snsError returned no error")
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+			if got := errors.Is(err, ErrRateLimited); got != tt.wantRateLimit {
+				t.Errorf("rate limited = %v, want %v", got, tt.wantRateLimit)
+			}
+			if got, want := transientSend(status, err), tt.wantStatus == StatusFailed; got != want {
+				t.Errorf("transientSend = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -2,27 +2,73 @@ package notify
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ErrNotFound is matched by store errors of missing pokes, e.g. errors.Is(err, ErrNotFound)
+var ErrNotFound = errors.New("notify: not found")
+
 // PokeStore handles with Poke, Record of Poke, arnd archived
 type PokeStore interface {
 	Create(c context.Context, p *Poke) (*Poke, error)
 	Delete(c context.Context, IDs ...string) error
+	DeleteBestEffort(c context.Context, IDs ...string) ([]string, map[string]error)
 	Update(c context.Context, p *Poke) (*Poke, error)
 	Get(c context.Context, IDs ...string) ([]*Poke, error)
+	GetAt(c context.Context, readTime time.Time, IDs ...string) ([]*Poke, error)
+	Reschedule(c context.Context, id string, nextAttempt time.Time) error
 
 	ListToSend(c context.Context) ([]*Poke, error)
+	ListToSendSummary(c context.Context) ([]PokeSummary, error)
+	StreamToSend(c context.Context) (<-chan *Poke, <-chan error)
+	Watch(c context.Context) (<-chan *Poke, <-chan error)
+	ClaimToSend(c context.Context, workerID string, lease time.Duration, limit int) ([]*Poke, error)
 	ListExpired(c context.Context) ([]*Poke, error)
+	ListByMetadata(c context.Context, key, value string, limit int) ([]*Poke, error)
+	ListByOwner(c context.Context, uid string) ([]*Poke, error)
+	ListScheduledBetween(c context.Context, from, to time.Time, limit int) ([]*Poke, error)
+	ListSLABreaches(c context.Context) ([]*Poke, error)
+	CancelByRecipient(c context.Context, to string) (int, error)
+	CountPending(c context.Context) (int, error)
+	MigrateDueFields(c context.Context) (int, error)
+	ExportByRecipient(c context.Context, to string) (RecipientExport, error)
 
 	CreateRecord(c context.Context, r Record) (Record, error)
+	CreateRecords(c context.Context, recs ...Record) ([]Record, error)
 	GetRecord(c context.Context, messageID string) ([]*Record, error)
+	GetRecords(c context.Context, messageIDs ...string) (map[string][]*Record, error)
+	GetRecordsByProviderID(c context.Context, providerIDs ...string) (map[string][]*Record, error)
+	LatestRecord(c context.Context, messageID string) (*Record, error)
+	CompactRecords(c context.Context, messageID string) error
+	RecordStats(c context.Context, from, to time.Time) (map[string]map[string]int, error)
+	SumCost(c context.Context, from, to time.Time, tenant string) (float64, error)
+	UpdateCost(c context.Context, messageID string, cost float64, currency string) error
+	CampaignStatus(c context.Context, campaign string) (CampaignStats, error)
 
 	Archive(c context.Context, id string) (*ArchivedPoke, error)
+	DeadLetter(c context.Context, id, reason string) (*ArchivedPoke, error)
+	CompleteSend(c context.Context, id string, rec Record) (*ArchivedPoke, error)
+	ArchiveBatch(c context.Context, IDs ...string) ([]*ArchivedPoke, error)
+	ListArchivedBefore(c context.Context, before time.Time, limit int) ([]*ArchivedPoke, error)
+	ListDeadLettered(c context.Context) ([]*ArchivedPoke, error)
+	ListByRecipient(c context.Context, to string, limit int) ([]*ArchivedPoke, error)
 	DeleteArchived(c context.Context, IDs ...string) error
 }
 
@@ -31,8 +77,36 @@ type firePokeStore struct {
 	pokeCol    *firestore.CollectionRef
 	recCol     *firestore.CollectionRef
 	archiveCol *firestore.CollectionRef
+
+	logger     *slog.Logger
+	retainBody bool
+	idGen      IDGenerator
+	tracer     trace.Tracer
+	listLimit  int
+	fields     FieldMap
+
+	group string // collection ID of pokes, if pokes are in a collection group
+
+	jitter             time.Duration
+	defaultExpiry      time.Duration
+	defaultMaxAttempts int
+
+	sink EventSink
+
+	tenants bool // isolates tenants, see WithTenantIsolation
+
+	readRetries int
+	readBackoff time.Duration
+
+	recBatch *recordBatcher  // batches CreateRecord, see WithRecordBatching
+	backlog  *backlogCounter // see WithMaxBacklog
+
+	migration dueMigration // see migrateDue
 }
 
+// defaultListLimit is the max number of pokes listed by ListToSend and ListExpired
+const defaultListLimit = 1000
+
 // firePokeStoreErr is an error
 type firePokeStoreErr struct {
 	storeErr error
@@ -45,8 +119,16 @@ func (e firePokeStoreErr) Error() string {
 	return fmt.Sprintf("%s %s: %v at %s", e.storeType(), e.errFunc, e.storeErr, e.where)
 }
 
+// Unwrap returns the underlying error
+func (e firePokeStoreErr) Unwrap() error { return e.storeErr }
+
+// Is makes firestore not found errors match ErrNotFound
+func (e firePokeStoreErr) Is(target error) bool {
+	return target == ErrNotFound && status.Code(e.storeErr) == codes.NotFound
+}
+
 // NewFirePokeStore returns a firePokeStore, which is a PokeStore
-func NewFirePokeStore(c *firestore.Client, pokeCol, recCol, arcCol string) (PokeStore, error) {
+func NewFirePokeStore(c *firestore.Client, pokeCol, recCol, arcCol string, opts ...StoreOption) (PokeStore, error) {
 	if c == nil {
 		return nil, firePokeStoreErr{
 			fmt.Errorf("not created"),
@@ -54,17 +136,88 @@ func NewFirePokeStore(c *firestore.Client, pokeCol, recCol, arcCol string) (Poke
 			"initialize",
 		}
 	}
-	return &firePokeStore{
-		c,
-		c.Collection(pokeCol),
-		c.Collection(recCol),
-		c.Collection(arcCol),
-	}, nil
+	s := &firePokeStore{
+		c:          c,
+		pokeCol:    c.Collection(pokeCol),
+		recCol:     c.Collection(recCol),
+		archiveCol: c.Collection(arcCol),
+		logger:     slog.Default(),
+		listLimit:  defaultListLimit,
+		fields:     DefaultFieldMap,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.tracer != nil {
+		return &tracedStore{s: s, tracer: s.tracer}, nil
+	}
+	return s, nil
 }
 
-// Create creates a Poke and gives it a ID
+// databaseIDRe is the format of firestore database IDs, besides "(default)"
+var databaseIDRe = regexp.MustCompile(`^[a-z][a-z0-9-]{2,61}[a-z0-9]$`)
+
+// NewFirePokeStoreWithDatabase returns a PokeStore in the firestore database databaseID of projectID.
+// It lets tenants or environments be isolated in their own databases of a project.
+// clientOpts are given to firestore.NewClientWithDatabase.
+func NewFirePokeStoreWithDatabase(ctx context.Context, projectID, databaseID, pokeCol, recCol, arcCol string,
+	clientOpts []option.ClientOption, opts ...StoreOption) (PokeStore, error) {
+	if databaseID != firestore.DefaultDatabaseID && !databaseIDRe.MatchString(databaseID) {
+		return nil, firePokeStoreErr{
+			fmt.Errorf("invalid database ID %q", databaseID),
+			"newfirepokestore",
+			"initialize",
+		}
+	}
+	c, err := firestore.NewClientWithDatabase(ctx, projectID, databaseID, clientOpts...)
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"newfirepokestore",
+			"initialize",
+		}
+	}
+	return NewFirePokeStore(c, pokeCol, recCol, arcCol, opts...)
+}
+
+// logOp logs a store operation. Failed operations are logged at error level.
+func (s *firePokeStore) logOp(ctx context.Context, op string, start time.Time, err error, attrs ...slog.Attr) {
+	attrs = append(attrs,
+		slog.String("store_op", op),
+		slog.Duration("duration", time.Since(start)),
+	)
+	if err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelError, "store operation failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	s.logger.LogAttrs(ctx, slog.LevelDebug, "store operation", attrs...)
+}
+
+// newDoc returns a new document of col with id.
+// An empty id is generated by the IDGenerator, or by firestore if there is none.
+func (s *firePokeStore) newDoc(col *firestore.CollectionRef, id string) *firestore.DocumentRef {
+	if id == "" && s.idGen != nil {
+		id = s.idGen.Generate()
+	}
+	if id == "" {
+		return col.NewDoc()
+	}
+	return col.Doc(id)
+}
+
+// Create creates a Poke and gives it a ID, unless p has one.
 func (s *firePokeStore) Create(c context.Context, p *Poke) (*Poke, error) {
-	docRef, _, err := s.pokeCol.Add(c, p)
+	start := time.Now()
+	tenant, err := s.tenant(c)
+	if err == nil && tenant != "" {
+		if p.TenantID != "" && p.TenantID != tenant {
+			err = fmt.Errorf("%w: poke of tenant %s", ErrInvalidPoke, p.TenantID)
+		}
+		p.TenantID = tenant
+	}
+	if err == nil {
+		err = s.checkBacklog(c)
+	}
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
@@ -72,42 +225,254 @@ func (s *firePokeStore) Create(c context.Context, p *Poke) (*Poke, error) {
 			p.ID,
 		}
 	}
-	p.ID = docRef.ID
+	s.applyDefaultExpiry(p)
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = s.defaultMaxAttempts
+	}
+	s.applyJitter(p)
+	docRef := s.newPokeRef(p.ID)
+	_, err = docRef.Create(c, s.pokeData(p))
+	if err != nil {
+		s.logOp(c, "create", start, err, slog.String("tunnel_type", p.Tunnel))
+		return nil, firePokeStoreErr{
+			err,
+			"create",
+			p.ID,
+		}
+	}
+	p.ID = s.idOf(docRef)
+	s.countCreated(c)
+	s.logOp(c, "create", start, nil, slog.String("poke_id", p.ID), slog.String("tunnel_type", p.Tunnel))
+	s.emit(c, PokeCreated, p.ID)
 	return p, nil
 }
 
+// CreateNow creates p to be sent as soon as possible, by a zero date to send.
+// Unlike a date to send of time.Now(), a zero date is due at once to every dispatcher,
+// whatever the clock skew between their clock and the one of the producer.
+func CreateNow(ctx context.Context, s PokeStore, p *Poke) (*Poke, error) {
+	p.DateToSend = time.Time{}
+	return s.Create(ctx, p)
+}
+
+// applyDefaultExpiry gives p the default expiry of s after its date to send, if p has none.
+func (s *firePokeStore) applyDefaultExpiry(p *Poke) {
+	if s.defaultExpiry <= 0 || !p.Expiry.IsZero() {
+		return
+	}
+	from := p.DateToSend
+	if from.IsZero() {
+		from = time.Now()
+	}
+	p.Expiry = from.Add(s.defaultExpiry)
+}
+
+// applyJitter puts off p by a random duration within the jitter window,
+// but not past its expiry. A zero date to send is put off from now.
+func (s *firePokeStore) applyJitter(p *Poke) {
+	if s.jitter <= 0 {
+		return
+	}
+	if p.DateToSend.IsZero() {
+		p.DateToSend = time.Now()
+	}
+	window := s.jitter
+	if !p.Expiry.IsZero() {
+		if left := p.Expiry.Sub(p.DateToSend); left < window {
+			window = left
+		}
+	}
+	if window <= 0 {
+		return
+	}
+	p.DateToSend = p.DateToSend.Add(time.Duration(rand.Int63n(int64(window))))
+}
+
 // Delete deletes pokes with specified IDs. Mean to cancel a queuing poke
+// Pokes are deleted in batches of 500. If some fail, the others are still deleted,
+// and the error wraps a *DeleteError listing the failed IDs.
 func (s *firePokeStore) Delete(ctx context.Context, IDs ...string) error {
-	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		var err error
-		for _, id := range IDs {
-			err = tx.Delete(s.pokeCol.Doc(id))
-			if err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-	if err != nil {
+	start := time.Now()
+	deleted, failed := s.deleteDocs(ctx, s.pokeRef, IDs)
+	de := deleteErr(failed)
+	var err error
+	if de != nil {
+		err = de
+	}
+	s.logOp(ctx, "delete", start, err, slog.String("poke_id", strings.Join(IDs, ",")))
+	s.emit(ctx, PokeDeleted, deleted...)
+	if de != nil {
 		return firePokeStoreErr{
-			err,
+			de,
 			"delete",
-			strings.Join(IDs, ","),
+			strings.Join(de.IDs(), ","),
 		}
 	}
 	return nil
 }
 
+// DeleteBestEffort deletes pokes, going on when some fail.
+// It returns IDs deleted, and errors of IDs failed.
+func (s *firePokeStore) DeleteBestEffort(ctx context.Context, IDs ...string) ([]string, map[string]error) {
+	start := time.Now()
+	deleted, failed := s.deleteDocs(ctx, s.pokeRef, IDs)
+	var err error
+	if de := deleteErr(failed); de != nil {
+		err = de
+	}
+	s.logOp(ctx, "delete_best_effort", start, err, slog.Int("deleted", len(deleted)), slog.Int("failed", len(failed)))
+	s.emit(ctx, PokeDeleted, deleted...)
+	return deleted, failed
+}
+
+// DeleteError is the error of a delete failed for some IDs. Other IDs are deleted.
+type DeleteError struct {
+	Failed map[string]error
+}
+
+// deleteErr returns a DeleteError of failed, or nil if nothing failed.
+func deleteErr(failed map[string]error) *DeleteError {
+	if len(failed) == 0 {
+		return nil
+	}
+	return &DeleteError{Failed: failed}
+}
+
+// IDs returns the failed IDs, sorted.
+func (e *DeleteError) IDs() []string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e *DeleteError) Error() string {
+	return fmt.Sprintf("delete failed for %d IDs: %s", len(e.Failed), strings.Join(e.IDs(), ","))
+}
+
+// Unwrap returns the errors of the failed IDs
+func (e *DeleteError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, id := range e.IDs() {
+		errs = append(errs, e.Failed[id])
+	}
+	return errs
+}
+
+// deleteDocs deletes documents of IDs, given by docRef, in transactions of 500.
+// When a transaction fails, its documents are deleted one by one to tell which fail.
+// A single document is deleted without a transaction.
+func (s *firePokeStore) deleteDocs(ctx context.Context, docRef func(id string) *firestore.DocumentRef, IDs []string) ([]string, map[string]error) {
+	deleted := make([]string, 0, len(IDs))
+	failed := make(map[string]error)
+	for i := 0; i < len(IDs); i += maxTxWrites {
+		end := i + maxTxWrites
+		if end > len(IDs) {
+			end = len(IDs)
+		}
+
+		var ids []string
+		var refs []*firestore.DocumentRef
+		for _, id := range IDs[i:end] {
+			ref := docRef(id)
+			if id == "" || ref == nil {
+				failed[id] = fmt.Errorf("invalid document ID %q", id)
+				continue
+			}
+			ids = append(ids, id)
+			refs = append(refs, ref)
+		}
+		ids, refs = s.ownRefs(ctx, ids, refs, failed)
+		if len(refs) == 0 {
+			continue
+		}
+		if len(refs) == 1 {
+			// a single delete has nothing to make atomic; skip the round trips of a transaction
+			if _, err := refs[0].Delete(ctx); err != nil {
+				failed[ids[0]] = err
+				continue
+			}
+			deleted = append(deleted, ids[0])
+			continue
+		}
+
+		err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			for _, ref := range refs {
+				if err := tx.Delete(ref); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			deleted = append(deleted, ids...)
+			continue
+		}
+		for j, ref := range refs {
+			if _, err := ref.Delete(ctx); err != nil {
+				failed[ids[j]] = err
+				continue
+			}
+			deleted = append(deleted, ids[j])
+		}
+	}
+	return deleted, failed
+}
+
+// ownRefs returns ids and refs of documents of the tenant of ctx.
+// Others are put in failed, with the error of checking them.
+func (s *firePokeStore) ownRefs(ctx context.Context, ids []string, refs []*firestore.DocumentRef, failed map[string]error) ([]string, []*firestore.DocumentRef) {
+	tenant, err := s.tenant(ctx)
+	if err == nil && tenant == "" {
+		return ids, refs
+	}
+	var snaps []*firestore.DocumentSnapshot
+	if err == nil {
+		snaps, err = s.getDocs(ctx, refs)
+	}
+	if err != nil {
+		for _, id := range ids {
+			failed[id] = err
+		}
+		return nil, nil
+	}
+	var ownIDs []string
+	var own []*firestore.DocumentRef
+	for j, d := range snaps {
+		if err := checkTenant(d, tenant); err != nil {
+			failed[ids[j]] = err
+			continue
+		}
+		ownIDs = append(ownIDs, ids[j])
+		own = append(own, refs[j])
+	}
+	return ownIDs, own
+}
+
 // Update updates a existing poke.
 func (s *firePokeStore) Update(ctx context.Context, p *Poke) (*Poke, error) {
-	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		ref := s.pokeCol.Doc(p.ID)
-		// This error includes not found error
-		if _, err := tx.Get(ref); err != nil {
-			return err
-		}
-		return tx.Set(ref, p)
-	})
+	start := time.Now()
+	tenant, err := s.tenant(ctx)
+	if err == nil {
+		err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			ref := s.pokeRef(p.ID)
+			// This error includes not found error
+			d, err := tx.Get(ref)
+			if err != nil {
+				return err
+			}
+			if err := checkTenant(d, tenant); err != nil {
+				return err
+			}
+			if tenant != "" {
+				p.TenantID = tenant
+			}
+			return tx.Set(ref, s.pokeData(p))
+		})
+	}
+	s.logOp(ctx, "update", start, err, slog.String("poke_id", p.ID))
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
@@ -115,42 +480,143 @@ func (s *firePokeStore) Update(ctx context.Context, p *Poke) (*Poke, error) {
 			p.ID,
 		}
 	}
+	s.emit(ctx, PokeUpdated, p.ID)
 	return p, nil
 }
 
 // Get returns []*Pokes
 func (s *firePokeStore) Get(ctx context.Context, IDs ...string) ([]*Poke, error) {
+	return s.get(ctx, "get", time.Time{}, IDs)
+}
+
+// GetAt gets pokes as they were at readTime, for consistent snapshots like reports,
+// without contending with writes of the dispatcher.
+// Firestore keeps versions for an hour, or 7 days with point-in-time recovery;
+// readTime older than one minute must be a whole minute.
+func (s *firePokeStore) GetAt(ctx context.Context, readTime time.Time, IDs ...string) ([]*Poke, error) {
+	return s.get(ctx, "get_at", readTime, IDs)
+}
+
+// get gets pokes at readTime, or the latest if readTime is zero.
+func (s *firePokeStore) get(ctx context.Context, op string, readTime time.Time, IDs []string) ([]*Poke, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			op,
+			strings.Join(IDs, ","),
+		}
+	}
 	pokes := make([]*Poke, 0, len(IDs))
 	for _, id := range IDs {
-		d, err := s.pokeCol.Doc(id).Get(ctx)
+		ref := s.pokeRef(id)
+		if !readTime.IsZero() {
+			ref = ref.WithReadOptions(firestore.ReadTime(readTime))
+		}
+		d, err := s.getDoc(ctx, ref)
+		if err == nil {
+			err = checkTenant(d, tenant)
+		}
 		if err != nil {
 			return nil, firePokeStoreErr{
 				err,
-				"get",
+				op,
 				strings.Join(IDs, ","),
 			}
 		}
 		p := new(Poke)
-		err = d.DataTo(p)
+		err = s.decodePoke(d, p)
 		if err != nil {
 			return nil, firePokeStoreErr{
 				err,
-				"get",
+				op,
 				fmt.Sprintf("marshaling %s", id),
 			}
 		}
-		p.ID = d.Ref.ID
+		p.ID = s.idOf(d.Ref)
 		pokes = append(pokes, p)
 	}
 	return pokes, nil
 }
 
+// Reschedule puts off a poke to nextAttempt, counts a failed attempt of it, and releases its claim.
+func (s *firePokeStore) Reschedule(ctx context.Context, id string, nextAttempt time.Time) error {
+	start := time.Now()
+	ref := s.pokeRef(id)
+	tenant, err := s.tenant(ctx)
+	if err == nil {
+		// the poke is read for its NotBefore, which the due time must not be before
+		err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			d, err := tx.Get(ref)
+			if err != nil {
+				return err
+			}
+			if err := checkTenant(d, tenant); err != nil {
+				return err
+			}
+			p := new(Poke)
+			if err := s.decodePoke(d, p); err != nil {
+				return err
+			}
+			p.DateToSend = nextAttempt
+			updates := []firestore.Update{
+				{Path: "attempts", Value: firestore.Increment(1)},
+				{Path: s.fields.DateToSend, Value: nextAttempt},
+				{Path: "claimed_by", Value: firestore.Delete},
+				{Path: "claim_expires", Value: time.Time{}},
+			}
+			if s.fields.DueAt != s.fields.DateToSend {
+				updates = append(updates, firestore.Update{Path: s.fields.DueAt, Value: p.dueAt()})
+			}
+			return tx.Update(ref, updates)
+		})
+	}
+	s.logOp(ctx, "reschedule", start, err, slog.String("poke_id", id))
+	if err != nil {
+		return firePokeStoreErr{
+			err,
+			"reschedule",
+			id,
+		}
+	}
+	s.emit(ctx, PokeRescheduled, id)
+	return nil
+}
+
+// dueQuery returns the query of pokes due at now, oldest due first, by their due time: the date to send,
+// or the NotBefore if later, stored by Create, Update and Reschedule.
+// Pokes claimed by a worker are left out until the claim expires; unclaimed pokes have a zero claim expiry.
+// Firestore leaves out pokes stored without a due time or a claim expiry, so callers run migrateDue first.
+// Firestore orders ties by document ID after the last order, so the order is deterministic.
+// The inequalities of the due time and the claim expiry need a composite index of both, ascending,
+// of collection group scope for a collection group store.
+func (s *firePokeStore) dueQuery(ctx context.Context, now time.Time) (firestore.Query, error) {
+	return s.scope(ctx, s.pokeQuery().
+		Where(s.fields.DueAt, "<", now).
+		Where("claim_expires", "<", now).
+		OrderBy(s.fields.DueAt, firestore.Asc))
+}
+
 // ListToSend lists all pokes that can be sent, includes expired ones.
+// Pokes claimed by a worker are excluded until the claim expires, and pokes with a NotBefore until then.
+// At most 1000 pokes are listed, or the limit set by WithListLimit.
+// Pokes are listed oldest due first, ties broken by ID. A zero date to send is stored
+// as the least timestamp, so such pokes are listed first.
 func (s *firePokeStore) ListToSend(c context.Context) ([]*Poke, error) {
-	q := s.pokeCol.Where("date_to_send", "<", time.Now())
-	q = q.Limit(1000)
-	
-	docs, err := q.Documents(c).GetAll()
+	s.migrateDue(c)
+	q, err := s.dueQuery(c, time.Now())
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_to_send",
+			"",
+		}
+	}
+	if s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+
+	docs, err := s.queryDocs(c, q)
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
@@ -161,24 +627,155 @@ func (s *firePokeStore) ListToSend(c context.Context) ([]*Poke, error) {
 	pokes := make([]*Poke, 0, len(docs))
 	for _, doc := range docs {
 		p := new(Poke)
-		if err = doc.DataTo(p); err != nil {
+		if err = s.decodePoke(doc, p); err != nil {
 			return nil, firePokeStoreErr{
 				err,
 				"list_to_send",
 				doc.Ref.ID,
 			}
 		}
-		p.ID = doc.Ref.ID
+		p.ID = s.idOf(doc.Ref)
 		pokes = append(pokes, p)
 	}
 
 	return pokes, nil
 }
 
+// StreamToSend sends pokes that can be sent, one at a time, over the returned poke channel.
+// Unlike ListToSend, it is not limited, and holds one poke in memory at a time. Pokes are in the order of ListToSend.
+// Both channels are closed when all pokes are sent, ctx is done, or an error occurs;
+// an error is sent over the error channel before it is closed.
+func (s *firePokeStore) StreamToSend(c context.Context) (<-chan *Poke, <-chan error) {
+	pokes := make(chan *Poke)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(pokes)
+
+		s.migrateDue(c)
+		q, err := s.dueQuery(c, time.Now())
+		if err != nil {
+			errs <- firePokeStoreErr{
+				err,
+				"stream_to_send",
+				"",
+			}
+			return
+		}
+		iter := q.Documents(c)
+		defer iter.Stop()
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				return
+			}
+			if err != nil {
+				errs <- firePokeStoreErr{
+					err,
+					"stream_to_send",
+					"",
+				}
+				return
+			}
+			p := new(Poke)
+			if err = s.decodePoke(doc, p); err != nil {
+				errs <- firePokeStoreErr{
+					err,
+					"stream_to_send",
+					doc.Ref.ID,
+				}
+				return
+			}
+			p.ID = s.idOf(doc.Ref)
+			select {
+			case pokes <- p:
+			case <-c.Done():
+				errs <- c.Err()
+				return
+			}
+		}
+	}()
+	return pokes, errs
+}
+
+// maxTxWrites is the max number of writes of a firestore transaction
+const maxTxWrites = 500
+
+// ClaimToSend claims pokes that can be sent for workerID, and returns them.
+// A claim lasts for lease. Pokes claimed by others are skipped until their claims expire,
+// so a poke failed to be archived by a worker is retried after the lease.
+// At most limit pokes are claimed; limit <= 0 or above 500 is taken as 500. Oldest due pokes are claimed first.
+func (s *firePokeStore) ClaimToSend(ctx context.Context, workerID string, lease time.Duration, limit int) ([]*Poke, error) {
+	if limit <= 0 || limit > maxTxWrites {
+		limit = maxTxWrites
+	}
+	s.migrateDue(ctx)
+	start := time.Now()
+	var pokes []*Poke
+	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// a transaction may be retried
+		pokes = nil
+		now := time.Now()
+		expires := now.Add(lease)
+
+		q, err := s.dueQuery(ctx, now)
+		if err != nil {
+			return err
+		}
+		docs, err := tx.Documents(q.Limit(limit)).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, d := range docs {
+			p := new(Poke)
+			if err := s.decodePoke(d, p); err != nil {
+				return err
+			}
+			p.ID = s.idOf(d.Ref)
+			p.ClaimedBy = workerID
+			p.ClaimExpires = expires
+			err = tx.Update(d.Ref, []firestore.Update{
+				{Path: "claimed_by", Value: workerID},
+				{Path: "claim_expires", Value: expires},
+			})
+			if err != nil {
+				return err
+			}
+			pokes = append(pokes, p)
+		}
+		return nil
+	})
+	s.logOp(ctx, "claim_to_send", start, err, slog.String("worker_id", workerID), slog.Int("claimed", len(pokes)))
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"claim_to_send",
+			workerID,
+		}
+	}
+	for _, p := range pokes {
+		s.emit(ctx, PokeClaimed, p.ID)
+	}
+	return pokes, nil
+}
+
+// ListExpired lists expired pokes. At most 1000 pokes are listed, or the limit set by WithListLimit.
+// Pokes with a zero expiry never expire, and are not listed.
 func (s *firePokeStore) ListExpired(c context.Context) ([]*Poke, error) {
-	q := s.pokeCol.Where("expiry", "<", time.Now())
-	q = q.Limit(1000)
-	docs, err := q.Documents(c).GetAll()
+	q, err := s.scope(c, s.pokeQuery().
+		Where(s.fields.Expiry, ">", time.Time{}).
+		Where(s.fields.Expiry, "<", time.Now()))
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_expired",
+			"",
+		}
+	}
+	if s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+	docs, err := s.queryDocs(c, q)
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
@@ -190,21 +787,219 @@ func (s *firePokeStore) ListExpired(c context.Context) ([]*Poke, error) {
 
 	for _, d := range docs {
 		p := new(Poke)
-		if err := d.DataTo(p); err != nil {
+		if err := s.decodePoke(d, p); err != nil {
 			return nil, firePokeStoreErr{
 				err,
 				"list_expired",
 				d.Ref.ID,
 			}
 		}
-		p.ID = d.Ref.ID
+		p.ID = s.idOf(d.Ref)
+		pokes = append(pokes, p)
+	}
+	return pokes, nil
+}
+
+// ListByMetadata lists queuing pokes whose metadata key is value.
+// limit <= 0 means no limit.
+func (s *firePokeStore) ListByMetadata(ctx context.Context, key, value string, limit int) ([]*Poke, error) {
+	q, err := s.scope(ctx, s.pokeQuery().WherePath(firestore.FieldPath{"metadata", key}, "==", value))
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_by_metadata",
+			key + "=" + value,
+		}
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	docs, err := s.queryDocs(ctx, q)
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_by_metadata",
+			key + "=" + value,
+		}
+	}
+	return s.pokesFromDocs(docs, "list_by_metadata")
+}
+
+// ListByOwner lists queuing pokes of user uid, see Poke.OwnerUID.
+// At most 1000 pokes are listed, or the limit set by WithListLimit.
+func (s *firePokeStore) ListByOwner(ctx context.Context, uid string) ([]*Poke, error) {
+	q, err := s.scope(ctx, s.pokeQuery().Where("owner_uid", "==", uid))
+	if err == nil && s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_by_owner",
+			uid,
+		}
+	}
+	return s.pokesFromDocs(docs, "list_by_owner")
+}
+
+// ListScheduledBetween lists pokes to send from from until to, by date to send.
+// limit <= 0 means no limit.
+func (s *firePokeStore) ListScheduledBetween(ctx context.Context, from, to time.Time, limit int) ([]*Poke, error) {
+	// both range filters are on date to send, as firestore allows range filters on one field only.
+	q, err := s.scope(ctx, s.pokeQuery().
+		Where(s.fields.DateToSend, ">=", from).
+		Where(s.fields.DateToSend, "<", to).
+		OrderBy(s.fields.DateToSend, firestore.Asc))
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_scheduled_between",
+			from.String() + "-" + to.String(),
+		}
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	docs, err := s.queryDocs(ctx, q)
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_scheduled_between",
+			from.String() + "-" + to.String(),
+		}
+	}
+	return s.pokesFromDocs(docs, "list_scheduled_between")
+}
+
+// CancelByRecipient deletes all pokes to recipient to, and returns how many are deleted.
+// Phone numbers with a country code match however they are written, see recipientDocs.
+// Pokes are deleted in batches of 500; archived pokes are kept.
+// A failed batch stops it, and the pokes deleted before are counted.
+func (s *firePokeStore) CancelByRecipient(ctx context.Context, to string) (int, error) {
+	start := time.Now()
+	n := 0
+	var cancelled []string
+	var err error
+	for {
+		var docs []*firestore.DocumentSnapshot
+		docs, err = s.recipientDocs(ctx, s.pokeQuery().Select(), to, maxTxWrites)
+		if err != nil || len(docs) == 0 {
+			break
+		}
+		err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			for _, d := range docs {
+				if err := tx.Delete(d.Ref); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		n += len(docs)
+		for _, d := range docs {
+			cancelled = append(cancelled, s.idOf(d.Ref))
+		}
+		if len(docs) < maxTxWrites {
+			break
+		}
+	}
+	s.logOp(ctx, "cancel_by_recipient", start, err, slog.Int("pokes", n))
+	s.emit(ctx, PokeDeleted, cancelled...)
+	if err != nil {
+		return n, firePokeStoreErr{
+			err,
+			"cancel_by_recipient",
+			"",
+		}
+	}
+	return n, nil
+}
+
+// recipientDocs returns the documents of q to recipient to, at most limit if limit > 0.
+// Documents store to normalized, see recipientKey, so phone numbers with a country code
+// match however they are written; documents stored before are matched by to as written.
+func (s *firePokeStore) recipientDocs(ctx context.Context, q firestore.Query, to string, limit int) ([]*firestore.DocumentSnapshot, error) {
+	var docs []*firestore.DocumentSnapshot
+	seen := make(map[string]bool)
+	for _, byTo := range []firestore.Query{
+		q.Where("recipient", "==", recipientKey(to)),
+		q.Where("to", "==", to),
+	} {
+		if limit > 0 {
+			byTo = byTo.Limit(limit)
+		}
+		byTo, err := s.scope(ctx, byTo)
+		if err != nil {
+			return nil, err
+		}
+		found, err := s.queryDocs(ctx, byTo)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range found {
+			if !seen[d.Ref.Path] {
+				seen[d.Ref.Path] = true
+				docs = append(docs, d)
+			}
+		}
+	}
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+	return docs, nil
+}
+
+// pokesFromDocs unmarshals pokes from docs. errFunc names the caller in errors.
+func (s *firePokeStore) pokesFromDocs(docs []*firestore.DocumentSnapshot, errFunc string) ([]*Poke, error) {
+	pokes := make([]*Poke, 0, len(docs))
+	for _, d := range docs {
+		p := new(Poke)
+		if err := s.decodePoke(d, p); err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				errFunc,
+				d.Ref.ID,
+			}
+		}
+		p.ID = s.idOf(d.Ref)
 		pokes = append(pokes, p)
 	}
 	return pokes, nil
 }
 
+// CreateRecord creates a record, and gives it a ID, unless r has one.
+// Records of a provider event, having MetaEventID, are created once per message, status and event;
+// creating one again returns it without error.
 func (s *firePokeStore) CreateRecord(ctx context.Context, r Record) (Record, error) {
-	ref, _, err := s.recCol.Add(ctx, r)
+	if err := s.tagRecord(ctx, &r); err != nil {
+		return Record{}, err
+	}
+	if s.recBatch != nil {
+		return s.recBatch.create(ctx, r)
+	}
+	return s.createRecord(ctx, r)
+}
+
+// createRecord creates r, tagged already, on its own.
+func (s *firePokeStore) createRecord(ctx context.Context, r Record) (Record, error) {
+	start := time.Now()
+	id := r.ID
+	if id == "" && r.Metadata[MetaEventID] != "" {
+		id = eventRecordID(r)
+	}
+	ref := s.newDoc(s.recCol, id)
+	_, err := ref.Create(ctx, r)
+	if status.Code(err) == codes.AlreadyExists && id != r.ID {
+		// the event is recorded already, e.g. by a callback delivered twice
+		err = nil
+	}
+	s.logOp(ctx, "create_record", start, err, slog.String("poke_id", r.MessageID), slog.String("status", r.Status))
 	if err != nil {
 		return Record{}, err
 	}
@@ -212,9 +1007,124 @@ func (s *firePokeStore) CreateRecord(ctx context.Context, r Record) (Record, err
 	return r, nil
 }
 
+// tagRecord tags r with the tenant of ctx, if s isolates tenants.
+func (s *firePokeStore) tagRecord(ctx context.Context, r *Record) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil || tenant == "" {
+		return err
+	}
+	if r.TenantID != "" && r.TenantID != tenant {
+		return fmt.Errorf("record of tenant %s: %w", r.TenantID, errOtherTenant)
+	}
+	r.TenantID = tenant
+	return nil
+}
+
+// CreateRecords creates records in transactions of up to 500 writes.
+// Records of the same provider event are made once, as by CreateRecord.
+// If a transaction fails, records of the transactions before are created, and
+// the error tells how many are.
+func (s *firePokeStore) CreateRecords(ctx context.Context, recs ...Record) ([]Record, error) {
+	start := time.Now()
+	recs = append([]Record(nil), recs...)
+	for i := range recs {
+		if err := s.tagRecord(ctx, &recs[i]); err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				"create_records",
+				recs[i].MessageID,
+			}
+		}
+	}
+	created := make([]Record, 0, len(recs))
+	for i := 0; i < len(recs); i += maxTxWrites {
+		end := i + maxTxWrites
+		if end > len(recs) {
+			end = len(recs)
+		}
+		chunk, err := s.writeRecords(ctx, recs[i:end])
+		if err != nil {
+			s.logOp(ctx, "create_records", start, err, slog.Int("records", len(recs)))
+			return created, firePokeStoreErr{
+				err,
+				"create_records",
+				fmt.Sprintf("%d of %d records created", len(created), len(recs)),
+			}
+		}
+		created = append(created, chunk...)
+	}
+	s.logOp(ctx, "create_records", start, nil, slog.Int("records", len(recs)))
+	return created, nil
+}
+
+// writeRecords creates recs, up to 500, in a transaction, and returns them with their IDs.
+// Records of provider events recorded already are left as they are, as by createRecord,
+// keeping what was set on them since, like a cost or a history.
+func (s *firePokeStore) writeRecords(ctx context.Context, recs []Record) ([]Record, error) {
+	created := make([]Record, len(recs))
+	copy(created, recs)
+	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var events []*firestore.DocumentRef
+		recorded := make(map[string]bool)
+		for i, r := range recs {
+			if r.ID == "" && r.Metadata[MetaEventID] != "" {
+				created[i].ID = eventRecordID(r)
+				if _, ok := recorded[created[i].ID]; !ok {
+					recorded[created[i].ID] = false
+					events = append(events, s.recCol.Doc(created[i].ID))
+				}
+			}
+		}
+		// reads of a transaction come before its writes
+		if len(events) > 0 {
+			snaps, err := tx.GetAll(events)
+			if err != nil {
+				return err
+			}
+			for _, d := range snaps {
+				recorded[d.Ref.ID] = d.Exists()
+			}
+		}
+		for i, r := range recs {
+			if r.ID == "" && r.Metadata[MetaEventID] != "" {
+				id := created[i].ID
+				if recorded[id] {
+					continue
+				}
+				// an event twice in recs is created once
+				recorded[id] = true
+				if err := tx.Create(s.recCol.Doc(id), r); err != nil {
+					return err
+				}
+				continue
+			}
+			ref := s.newDoc(s.recCol, r.ID)
+			if err := tx.Create(ref, r); err != nil {
+				return err
+			}
+			created[i].ID = ref.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// eventRecordID returns the ID of the record of a provider event,
+// so an event recorded twice makes one record.
+func eventRecordID(r Record) string {
+	sum := sha256.Sum256([]byte(r.MessageID + "\x00" + r.Status + "\x00" + r.Metadata[MetaEventID]))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *firePokeStore) GetRecord(ctx context.Context, messageID string) ([]*Record, error) {
-	q := s.recCol.Where("message_id", "=", messageID)
-	docs, err := q.Documents(ctx).GetAll()
+	q, err := s.scope(ctx, s.recCol.Where("message_id", "==", messageID))
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
@@ -239,68 +1149,407 @@ func (s *firePokeStore) GetRecord(ctx context.Context, messageID string) ([]*Rec
 	return r, nil
 }
 
+// inQueryLimit is the max number of values of an "in" filter
+const inQueryLimit = 10
+
+// GetRecords returns records of messages, grouped by message ID and ordered by timestamp.
+// Message IDs are queried in chunks because of the "in" filter limit.
+func (s *firePokeStore) GetRecords(ctx context.Context, messageIDs ...string) (map[string][]*Record, error) {
+	m := make(map[string][]*Record, len(messageIDs))
+	for i := 0; i < len(messageIDs); i += inQueryLimit {
+		end := i + inQueryLimit
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		chunk := messageIDs[i:end]
+
+		q, err := s.scope(ctx, s.recCol.Where("message_id", "in", chunk))
+		var docs []*firestore.DocumentSnapshot
+		if err == nil {
+			docs, err = s.queryDocs(ctx, q)
+		}
+		if err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				"GetRecords",
+				strings.Join(chunk, ","),
+			}
+		}
+		for _, d := range docs {
+			rec := new(Record)
+			if err = d.DataTo(rec); err != nil {
+				return nil, firePokeStoreErr{
+					err,
+					"GetRecords",
+					fmt.Sprintf("unmarshal message ID = %s", d.Ref.ID),
+				}
+			}
+			rec.ID = d.Ref.ID
+			m[rec.MessageID] = append(m[rec.MessageID], rec)
+		}
+	}
+	for _, recs := range m {
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].TimeStamp.Before(recs[j].TimeStamp)
+		})
+	}
+	return m, nil
+}
+
+// GetRecordsByProviderID returns records of provider messages, as recorded in MetaProviderID,
+// grouped by provider ID and ordered by timestamp.
+func (s *firePokeStore) GetRecordsByProviderID(ctx context.Context, providerIDs ...string) (map[string][]*Record, error) {
+	m := make(map[string][]*Record, len(providerIDs))
+	for i := 0; i < len(providerIDs); i += inQueryLimit {
+		end := i + inQueryLimit
+		if end > len(providerIDs) {
+			end = len(providerIDs)
+		}
+		chunk := providerIDs[i:end]
+
+		q, err := s.scope(ctx, s.recCol.Where("metadata."+MetaProviderID, "in", chunk))
+		var docs []*firestore.DocumentSnapshot
+		if err == nil {
+			docs, err = s.queryDocs(ctx, q)
+		}
+		if err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				"GetRecordsByProviderID",
+				strings.Join(chunk, ","),
+			}
+		}
+		for _, d := range docs {
+			rec := new(Record)
+			if err = d.DataTo(rec); err != nil {
+				return nil, firePokeStoreErr{
+					err,
+					"GetRecordsByProviderID",
+					fmt.Sprintf("unmarshal record ID = %s", d.Ref.ID),
+				}
+			}
+			rec.ID = d.Ref.ID
+			pid := rec.Metadata[MetaProviderID]
+			m[pid] = append(m[pid], rec)
+		}
+	}
+	for _, recs := range m {
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].TimeStamp.Before(recs[j].TimeStamp)
+		})
+	}
+	return m, nil
+}
+
+// RecordStats counts records from from until to, by tunnel Type and status.
+// All Types of this package and all statuses are in the result, zero if not found.
+// Records of other Types, or without a Type, are not counted.
+// Counting is done by firestore, it needs a composite index of type, status and timestamp.
+func (s *firePokeStore) RecordStats(ctx context.Context, from, to time.Time) (map[string]map[string]int, error) {
+	stats := make(map[string]map[string]int, len(tunnelTypes))
+	for _, typ := range tunnelTypes {
+		stats[typ] = make(map[string]int, len(statuses))
+		for _, st := range statuses {
+			q, err := s.scope(ctx, s.recCol.
+				Where("type", "==", typ).
+				Where("status", "==", st).
+				Where("timestamp", ">=", from).
+				Where("timestamp", "<", to))
+			var res firestore.AggregationResult
+			if err == nil {
+				res, err = s.count(ctx, q)
+			}
+			if err != nil {
+				return nil, firePokeStoreErr{
+					err,
+					"record_stats",
+					typ + "/" + st,
+				}
+			}
+			if v, ok := res["count"].(*firestorepb.Value); ok {
+				stats[typ][st] = int(v.GetIntegerValue())
+			}
+		}
+	}
+	return stats, nil
+}
+
 // Archive moves a poke from queuing state to archived state.
-// expired
+// It is idempotent: if the poke is archived already, e.g. by an archive failed halfway,
+// the existing archived poke is returned, and the queuing poke, if left, is deleted.
 func (s *firePokeStore) Archive(ctx context.Context, id string) (*ArchivedPoke, error) {
-	pokeRef := s.pokeCol.Doc(id)
-	arcRef := s.archiveCol.Doc(id)
+	return s.archive(ctx, "archive", id, "")
+}
+
+// DeadLetter archives a poke given up on, e.g. failed every attempt, marked DeadLettered for reason.
+// Like Archive, a poke archived already is returned as it is.
+func (s *firePokeStore) DeadLetter(ctx context.Context, id, reason string) (*ArchivedPoke, error) {
+	return s.archive(ctx, "dead_letter", id, reason)
+}
+
+// archive archives poke id, dead lettered for deadLetter if not empty. op names the caller.
+func (s *firePokeStore) archive(ctx context.Context, op, id, deadLetter string) (*ArchivedPoke, error) {
 	a := new(ArchivedPoke)
 	t := time.Now()
+	start := t
 
-	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		p := new(Poke)
-		psnap, err := tx.Get(pokeRef)
-		if err != nil {
+	tenant, err := s.tenant(ctx)
+	if err == nil {
+		err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			var err error
+			a, _, err = s.archiveTx(tx, id, tenant, t, deadLetter)
 			return err
+		})
+	}
+	s.logOp(ctx, op, start, err, slog.String("poke_id", id))
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			op,
+			id,
 		}
-		err = psnap.DataTo(p)
-		if err != nil {
-			return err
+	}
+	s.emit(ctx, PokeArchived, id)
+	return a, nil
+}
+
+// archiveTx archives poke id of tenant at t in tx, or returns the existing archived poke.
+// If deadLetter is not empty, the poke is dead lettered for it.
+// pending reports whether the queuing poke existed, and is deleted by tx.
+// Writes of tx must follow it, as it reads.
+func (s *firePokeStore) archiveTx(tx *firestore.Transaction, id, tenant string, t time.Time, deadLetter string) (a *ArchivedPoke, pending bool, err error) {
+	pokeRef := s.pokeRef(id)
+	arcRef := s.archiveRef(id)
+
+	asnap, err := tx.Get(arcRef)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, false, err
+	}
+	psnap, perr := tx.Get(pokeRef)
+	if perr != nil && status.Code(perr) != codes.NotFound {
+		return nil, false, perr
+	}
+	if err := checkTenant(asnap, tenant); err != nil {
+		return nil, false, err
+	}
+	if err := checkTenant(psnap, tenant); err != nil {
+		return nil, false, err
+	}
+
+	if err == nil {
+		a = new(ArchivedPoke)
+		if err := asnap.DataTo(a); err != nil {
+			return nil, false, err
+		}
+		a.ID = id
+		if perr != nil {
+			return a, false, nil
+		}
+		return a, true, tx.Delete(pokeRef)
+	}
+	if perr != nil {
+		return nil, false, perr
+	}
+
+	p := new(Poke)
+	if err := s.decodePoke(psnap, p); err != nil {
+		return nil, false, err
+	}
+	p.ID = id
+
+	a = p.Archive(t)
+	if deadLetter != "" {
+		a.DeadLettered = true
+		a.DeadLetterReason = deadLetter
+	}
+	if !s.retainBody {
+		a.dropContent()
+	}
+	if err := tx.Create(arcRef, a); err != nil {
+		return nil, false, err
+	}
+	return a, true, tx.Delete(pokeRef)
+}
+
+// CompleteSend records rec of a sent poke and archives the poke in one transaction,
+// so a poke recorded as sent is never left pending to be sent again.
+// If the poke is gone, e.g. completed already, nothing is written and its archived poke is returned.
+// rec.MessageID defaults to id.
+func (s *firePokeStore) CompleteSend(ctx context.Context, id string, rec Record) (*ArchivedPoke, error) {
+	if rec.MessageID == "" {
+		rec.MessageID = id
+	}
+	tenant, err := s.tenant(ctx)
+	if err == nil {
+		err = s.tagRecord(ctx, &rec)
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"complete_send",
+			id,
 		}
-		p.ID = psnap.Ref.ID
+	}
+	recID := rec.ID
+	if recID == "" && rec.Metadata[MetaEventID] != "" {
+		recID = eventRecordID(rec)
+	}
+	recRef := s.newDoc(s.recCol, recID)
+	var a *ArchivedPoke
+	pending := false
+	t := time.Now()
+	start := t
 
-		a = &ArchivedPoke{
-			Tunnel:  p.Tunnel,
-			To:      p.To,
-			Expired: t.After(p.Expiry),
+	err = s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		recorded := false
+		if recID != rec.ID {
+			// the event may be recorded already; it is left as it is, as by CreateRecord
+			d, err := tx.Get(recRef)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			recorded = err == nil && d.Exists()
 		}
-		err = tx.Create(arcRef, a)
-		if err != nil {
+		var err error
+		a, pending, err = s.archiveTx(tx, id, tenant, t, "")
+		if err != nil || !pending || recorded {
 			return err
 		}
-		return tx.Delete(pokeRef)
+		return tx.Create(recRef, rec)
 	})
+	s.logOp(ctx, "complete_send", start, err, slog.String("poke_id", id), slog.String("status", rec.Status))
 	if err != nil {
 		return nil, firePokeStoreErr{
 			err,
-			"archive",
+			"complete_send",
 			id,
 		}
 	}
+	if pending {
+		s.emit(ctx, PokeArchived, id)
+	}
 	return a, nil
 }
 
-func (s *firePokeStore) DeleteArchived(ctx context.Context, IDs ...string) error {
-	refs := make([]*firestore.DocumentRef, 0, len(IDs))
+// ArchiveBatch archives pokes one by one. Pokes already gone, e.g. archived by others, are skipped.
+// It returns the archived pokes, together with errors of pokes failed to archive.
+func (s *firePokeStore) ArchiveBatch(ctx context.Context, IDs ...string) ([]*ArchivedPoke, error) {
+	archived := make([]*ArchivedPoke, 0, len(IDs))
+	var errs []error
 	for _, id := range IDs {
-		refs = append(refs, s.archiveCol.Doc(id))
+		a, err := s.Archive(ctx, id)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			archived = append(archived, a)
+		}
 	}
+	return archived, errors.Join(errs...)
+}
 
-	err := s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		var err error
-		for _, ref := range refs {
-			err = tx.Delete(ref)
-			if err != nil {
-				return err
-			}
+// ListArchivedBefore lists pokes archived before a time. limit <= 0 means no limit.
+// Pokes archived without a time are not listed.
+func (s *firePokeStore) ListArchivedBefore(ctx context.Context, before time.Time, limit int) ([]*ArchivedPoke, error) {
+	q, err := s.scope(ctx, s.archiveQuery().Where("archived_at", "<", before))
+	if err == nil && limit > 0 {
+		q = q.Limit(limit)
+	}
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_archived_before",
+			before.String(),
 		}
-		return nil
-	})
+	}
+	return s.archivedFromDocs(docs, "list_archived_before")
+}
+
+// ListByRecipient lists archived pokes to recipient to, most recently archived first.
+// Phone numbers with a country code match however they are written, e.g. "+1 555-555-0100"
+// matches "+15555550100"; other recipients, like numbers without a country code, match as stored.
+// Pokes archived before recipients were stored normalized are not listed.
+// It needs a composite index of "recipient" and "archived_at" descending.
+func (s *firePokeStore) ListByRecipient(ctx context.Context, to string, limit int) ([]*ArchivedPoke, error) {
+	q, err := s.scope(ctx, s.archiveQuery().Where("recipient", "==", recipientKey(to)).
+		OrderBy("archived_at", firestore.Desc))
+	if err == nil && limit > 0 {
+		q = q.Limit(limit)
+	}
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
 	if err != nil {
-		return firePokeStoreErr{
+		return nil, firePokeStoreErr{
 			err,
+			"list_by_recipient",
+			to,
+		}
+	}
+	return s.archivedFromDocs(docs, "list_by_recipient")
+}
+
+// ListDeadLettered lists dead lettered pokes, see DeadLetter.
+// At most 1000 pokes are listed, or the limit set by WithListLimit.
+func (s *firePokeStore) ListDeadLettered(ctx context.Context) ([]*ArchivedPoke, error) {
+	q, err := s.scope(ctx, s.archiveQuery().Where("dead_lettered", "==", true))
+	if err == nil && s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+	var docs []*firestore.DocumentSnapshot
+	if err == nil {
+		docs, err = s.queryDocs(ctx, q)
+	}
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_dead_lettered",
+			"",
+		}
+	}
+	return s.archivedFromDocs(docs, "list_dead_lettered")
+}
+
+// archivedFromDocs unmarshals archived pokes from docs. errFunc names the caller in errors.
+func (s *firePokeStore) archivedFromDocs(docs []*firestore.DocumentSnapshot, errFunc string) ([]*ArchivedPoke, error) {
+	archived := make([]*ArchivedPoke, 0, len(docs))
+	for _, d := range docs {
+		a := new(ArchivedPoke)
+		if err := d.DataTo(a); err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				errFunc,
+				d.Ref.ID,
+			}
+		}
+		a.ID = s.archivedIDOf(d.Ref)
+		archived = append(archived, a)
+	}
+	return archived, nil
+}
+
+// DeleteArchived deletes archived pokes, as Delete does.
+func (s *firePokeStore) DeleteArchived(ctx context.Context, IDs ...string) error {
+	start := time.Now()
+	deleted, failed := s.deleteDocs(ctx, s.archiveRef, IDs)
+	de := deleteErr(failed)
+	var err error
+	if de != nil {
+		err = de
+	}
+	s.logOp(ctx, "delete_archived", start, err, slog.String("poke_id", strings.Join(IDs, ",")))
+	s.emit(ctx, ArchiveDeleted, deleted...)
+	if de != nil {
+		return firePokeStoreErr{
+			de,
 			"delete archived",
-			strings.Join(IDs, ","),
+			strings.Join(de.IDs(), ","),
 		}
 	}
 	return nil
@@ -0,0 +1,374 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestGetRecord(t *testing.T) {
+	s, _ := newFakeStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, r := range []Record{
+		{MessageID: "a", Status: StatusQueued, TimeStamp: now},
+		{MessageID: "a", Status: StatusDelivered, TimeStamp: now.Add(time.Second)},
+		{MessageID: "b", Status: StatusQueued, TimeStamp: now},
+	} {
+		if _, err := s.CreateRecord(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		messageID string
+		want      int
+	}{
+		{"a", 2},
+		{"b", 1},
+		{"c", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.messageID, func(t *testing.T) {
+			recs, err := s.GetRecord(ctx, tt.messageID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != tt.want {
+				t.Fatalf("GetRecord(%q) = %d records, want %d", tt.messageID, len(recs), tt.want)
+			}
+			for _, r := range recs {
+				if r.MessageID != tt.messageID || r.ID == "" {
+					t.Errorf("GetRecord(%q) returned %+v", tt.messageID, r)
+				}
+			}
+		})
+	}
+}
+
+func TestListToSendNotBefore(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		early    int // pokes due, but before their NotBefore
+		wantDue  int
+		listSize int
+	}{
+		{"no early pokes", 0, 1, 2},
+		{"early pokes fill a page", 3, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t, WithListLimit(tt.listSize))
+			ctx := context.Background()
+			for i := 0; i < tt.early; i++ {
+				p := &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "later", DateToSend: now.Add(-time.Hour), NotBefore: now.Add(time.Hour)}
+				if _, err := s.Create(ctx, p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			due, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "now", DateToSend: now.Add(-time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pokes, err := s.ListToSend(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pokes) != tt.wantDue || pokes[0].ID != due.ID {
+				t.Errorf("ListToSend = %d pokes, want poke %s only", len(pokes), due.ID)
+			}
+		})
+	}
+}
+
+func TestRescheduleNotBefore(t *testing.T) {
+	s, _ := newFakeStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi", NotBefore: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reschedule(ctx, p.ID, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	pokes, err := s.ListToSend(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pokes) != 0 {
+		t.Errorf("rescheduled before its NotBefore, ListToSend = %d pokes, want 0", len(pokes))
+	}
+}
+
+func TestEventRecordedOnce(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	event := Record{MessageID: "p1", Status: StatusDelivered, Type: TypeSMS, TimeStamp: now}
+	event.setMeta(MetaEventID, "SM1/delivered")
+
+	tests := []struct {
+		name  string
+		again func(s *firePokeStore) error
+	}{
+		{"CreateRecord", func(s *firePokeStore) error {
+			_, err := s.CreateRecord(context.Background(), event)
+			return err
+		}},
+		{"CreateRecords", func(s *firePokeStore) error {
+			_, err := s.CreateRecords(context.Background(), event, event)
+			return err
+		}},
+		{"CompleteSend", func(s *firePokeStore) error {
+			_, err := s.CompleteSend(context.Background(), "p1", event)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t, WithIDGenerator(fixedID("p1")))
+			ctx := context.Background()
+			if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateRecord(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.UpdateCost(ctx, "p1", 0.01, "USD"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.again(s); err != nil {
+				t.Fatal(err)
+			}
+			recs, err := s.GetRecord(ctx, "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != 1 || recs[0].Cost != 0.01 {
+				t.Errorf("records = %+v, want one with its cost", recs)
+			}
+		})
+	}
+}
+
+// fixedID is an IDGenerator of one ID.
+type fixedID string
+
+func (id fixedID) Generate() string { return string(id) }
+
+func TestListExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		dateToSend    time.Time
+		expiry        time.Time
+		defaultExpiry time.Duration
+		wantExpired   bool
+	}{
+		{"zero expiry never expires", time.Time{}, time.Time{}, 0, false},
+		{"zero expiry, past date to send", now.Add(-48 * time.Hour), time.Time{}, 0, false},
+		{"expired", now.Add(-2 * time.Hour), now.Add(-time.Hour), 0, true},
+		{"not expired yet", now.Add(-2 * time.Hour), now.Add(time.Hour), 0, false},
+		{"default expiry passed", now.Add(-2 * time.Hour), time.Time{}, time.Hour, true},
+		{"default expiry to come", now.Add(-time.Minute), time.Time{}, time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t, WithDefaultExpiry(tt.defaultExpiry))
+			ctx := context.Background()
+			p := &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi", DateToSend: tt.dateToSend, Expiry: tt.expiry}
+			if _, err := s.Create(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			pokes, err := s.ListExpired(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(pokes) == 1; got != tt.wantExpired {
+				t.Errorf("ListExpired = %d pokes, want expired %v", len(pokes), tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestArchiveArchivedAlready(t *testing.T) {
+	tests := []struct {
+		name         string
+		pending      bool // the poke is still queued
+		archived     bool // the archive doc exists, e.g. from an archive failed halfway
+		wantErr      error
+		wantExisting bool
+	}{
+		{"pending", true, false, nil, false},
+		{"archived halfway", true, true, nil, true},
+		{"archived", false, true, nil, true},
+		{"missing", false, false, ErrNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newFakeStore(t)
+			ctx := context.Background()
+			if tt.pending {
+				if _, err := s.Create(ctx, &Poke{ID: "p1", Tunnel: TypeSMS, To: "+15555550100", Body: "new"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.archived {
+				if _, err := s.archiveCol.Doc("p1").Set(ctx, ArchivedPoke{Tunnel: TypeSMS, To: "+15555550100", Body: "old"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a, err := s.Archive(ctx, "p1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Archive error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if a.ID != "p1" {
+				t.Errorf("archived poke ID = %q, want p1", a.ID)
+			}
+			if got := a.Body == "old"; got != tt.wantExisting {
+				t.Errorf("returned the existing archived poke = %v, want %v", got, tt.wantExisting)
+			}
+			if n := f.count("pokes"); n != 0 {
+				t.Errorf("%d pokes left queued, want 0", n)
+			}
+			if n := f.count("archives"); n != 1 {
+				t.Errorf("%d archived pokes, want 1", n)
+			}
+		})
+	}
+}
+
+func TestClaimToSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		claimed     int // oldest pokes claimed by another worker
+		rescheduled bool
+		limit       int
+		want        int
+	}{
+		{"unclaimed", 0, false, 2, 2},
+		{"after claimed", 2, false, 1, 1},
+		{"all claimed", 3, false, 3, 0},
+		{"claim released", 3, true, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			ctx := context.Background()
+			now := time.Now()
+			var ids []string
+			for i := 0; i < 3; i++ {
+				p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi", DateToSend: now.Add(time.Duration(i-10) * time.Second)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, p.ID)
+			}
+			if tt.claimed > 0 {
+				if _, err := s.ClaimToSend(ctx, "w1", time.Hour, tt.claimed); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.rescheduled {
+				if err := s.Reschedule(ctx, ids[0], now.Add(-time.Second)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.ClaimToSend(ctx, "w2", time.Hour, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("claimed %d pokes, want %d", len(got), tt.want)
+			}
+			listed, err := s.ListToSend(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := 3 - tt.claimed - len(got); !tt.rescheduled && len(listed) != n {
+				t.Errorf("ListToSend = %d pokes, want the %d unclaimed", len(listed), n)
+			}
+		})
+	}
+}
+
+func TestDeleteLogsNoError(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(s *firePokeStore, ctx context.Context, id string) error
+	}{
+		{"delete", func(s *firePokeStore, ctx context.Context, id string) error {
+			return s.Delete(ctx, id)
+		}},
+		{"delete archived", func(s *firePokeStore, ctx context.Context, id string) error {
+			if _, err := s.Archive(ctx, id); err != nil {
+				return err
+			}
+			return s.DeleteArchived(ctx, id)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeStore(t)
+			var logs bytes.Buffer
+			s.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelError}))
+			ctx := context.Background()
+			p, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: "+15555550100", Body: "hi"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.delete(s, ctx, p.ID); err != nil {
+				t.Fatal(err)
+			}
+			if logs.Len() > 0 {
+				t.Errorf("logged errors of a clean delete: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestCancelByRecipient(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string // to of the poke
+		legacy bool   // stored without a normalized recipient
+		cancel string
+		want   int
+	}{
+		{"same", "+15550100000", false, "+15550100000", 1},
+		{"written differently", "+1 (555) 010-0000", false, "+15550100000", 1},
+		{"cancelled written differently", "+15550100000", false, "+1 555.010.0000", 1},
+		{"other number", "+15550100000", false, "+15550100001", 0},
+		{"legacy as written", "+1 (555) 010-0000", true, "+1 (555) 010-0000", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newFakeStore(t)
+			ctx := context.Background()
+			if tt.legacy {
+				if _, err := s.pokeCol.Doc("old").Set(ctx, map[string]interface{}{"tunnel": TypeSMS, "to": tt.stored, "body": "hi"}); err != nil {
+					t.Fatal(err)
+				}
+			} else if _, err := s.Create(ctx, &Poke{Tunnel: TypeSMS, To: tt.stored, Body: "hi"}); err != nil {
+				t.Fatal(err)
+			}
+			n, err := s.CancelByRecipient(ctx, tt.cancel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want || f.count("pokes") != 1-tt.want {
+				t.Errorf("CancelByRecipient = %d, %d pokes left, want %d cancelled", n, f.count("pokes"), tt.want)
+			}
+		})
+	}
+}
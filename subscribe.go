@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SubscribingStore is a PokeStore calling functions subscribed by OnStatusChange
+// when records of a message are created through it: by CreateRecord, CreateRecords and CompleteSend.
+// It is in-process only; records created by other processes, or by other stores, are not seen.
+// Across processes, listen to the record collection by a firestore snapshot listener instead,
+// e.g. client.Collection(recCol).Where("message_id", "==", id).Snapshots(ctx).
+type SubscribingStore struct {
+	PokeStore
+
+	mu   sync.Mutex
+	subs map[string]map[*statusSub]struct{}
+}
+
+// statusSub is a function subscribed to a message.
+// It is a pointer, so subscriptions of the same function are told apart.
+type statusSub struct {
+	fn func(Record)
+}
+
+// NewSubscribingStore returns a SubscribingStore over s.
+func NewSubscribingStore(s PokeStore) *SubscribingStore {
+	return &SubscribingStore{PokeStore: s, subs: make(map[string]map[*statusSub]struct{})}
+}
+
+// OnStatusChange makes fn be called with every record of message messageID created from now on.
+// fn is called in a goroutine of its own after the record is created, so it does not hold up
+// the write; calls of records created close together may come in any order, compare their TimeStamp.
+// cancel stops the calls not started yet.
+func (s *SubscribingStore) OnStatusChange(messageID string, fn func(Record)) (cancel func()) {
+	sub := &statusSub{fn: fn}
+	s.mu.Lock()
+	if s.subs[messageID] == nil {
+		s.subs[messageID] = make(map[*statusSub]struct{})
+	}
+	s.subs[messageID][sub] = struct{}{}
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs[messageID], sub)
+		if len(s.subs[messageID]) == 0 {
+			delete(s.subs, messageID)
+		}
+	}
+}
+
+// publish calls functions subscribed to the message of rec.
+func (s *SubscribingStore) publish(rec Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs[rec.MessageID] {
+		sub := sub
+		go func() {
+			s.mu.Lock()
+			_, ok := s.subs[rec.MessageID][sub]
+			s.mu.Unlock()
+			if ok {
+				sub.fn(rec)
+			}
+		}()
+	}
+}
+
+// CreateRecord creates r, and calls functions subscribed to its message.
+func (s *SubscribingStore) CreateRecord(ctx context.Context, r Record) (Record, error) {
+	r, err := s.PokeStore.CreateRecord(ctx, r)
+	if err == nil {
+		s.publish(r)
+	}
+	return r, err
+}
+
+// CreateRecords creates recs, and calls functions subscribed to messages of records created.
+func (s *SubscribingStore) CreateRecords(ctx context.Context, recs ...Record) ([]Record, error) {
+	created, err := s.PokeStore.CreateRecords(ctx, recs...)
+	for _, r := range created {
+		s.publish(r)
+	}
+	return created, err
+}
+
+// CompleteSend archives poke id with rec, and calls functions subscribed to it,
+// unless the poke was archived before.
+func (s *SubscribingStore) CompleteSend(ctx context.Context, id string, rec Record) (*ArchivedPoke, error) {
+	// firestore keeps microseconds
+	start := time.Now().Truncate(time.Microsecond)
+	a, err := s.PokeStore.CompleteSend(ctx, id, rec)
+	// a poke archived before is returned as it was, ArchivedAt before start
+	if err == nil && !a.ArchivedAt.Before(start) {
+		if rec.MessageID == "" {
+			rec.MessageID = id
+		}
+		s.publish(rec)
+	}
+	return a, err
+}
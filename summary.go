@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// PokeSummary is a poke without its content, for list views.
+type PokeSummary struct {
+	ID         string    `firestore:"-" json:"id"`
+	Tunnel     string    `firestore:"tunnel" json:"tunnel"`
+	To         string    `firestore:"to" json:"to"`
+	DateToSend time.Time `firestore:"-" json:"date_to_send"`
+}
+
+// ListToSendSummary lists the pokes of ListToSend, reading only the fields of PokeSummary.
+// Get the full pokes to send them.
+func (s *firePokeStore) ListToSendSummary(c context.Context) ([]PokeSummary, error) {
+	s.migrateDue(c)
+	q, err := s.dueQuery(c, time.Now())
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_to_send_summary",
+			"",
+		}
+	}
+	q = q.Select("tunnel", "to", s.fields.DateToSend)
+	if s.listLimit > 0 {
+		q = q.Limit(s.listLimit)
+	}
+
+	docs, err := s.queryDocs(c, q)
+	if err != nil {
+		return nil, firePokeStoreErr{
+			err,
+			"list_to_send_summary",
+			"",
+		}
+	}
+	sums := make([]PokeSummary, 0, len(docs))
+	for _, doc := range docs {
+		var sum PokeSummary
+		if err = doc.DataTo(&sum); err != nil {
+			return nil, firePokeStoreErr{
+				err,
+				"list_to_send_summary",
+				doc.Ref.ID,
+			}
+		}
+		if v, err := doc.DataAt(s.fields.DateToSend); err == nil {
+			sum.DateToSend, _ = v.(time.Time)
+		}
+		sum.ID = s.idOf(doc.Ref)
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
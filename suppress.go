@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ErrSuppressed is returned when a recipient must not be contacted.
+var ErrSuppressed = errors.New("notify: recipient suppressed")
+
+// suppression is a blocked recipient
+type suppression struct {
+	To        string    `firestore:"to"`
+	Reason    string    `firestore:"reason,omitempty"`
+	TimeStamp time.Time `firestore:"timestamp"`
+}
+
+// SuppressionList is a list of blocked recipients in a firestore collection,
+// e.g. unsubscribed or do-not-contact ones. Phone numbers are normalized, see recipientKey,
+// so a number blocked is blocked however written.
+type SuppressionList struct {
+	c   *firestore.Client
+	col *firestore.CollectionRef
+}
+
+// NewSuppressionList returns a SuppressionList in collection col.
+func NewSuppressionList(c *firestore.Client, col string) *SuppressionList {
+	return &SuppressionList{c: c, col: c.Collection(col)}
+}
+
+// doc returns the document of recipient to.
+func (l *SuppressionList) doc(to string) *firestore.DocumentRef {
+	return l.col.Doc(recipientDocID(recipientKey(to)))
+}
+
+// docs returns the document of recipient to, and the one it was blocked by as written,
+// before numbers were normalized, if another.
+func (l *SuppressionList) docs(to string) []*firestore.DocumentRef {
+	refs := []*firestore.DocumentRef{l.doc(to)}
+	if id := recipientDocID(to); id != refs[0].ID {
+		refs = append(refs, l.col.Doc(id))
+	}
+	return refs
+}
+
+// recipientDocID returns the document ID of recipient to.
+// Recipients are hashed, as they may have characters not allowed in document IDs.
+func recipientDocID(to string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(to))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Add blocks recipient to.
+func (l *SuppressionList) Add(ctx context.Context, to, reason string) error {
+	_, err := l.doc(to).Set(ctx, suppression{
+		To:        recipientKey(to),
+		Reason:    reason,
+		TimeStamp: time.Now(),
+	})
+	return err
+}
+
+// Remove unblocks recipient to, however it was written when blocked.
+func (l *SuppressionList) Remove(ctx context.Context, to string) error {
+	for _, ref := range l.docs(to) {
+		if _, err := ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Suppressed reports whether recipient to is blocked.
+func (l *SuppressionList) Suppressed(ctx context.Context, to string) (bool, error) {
+	docs, err := l.c.GetAll(ctx, l.docs(to))
+	if err != nil {
+		return false, err
+	}
+	for _, d := range docs {
+		if d.Exists() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Hook is a PreSendHook suppressing pokes to blocked recipients.
+func (l *SuppressionList) Hook(ctx context.Context, p *Poke) error {
+	blocked, err := l.Suppressed(ctx, p.To)
+	if err != nil {
+		return fmt.Errorf("check suppression of %s: %w", p.ID, err)
+	}
+	if blocked {
+		return fmt.Errorf("%w: %s", ErrSuppressed, p.To)
+	}
+	return nil
+}
+
+// StopContacting adds recipient to to l, then cancels all pokes to it in store.
+// Pokes created after are suppressed by Hook when dispatched.
+// It returns how many pokes are cancelled.
+func (l *SuppressionList) StopContacting(ctx context.Context, store PokeStore, to, reason string) (int, error) {
+	if err := l.Add(ctx, to, reason); err != nil {
+		return 0, err
+	}
+	return store.CancelByRecipient(ctx, to)
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSuppressionList(t *testing.T) {
+	tests := []struct {
+		name    string
+		added   string
+		legacy  bool // added as written, as blocked before numbers were normalized
+		removed string
+		check   string
+		want    bool
+	}{
+		{"none", "", false, "", "+15550100000", false},
+		{"same", "+15550100000", false, "", "+15550100000", true},
+		{"written differently", "+1 (555) 010-0000", false, "", "+15550100000", true},
+		{"checked written differently", "+15550100000", false, "", "+1 555.010.0000", true},
+		{"other number", "+15550100000", false, "", "+15550100001", false},
+		{"email case", "Ann@Example.com", false, "", "ann@example.com", true},
+		{"legacy", "+1 (555) 010-0000", true, "", "+1 (555) 010-0000", true},
+		{"removed written differently", "+1 (555) 010-0000", false, "+15550100000", "+15550100000", false},
+		{"legacy removed", "+1 (555) 010-0000", true, "+1 (555) 010-0000", "+15550100000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeClient(t)
+			l := NewSuppressionList(c, "suppressions")
+			ctx := context.Background()
+			switch {
+			case tt.legacy:
+				if _, err := l.col.Doc(recipientDocID(tt.added)).Set(ctx, suppression{To: tt.added}); err != nil {
+					t.Fatal(err)
+				}
+			case tt.added != "":
+				if err := l.Add(ctx, tt.added, "stop"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.removed != "" {
+				if err := l.Remove(ctx, tt.removed); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := l.Suppressed(ctx, tt.check)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Suppressed(%q) = %v, want %v", tt.check, got, tt.want)
+			}
+		})
+	}
+}
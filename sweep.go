@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// SweepOptions configures Sweep
+type SweepOptions struct {
+	// Retention is how long archived pokes are kept. Zero keeps them forever.
+	Retention time.Duration
+	// Limit is the max number of pokes handled by each phase. Zero means no limit.
+	Limit int
+}
+
+// SweepResult counts pokes handled by each phase of Sweep
+type SweepResult struct {
+	Archived int
+	Purged   int
+}
+
+// Sweep archives expired pokes, recorded as StatusExpired, then purges archived pokes older than the retention.
+// Pokes claimed by a dispatcher and pokes with no expiry are left alone, and pokes
+// archived by others meanwhile are skipped, so it is safe to run along with dispatchers.
+// Whatever is left over by a failed or limited sweep is handled by the next one.
+func Sweep(ctx context.Context, store PokeStore, opts SweepOptions) (SweepResult, error) {
+	var res SweepResult
+	now := time.Now()
+
+	expired, err := store.ListExpired(ctx)
+	if err != nil {
+		return res, err
+	}
+	ids := make([]string, 0, len(expired))
+	for _, p := range expired {
+		if opts.Limit > 0 && len(ids) >= opts.Limit {
+			break
+		}
+		if p.Expiry.IsZero() || p.claimed(now) {
+			continue
+		}
+		ids = append(ids, p.ID)
+	}
+	archived, err := store.ArchiveBatch(ctx, ids...)
+	res.Archived = len(archived)
+	if err != nil {
+		return res, err
+	}
+	for _, a := range archived {
+		rec := Record{
+			MessageID: a.ID,
+			Status:    StatusExpired,
+			TimeStamp: now,
+			Metadata:  a.Metadata,
+		}
+		if _, err := store.CreateRecord(ctx, rec); err != nil {
+			return res, err
+		}
+	}
+
+	if opts.Retention <= 0 {
+		return res, nil
+	}
+	old, err := store.ListArchivedBefore(ctx, now.Add(-opts.Retention), opts.Limit)
+	if err != nil {
+		return res, err
+	}
+	ids = make([]string, 0, len(old))
+	for _, a := range old {
+		ids = append(ids, a.ID)
+	}
+	if err := store.DeleteArchived(ctx, ids...); err != nil {
+		return res, err
+	}
+	res.Purged = len(ids)
+	return res, nil
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TeamsTunnel sends pokes to a Microsoft Teams channel through an incoming webhook.
+// A poke is sent as a MessageCard, with the subject as title and the body as text.
+type TeamsTunnel struct {
+	webhook string
+	opts    tunnelOptions
+}
+
+// NewTeamsTunnel returns a TeamsTunnel posting to webhookURL.
+// A poke whose To is an https url is posted there instead.
+func NewTeamsTunnel(webhookURL string, opts ...TunnelOption) *TeamsTunnel {
+	t := &TeamsTunnel{webhook: webhookURL}
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	return t
+}
+
+// Type is a method of Tunnel interface
+func (TeamsTunnel) Type() string { return TypeTeams }
+
+// ID is a method of Tunnel interface.
+// It is the host of the webhook, as the webhook url itself is a secret.
+func (t TeamsTunnel) ID() string {
+	u, err := url.Parse(t.webhook)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// describe is a method of resource interface
+func (t TeamsTunnel) describe() string {
+	return fmt.Sprintf("service/%s/tunnel/%s/id/%s", "notify", t.Type(), t.ID())
+}
+
+// messageCard is a Teams MessageCard
+type messageCard struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Send posts a poke to the webhook.
+func (t TeamsTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t TeamsTunnel) send(ctx context.Context, p *Poke) (Record, error) {
+	rec := Record{MessageID: p.ID}
+
+	webhook := t.webhook
+	if strings.HasPrefix(p.To, "https://") {
+		webhook = p.To
+	}
+	summary := p.Subject
+	if summary == "" {
+		summary = p.Body
+	}
+	bs, err := json.Marshal(messageCard{
+		Type:    "MessageCard",
+		Context: "http://schema.org/extensions",
+		Summary: summary,
+		Title:   p.Subject,
+		Text:    p.Body,
+	})
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(bs))
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	rec.TimeStamp = time.Now()
+	if err != nil {
+		rec.Status = StatusError
+		return rec, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rec.Status = StatusFailed
+		return rec, &RateLimitError{
+			RetryAfter: retryAfter(resp.Header),
+			Err:        fmt.Errorf("teams webhook: %s: %s", resp.Status, bytes.TrimSpace(body)),
+		}
+	}
+	// teams responds 200 with body "1" on success, and 200 with an error message on some failures.
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "1" {
+		rec.Status = StatusFailed
+		return rec, fmt.Errorf("teams webhook: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	rec.Status = StatusDelivered
+	return rec, nil
+}
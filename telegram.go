@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramAPI is the base url of the telegram bot api
+const telegramAPI = "https://api.telegram.org/bot"
+
+// TelegramTunnel sends pokes as messages of a telegram bot. The To of a poke is the chat ID.
+type TelegramTunnel struct {
+	token string
+	opts  tunnelOptions
+}
+
+// NewTelegramTunnel returns a TelegramTunnel of the bot of botToken.
+// Bodies are parsed as Markdown, unless set otherwise by WithParseMode.
+func NewTelegramTunnel(botToken string, opts ...TunnelOption) *TelegramTunnel {
+	t := &TelegramTunnel{token: botToken}
+	t.opts.parseMode = "Markdown"
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	return t
+}
+
+// Type is a method of Tunnel interface
+func (TelegramTunnel) Type() string { return TypeTelegram }
+
+// ID is a method of Tunnel interface. It is the bot ID, the token without its secret.
+func (t TelegramTunnel) ID() string {
+	if i := strings.IndexByte(t.token, ':'); i >= 0 {
+		return t.token[:i]
+	}
+	return ""
+}
+
+// describe is a method of resource interface
+func (t TelegramTunnel) describe() string {
+	return fmt.Sprintf("service/%s/tunnel/%s/id/%s", "notify", t.Type(), t.ID())
+}
+
+// telegramResponse is a response of the telegram bot api
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"` // seconds to wait, when rate limited
+	} `json:"parameters"`
+	Result struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+}
+
+// Send sends a poke through the telegram sendMessage api.
+func (t TelegramTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t TelegramTunnel) send(ctx context.Context, p *Poke) (Record, error) {
+	rec := Record{MessageID: p.ID}
+
+	msg := map[string]string{
+		"chat_id": p.To,
+		"text":    p.Body,
+	}
+	if t.opts.parseMode != "" {
+		msg["parse_mode"] = t.opts.parseMode
+	}
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, err
+	}
+	req, err := http.NewRequest(http.MethodPost, telegramAPI+t.token+"/sendMessage", bytes.NewReader(bs))
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, errors.New("telegram: invalid bot token")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	rec.TimeStamp = time.Now()
+	if err != nil {
+		rec.Status = StatusError
+		// the url has the token, keep it out of errors.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return rec, fmt.Errorf("telegram: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tr telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		rec.Status = StatusError
+		return rec, fmt.Errorf("telegram: %s: %w", resp.Status, err)
+	}
+	if !tr.OK {
+		// e.g. 403 the bot is blocked by the user, 400 chat not found
+		rec.Status = StatusFailed
+		err := fmt.Errorf("telegram error %d: %s", tr.ErrorCode, tr.Description)
+		if tr.ErrorCode == http.StatusTooManyRequests {
+			return rec, &RateLimitError{
+				RetryAfter: time.Duration(tr.Parameters.RetryAfter) * time.Second,
+				Err:        err,
+			}
+		}
+		return rec, err
+	}
+	rec.Status = StatusDelivered
+	rec.setMeta(MetaProviderID, strconv.FormatInt(tr.Result.MessageID, 10))
+	return rec, nil
+}
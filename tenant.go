@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoTenant is returned by a store isolating tenants for a context without a tenant.
+var ErrNoTenant = errors.New("notify: no tenant in context")
+
+// errOtherTenant is the error of a document of another tenant, which is not found to the tenant.
+var errOtherTenant = status.Error(codes.NotFound, "document of another tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx for tenant id. See WithTenantIsolation.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// TenantFrom returns the tenant of ctx, or "" if it has none.
+func TenantFrom(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
+
+// tenant returns the tenant of ctx, if s isolates tenants. Otherwise it is "".
+func (s *firePokeStore) tenant(ctx context.Context) (string, error) {
+	if !s.tenants {
+		return "", nil
+	}
+	id := TenantFrom(ctx)
+	if id == "" {
+		return "", ErrNoTenant
+	}
+	return id, nil
+}
+
+// scope filters q to documents of the tenant of ctx.
+func (s *firePokeStore) scope(ctx context.Context, q firestore.Query) (firestore.Query, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil || tenant == "" {
+		return q, err
+	}
+	return q.Where("tenant_id", "==", tenant), nil
+}
+
+// checkTenant returns errOtherTenant if d is not a document of tenant.
+// Any document passes an empty tenant, and a missing document passes any.
+func checkTenant(d *firestore.DocumentSnapshot, tenant string) error {
+	if tenant == "" || d == nil || !d.Exists() {
+		return nil
+	}
+	if v, err := d.DataAt("tenant_id"); err == nil {
+		if id, _ := v.(string); id == tenant {
+			return nil
+		}
+	}
+	return errOtherTenant
+}
+
+// checkOwned returns errOtherTenant if ref is not a document of the tenant of ctx.
+// It reads ref only if s isolates tenants.
+func (s *firePokeStore) checkOwned(ctx context.Context, ref *firestore.DocumentRef) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil || tenant == "" {
+		return err
+	}
+	d, err := s.getDoc(ctx, ref)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	return checkTenant(d, tenant)
+}
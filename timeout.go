@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutTunnel is a Tunnel that gives up a Send taking longer than its timeout.
+type TimeoutTunnel struct {
+	t Tunnel
+	d time.Duration
+}
+
+// NewTimeoutTunnel returns a TimeoutTunnel, which caps every Send of t at d.
+func NewTimeoutTunnel(t Tunnel, d time.Duration) *TimeoutTunnel {
+	return &TimeoutTunnel{
+		t: t,
+		d: d,
+	}
+}
+
+// Type is a method of Tunnel interface
+func (t TimeoutTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t TimeoutTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t TimeoutTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface.
+// The wrapped Send runs under a context with timeout. If it does not return
+// in time, Send returns a StatusError Record and an error wrapping ctx.Err().
+// The wrapped Send is cancelled only if the tunnel honors its context.
+func (t TimeoutTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.d)
+	defer cancel()
+
+	type result struct {
+		rec Record
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rec, err := t.t.Send(ctx, p)
+		done <- result{rec, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.rec, r.err
+	case <-ctx.Done():
+		rec := Record{
+			MessageID: p.ID,
+			Status:    StatusError,
+			TimeStamp: time.Now(),
+		}
+		return rec, fmt.Errorf("send timeout after %s: %w", t.d, ctx.Err())
+	}
+}
@@ -0,0 +1,410 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of spans of the package
+const tracerName = "github.com/markxp/notify"
+
+// endSpan marks span failed if err is not nil, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingTunnel is a Tunnel that traces every Send in a "notify.send" span.
+type TracingTunnel struct {
+	t      Tunnel
+	tracer trace.Tracer
+}
+
+// NewTracingTunnel returns a TracingTunnel. A nil tp means the global TracerProvider.
+func NewTracingTunnel(t Tunnel, tp trace.TracerProvider) *TracingTunnel {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &TracingTunnel{
+		t:      t,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+// Type is a method of Tunnel interface
+func (t TracingTunnel) Type() string { return t.t.Type() }
+
+// ID is a method of Tunnel interface
+func (t TracingTunnel) ID() string { return t.t.ID() }
+
+// describe is a method of resource interface
+func (t TracingTunnel) describe() string { return t.t.describe() }
+
+// Send is a method of Tunnel interface. The span is a child of the span in ctx.
+func (t TracingTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	ctx, span := t.tracer.Start(ctx, "notify.send", trace.WithAttributes(
+		attribute.String("tunnel.type", t.Type()),
+		attribute.String("tunnel.id", t.ID()),
+		attribute.String("poke.id", p.ID),
+	))
+	rec, err := t.t.Send(ctx, p)
+	span.SetAttributes(attribute.String("status", rec.Status))
+	endSpan(span, err)
+	return rec, err
+}
+
+// WithTracing makes the store trace its operations in "notify.store.<op>" spans.
+// A nil tp means the global TracerProvider.
+func WithTracing(tp trace.TracerProvider) StoreOption {
+	return func(s *firePokeStore) {
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// tracedStore is a PokeStore tracing operations of s
+type tracedStore struct {
+	s      PokeStore
+	tracer trace.Tracer
+}
+
+func (t *tracedStore) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "notify.store."+op, trace.WithAttributes(attrs...))
+}
+
+func (t *tracedStore) Create(ctx context.Context, p *Poke) (*Poke, error) {
+	ctx, span := t.start(ctx, "create", attribute.String("tunnel.type", p.Tunnel))
+	p, err := t.s.Create(ctx, p)
+	if err == nil {
+		span.SetAttributes(attribute.String("poke.id", p.ID))
+	}
+	endSpan(span, err)
+	return p, err
+}
+
+func (t *tracedStore) Delete(ctx context.Context, IDs ...string) error {
+	ctx, span := t.start(ctx, "delete", attribute.String("poke.id", strings.Join(IDs, ",")))
+	err := t.s.Delete(ctx, IDs...)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedStore) DeleteBestEffort(ctx context.Context, IDs ...string) ([]string, map[string]error) {
+	ctx, span := t.start(ctx, "delete_best_effort", attribute.String("poke.id", strings.Join(IDs, ",")))
+	deleted, failed := t.s.DeleteBestEffort(ctx, IDs...)
+	span.SetAttributes(attribute.Int("deleted", len(deleted)), attribute.Int("failed", len(failed)))
+	var err error
+	if de := deleteErr(failed); de != nil {
+		err = de
+	}
+	endSpan(span, err)
+	return deleted, failed
+}
+
+func (t *tracedStore) Update(ctx context.Context, p *Poke) (*Poke, error) {
+	ctx, span := t.start(ctx, "update", attribute.String("poke.id", p.ID))
+	p, err := t.s.Update(ctx, p)
+	endSpan(span, err)
+	return p, err
+}
+
+func (t *tracedStore) Get(ctx context.Context, IDs ...string) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "get", attribute.String("poke.id", strings.Join(IDs, ",")))
+	pokes, err := t.s.Get(ctx, IDs...)
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) GetAt(ctx context.Context, readTime time.Time, IDs ...string) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "get_at",
+		attribute.String("poke.id", strings.Join(IDs, ",")),
+		attribute.String("read_time", readTime.Format(time.RFC3339)),
+	)
+	pokes, err := t.s.GetAt(ctx, readTime, IDs...)
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) Reschedule(ctx context.Context, id string, nextAttempt time.Time) error {
+	ctx, span := t.start(ctx, "reschedule", attribute.String("poke.id", id))
+	err := t.s.Reschedule(ctx, id, nextAttempt)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedStore) ListToSend(ctx context.Context) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_to_send")
+	pokes, err := t.s.ListToSend(ctx)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) ListToSendSummary(ctx context.Context) ([]PokeSummary, error) {
+	ctx, span := t.start(ctx, "list_to_send_summary")
+	sums, err := t.s.ListToSendSummary(ctx)
+	span.SetAttributes(attribute.Int("pokes", len(sums)))
+	endSpan(span, err)
+	return sums, err
+}
+
+func (t *tracedStore) StreamToSend(ctx context.Context) (<-chan *Poke, <-chan error) {
+	ctx, span := t.start(ctx, "stream_to_send")
+	in, inErrs := t.s.StreamToSend(ctx)
+	pokes := make(chan *Poke)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(pokes)
+		n := 0
+		for p := range in {
+			select {
+			case pokes <- p:
+				n++
+			case <-ctx.Done():
+			}
+		}
+		err := <-inErrs
+		span.SetAttributes(attribute.Int("pokes", n))
+		endSpan(span, err)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return pokes, errs
+}
+
+// Watch is not traced, as it lasts as long as ctx.
+func (t *tracedStore) Watch(ctx context.Context) (<-chan *Poke, <-chan error) {
+	return t.s.Watch(ctx)
+}
+
+func (t *tracedStore) ClaimToSend(ctx context.Context, workerID string, lease time.Duration, limit int) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "claim_to_send", attribute.String("worker.id", workerID))
+	pokes, err := t.s.ClaimToSend(ctx, workerID, lease, limit)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) ListExpired(ctx context.Context) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_expired")
+	pokes, err := t.s.ListExpired(ctx)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) ListByMetadata(ctx context.Context, key, value string, limit int) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_by_metadata", attribute.String("metadata.key", key))
+	pokes, err := t.s.ListByMetadata(ctx, key, value, limit)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) CreateRecords(ctx context.Context, recs ...Record) ([]Record, error) {
+	ctx, span := t.start(ctx, "create_records", attribute.Int("records", len(recs)))
+	created, err := t.s.CreateRecords(ctx, recs...)
+	endSpan(span, err)
+	return created, err
+}
+
+func (t *tracedStore) CreateRecord(ctx context.Context, r Record) (Record, error) {
+	ctx, span := t.start(ctx, "create_record",
+		attribute.String("poke.id", r.MessageID),
+		attribute.String("status", r.Status),
+	)
+	r, err := t.s.CreateRecord(ctx, r)
+	endSpan(span, err)
+	return r, err
+}
+
+func (t *tracedStore) GetRecord(ctx context.Context, messageID string) ([]*Record, error) {
+	ctx, span := t.start(ctx, "get_record", attribute.String("poke.id", messageID))
+	recs, err := t.s.GetRecord(ctx, messageID)
+	endSpan(span, err)
+	return recs, err
+}
+
+func (t *tracedStore) GetRecords(ctx context.Context, messageIDs ...string) (map[string][]*Record, error) {
+	ctx, span := t.start(ctx, "get_records", attribute.Int("pokes", len(messageIDs)))
+	recs, err := t.s.GetRecords(ctx, messageIDs...)
+	endSpan(span, err)
+	return recs, err
+}
+
+func (t *tracedStore) GetRecordsByProviderID(ctx context.Context, providerIDs ...string) (map[string][]*Record, error) {
+	ctx, span := t.start(ctx, "get_records_by_provider_id", attribute.Int("messages", len(providerIDs)))
+	recs, err := t.s.GetRecordsByProviderID(ctx, providerIDs...)
+	endSpan(span, err)
+	return recs, err
+}
+
+func (t *tracedStore) LatestRecord(ctx context.Context, messageID string) (*Record, error) {
+	ctx, span := t.start(ctx, "latest_record", attribute.String("poke.id", messageID))
+	rec, err := t.s.LatestRecord(ctx, messageID)
+	endSpan(span, err)
+	return rec, err
+}
+
+func (t *tracedStore) CompactRecords(ctx context.Context, messageID string) error {
+	ctx, span := t.start(ctx, "compact_records", attribute.String("poke.id", messageID))
+	err := t.s.CompactRecords(ctx, messageID)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedStore) SumCost(ctx context.Context, from, to time.Time, tenant string) (float64, error) {
+	ctx, span := t.start(ctx, "sum_cost")
+	sum, err := t.s.SumCost(ctx, from, to, tenant)
+	endSpan(span, err)
+	return sum, err
+}
+
+func (t *tracedStore) UpdateCost(ctx context.Context, messageID string, cost float64, currency string) error {
+	ctx, span := t.start(ctx, "update_cost", attribute.String("poke.id", messageID))
+	err := t.s.UpdateCost(ctx, messageID, cost, currency)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedStore) RecordStats(ctx context.Context, from, to time.Time) (map[string]map[string]int, error) {
+	ctx, span := t.start(ctx, "record_stats")
+	stats, err := t.s.RecordStats(ctx, from, to)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (t *tracedStore) CampaignStatus(ctx context.Context, campaign string) (CampaignStats, error) {
+	ctx, span := t.start(ctx, "campaign_status", attribute.String("campaign.id", campaign))
+	stats, err := t.s.CampaignStatus(ctx, campaign)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (t *tracedStore) Archive(ctx context.Context, id string) (*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "archive", attribute.String("poke.id", id))
+	a, err := t.s.Archive(ctx, id)
+	endSpan(span, err)
+	return a, err
+}
+
+func (t *tracedStore) DeadLetter(ctx context.Context, id, reason string) (*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "dead_letter", attribute.String("poke.id", id))
+	a, err := t.s.DeadLetter(ctx, id, reason)
+	endSpan(span, err)
+	return a, err
+}
+
+func (t *tracedStore) ListByRecipient(ctx context.Context, to string, limit int) ([]*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "list_by_recipient")
+	archived, err := t.s.ListByRecipient(ctx, to, limit)
+	span.SetAttributes(attribute.Int("pokes", len(archived)))
+	endSpan(span, err)
+	return archived, err
+}
+
+func (t *tracedStore) ListDeadLettered(ctx context.Context) ([]*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "list_dead_lettered")
+	archived, err := t.s.ListDeadLettered(ctx)
+	span.SetAttributes(attribute.Int("pokes", len(archived)))
+	endSpan(span, err)
+	return archived, err
+}
+
+func (t *tracedStore) CompleteSend(ctx context.Context, id string, rec Record) (*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "complete_send", attribute.String("poke.id", id), attribute.String("status", rec.Status))
+	a, err := t.s.CompleteSend(ctx, id, rec)
+	endSpan(span, err)
+	return a, err
+}
+
+func (t *tracedStore) ArchiveBatch(ctx context.Context, IDs ...string) ([]*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "archive_batch", attribute.Int("pokes", len(IDs)))
+	archived, err := t.s.ArchiveBatch(ctx, IDs...)
+	endSpan(span, err)
+	return archived, err
+}
+
+func (t *tracedStore) ListArchivedBefore(ctx context.Context, before time.Time, limit int) ([]*ArchivedPoke, error) {
+	ctx, span := t.start(ctx, "list_archived_before")
+	archived, err := t.s.ListArchivedBefore(ctx, before, limit)
+	span.SetAttributes(attribute.Int("pokes", len(archived)))
+	endSpan(span, err)
+	return archived, err
+}
+
+func (t *tracedStore) ListByOwner(ctx context.Context, uid string) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_by_owner")
+	pokes, err := t.s.ListByOwner(ctx, uid)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) ListScheduledBetween(ctx context.Context, from, to time.Time, limit int) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_scheduled_between")
+	pokes, err := t.s.ListScheduledBetween(ctx, from, to, limit)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) ListSLABreaches(ctx context.Context) ([]*Poke, error) {
+	ctx, span := t.start(ctx, "list_sla_breaches")
+	pokes, err := t.s.ListSLABreaches(ctx)
+	span.SetAttributes(attribute.Int("pokes", len(pokes)))
+	endSpan(span, err)
+	return pokes, err
+}
+
+func (t *tracedStore) CountPending(ctx context.Context) (int, error) {
+	ctx, span := t.start(ctx, "count_pending")
+	n, err := t.s.CountPending(ctx)
+	span.SetAttributes(attribute.Int("pokes", n))
+	endSpan(span, err)
+	return n, err
+}
+
+func (t *tracedStore) MigrateDueFields(ctx context.Context) (int, error) {
+	ctx, span := t.start(ctx, "migrate_due_fields")
+	n, err := t.s.MigrateDueFields(ctx)
+	span.SetAttributes(attribute.Int("pokes", n))
+	endSpan(span, err)
+	return n, err
+}
+
+func (t *tracedStore) CancelByRecipient(ctx context.Context, to string) (int, error) {
+	ctx, span := t.start(ctx, "cancel_by_recipient")
+	n, err := t.s.CancelByRecipient(ctx, to)
+	span.SetAttributes(attribute.Int("pokes", n))
+	endSpan(span, err)
+	return n, err
+}
+
+func (t *tracedStore) ExportByRecipient(ctx context.Context, to string) (RecipientExport, error) {
+	ctx, span := t.start(ctx, "export_by_recipient")
+	exp, err := t.s.ExportByRecipient(ctx, to)
+	span.SetAttributes(attribute.Int("pokes", len(exp.Pending)+len(exp.Archived)))
+	endSpan(span, err)
+	return exp, err
+}
+
+func (t *tracedStore) DeleteArchived(ctx context.Context, IDs ...string) error {
+	ctx, span := t.start(ctx, "delete_archived", attribute.String("poke.id", strings.Join(IDs, ",")))
+	err := t.s.DeleteArchived(ctx, IDs...)
+	endSpan(span, err)
+	return err
+}
@@ -1,15 +1,25 @@
 package notify
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/jordan-wright/email"
 	twilio "github.com/sfreiberg/gotwilio"
+	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/googleapi"
@@ -18,19 +28,26 @@ import (
 
 // SMSTunnel is a Tunnel. It can send a Poke.
 type SMSTunnel struct {
-	c  *twilio.Twilio
-	id string
+	c    *twilio.Twilio
+	id   string
+	opts tunnelOptions
+
+	alphaCodes []string // calling codes an alphanumeric sender can send to. nil for a number.
 }
 
 // NewSMSTunnel returns a SMSTunnel
-func NewSMSTunnel(num string, c *twilio.Twilio) *SMSTunnel {
+func NewSMSTunnel(num string, c *twilio.Twilio, opts ...TunnelOption) *SMSTunnel {
 	if c == nil {
 		c = twilio.NewTwilioClient(os.Getenv("TWILIO_SID"), os.Getenv("TWILIO_AUTH_TOKEN"))
 	}
-	return &SMSTunnel{
+	t := &SMSTunnel{
 		c:  c,
 		id: num,
 	}
+	for _, o := range opts {
+		o(&t.opts)
+	}
+	return t
 }
 
 // Type is a method of Tunnel interface
@@ -45,38 +62,299 @@ func (t SMSTunnel) describe() string {
 }
 
 // Send sends a poke through twilio sms.
-func (t SMSTunnel) Send(p *Poke) (Record, error) {
+func (t SMSTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t SMSTunnel) send(ctx context.Context, p *Poke) (Record, error) {
 	rec := new(Record)
 	rec.MessageID = p.ID
 
-	// TODO: register callback
-	var callbackURL string
-	var err error
+	// twilio posts status updates to the callback. a poke may override the tunnel's.
+	callbackURL := t.opts.callbackURL
+	if p.CallbackURL != "" {
+		callbackURL = p.CallbackURL
+	}
+	if err := validateCallbackURL(callbackURL); err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return *rec, err
+	}
+	callbackURL = callbackWithID(callbackURL, p)
 
-	// callbackURL = fmt.Sprintf("https://%s/twilioSMSCallback/%s", "sad", p.ID)
+	to, err := NormalizePhone(p.To, t.opts.region)
+	if err == nil {
+		err = t.checkAlpha(to)
+	}
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return *rec, err
+	}
 
-	resp, ex, err := t.c.SendSMS(t.ID(), p.To, string(p.Body), callbackURL, t.c.AccountSid)
+	body, translit, err := t.body(p)
+	if err == nil && t.opts.shortener != nil {
+		body, err = shortenLinks(ctx, t.opts.shortener, p, body)
+	}
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return *rec, err
+	}
+	if body != p.Body {
+		rec.setMeta(MetaSanitized, body)
+	}
+	if translit {
+		rec.setMeta(MetaTransliterated, "true")
+	}
 
+	scheduled, err := t.scheduled(p)
 	if err != nil {
 		rec.TimeStamp = time.Now()
 		rec.Status = StatusError
 		return *rec, err
 	}
 
+	if len(p.MediaURL) > 0 {
+		if err := t.validateMedia(ctx, p.MediaURL); err != nil {
+			rec.TimeStamp = time.Now()
+			rec.Status = StatusError
+			return *rec, err
+		}
+	}
+
+	mediaURL := ""
+	if len(p.MediaURL) > 0 {
+		mediaURL = p.MediaURL[0]
+	}
+	if scheduled {
+		resp, ex, wait, err := t.schedule(ctx, to, body, mediaURL, callbackURL, p.DateToSend)
+		r, err := smsRecord(*rec, resp, ex, wait, err)
+		if err == nil {
+			r.Status = StatusQueued
+		}
+		return r, err
+	}
+	resp, ex, wait, err := t.sendMessage(ctx, to, body, mediaURL, callbackURL)
+	return smsRecord(*rec, resp, ex, wait, err)
+}
+
+// body returns the body of p to send, after sanitizers of t.
+// With WithTransliteration, it is transliterated after, and translit reports whether it changed.
+func (t SMSTunnel) body(p *Poke) (body string, translit bool, err error) {
+	body = p.Body
+	if len(t.opts.sanitizers) > 0 {
+		body = Sanitize(body, t.opts.sanitizers...)
+	}
+	if !t.opts.transliterate {
+		return body, false, nil
+	}
+	body, translit = Transliterate(body)
+	for _, r := range body {
+		if gsmChar(r) {
+			continue
+		}
+		if !t.opts.dropNonGSM {
+			return "", false, fmt.Errorf("%w: poke %s has non GSM character %q", ErrInvalidPoke, p.ID, r)
+		}
+		body = strings.Map(func(r rune) rune {
+			if gsmChar(r) {
+				return r
+			}
+			return -1
+		}, body)
+		translit = true
+		break
+	}
+	return body, translit, nil
+}
+
+// validateMedia checks media urls of a MMS are https.
+// With WithMediaCheck, they are also checked reachable by a HEAD request.
+func (t SMSTunnel) validateMedia(ctx context.Context, urls []string) error {
+	// gotwilio sends one media url per message
+	if len(urls) > 1 {
+		return fmt.Errorf("mms supports one media url, got %d", len(urls))
+	}
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid media url %q: %w", u, err)
+		}
+		if parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid media url %q: must be an absolute https url", u)
+		}
+		if !t.opts.checkMedia {
+			continue
+		}
+		req, err := http.NewRequest(http.MethodHead, u, nil)
+		if err != nil {
+			return fmt.Errorf("invalid media url %q: %w", u, err)
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("media url %q not reachable: %w", u, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("media url %q not reachable: %s", u, resp.Status)
+		}
+	}
+	return nil
+}
+
+// twilioErrorCodes are statuses of common twilio error codes
+var twilioErrorCodes = map[twilio.ExceptionCode]string{
+	21211: StatusUndelivered, // invalid to number
+	21408: StatusUndelivered, // region of the number not enabled
+	21610: StatusUndelivered, // recipient unsubscribed by STOP
+	21612: StatusUndelivered, // number not reachable
+	21614: StatusUndelivered, // number is not a mobile number
+	20429: StatusFailed,      // too many requests
+	30001: StatusFailed,      // queue overflow
+}
+
+// twilioErrorStatus returns the status of a twilio exception, like gmailStatus:
+// requests twilio rejects are undelivered, requests twilio fails to process are failed.
+func twilioErrorStatus(ex *twilio.Exception) string {
+	if status, ok := twilioErrorCodes[ex.Code]; ok {
+		return status
+	}
+	if ex.Status >= 500 || ex.Status == 429 {
+		return StatusFailed
+	}
+	return StatusUndelivered
+}
+
+// TwilioErrorCode returns the twilio error code of err, if err is of a twilio exception.
+func TwilioErrorCode(err error) (int, bool) {
+	var ex twilio.Exception
+	if errors.As(err, &ex) {
+		return int(ex.Code), true
+	}
+	return 0, false
+}
+
+// smsRecord fills rec with the result of a twilio send.
+// wait is how long twilio asks to wait before retrying a refused send, zero if it does not tell.
+func smsRecord(rec Record, resp *twilio.SmsResponse, ex *twilio.Exception, wait time.Duration, err error) (Record, error) {
+	if err != nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, err
+	}
+
 	if ex != nil {
 		rec.TimeStamp = time.Now()
-		rec.Status = ex.MoreInfo
-		return *rec, fmt.Errorf("twilio exception: %#v", ex)
+		rec.Status = twilioErrorStatus(ex)
+		rec.setMeta(MetaErrorCode, strconv.Itoa(int(ex.Code)))
+		if ex.MoreInfo != "" {
+			rec.setMeta(MetaMoreInfo, ex.MoreInfo)
+		}
+		err := fmt.Errorf("twilio exception: %w", *ex)
+		if ex.Status == http.StatusTooManyRequests {
+			return rec, &RateLimitError{RetryAfter: wait, Err: err}
+		}
+		return rec, err
+	}
+
+	// gotwilio may return neither a response nor an error
+	if resp == nil {
+		rec.TimeStamp = time.Now()
+		rec.Status = StatusError
+		return rec, fmt.Errorf("twilio returned an empty response")
 	}
 
 	// finally, check response
+	rec.setMeta(MetaProviderID, resp.Sid)
+	if resp.Price != nil {
+		rec.setMeta(MetaPrice, *resp.Price)
+		if cost, ok := parsePrice(*resp.Price); ok {
+			rec.Cost = cost
+			rec.Currency = twilioCurrency
+		}
+	}
+	rec.TimeStamp = smsTime(&rec, resp)
+	rec.Status = resp.Status
+	return rec, nil
+}
+
+// smsTime returns the time twilio last updated resp, and keeps the raw provider times in metadata of rec.
+// If the time is missing or unparsable, e.g. twilio changed its format, it is time.Now(),
+// and rec is flagged with MetaTimeUnavailable telling why.
+func smsTime(rec *Record, resp *twilio.SmsResponse) time.Time {
+	if resp.DateUpdate != "" {
+		rec.setMeta(MetaProviderDateUpdated, resp.DateUpdate)
+	}
+	if resp.DateSent != "" {
+		rec.setMeta(MetaProviderDateSent, resp.DateSent)
+	}
+	if resp.DateUpdate == "" {
+		rec.setMeta(MetaTimeUnavailable, "twilio returned no date_updated")
+		return time.Now()
+	}
 	tm, err := resp.DateUpdateAsTime()
 	if err != nil {
-		tm = time.Now()
+		rec.setMeta(MetaTimeUnavailable, err.Error())
+		return time.Now()
 	}
-	rec.TimeStamp = tm
-	rec.Status = resp.Status
-	return *rec, err
+	return tm
+}
+
+// logSend logs a send attempt of p through t. Failed sends are logged at error level.
+func logSend(ctx context.Context, l *slog.Logger, t Tunnel, p *Poke, rec Record, err error, start time.Time) {
+	attrs := []slog.Attr{
+		slog.String("tunnel_type", t.Type()),
+		slog.String("tunnel_id", t.ID()),
+		slog.String("poke_id", p.ID),
+		slog.String("status", rec.Status),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "send failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	l.LogAttrs(ctx, slog.LevelInfo, "send", attrs...)
+}
+
+// callbackWithID adds the ID of p to callback url u as query "id", and the campaign and the owner
+// of p, if any, as queries "campaign" and "owner", for TwilioCallbackHandler.
+func callbackWithID(u string, p *Poke) string {
+	if u == "" {
+		return ""
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	q := parsed.Query()
+	q.Set("id", p.ID)
+	if p.CampaignID != "" {
+		q.Set("campaign", p.CampaignID)
+	}
+	if p.OwnerUID != "" {
+		q.Set("owner", p.OwnerUID)
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// validateCallbackURL checks u is an absolute https URL. An empty u means no callback.
+func validateCallbackURL(u string) error {
+	if u == "" {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid callback url %q: %w", u, err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("invalid callback url %q: must be an absolute https url", u)
+	}
+	return nil
 }
 
 // GMailTunnel is a Tunnel. It also implements the resource interface
@@ -85,11 +363,17 @@ type GMailTunnel struct {
 	email string
 	cred  *jwt.Config
 	svc   *gmail.Service
+	opts  tunnelOptions
 }
 
 // NewGMailTunnel returns a G-Suite domain-delegated gmail tunnel.
-func NewGMailTunnel(subject string, base *jwt.Config) (GMailTunnel, error) {
+// ctx is used to fetch tokens. A token is fetched upfront, so bad credentials fail here
+// rather than on first Send.
+func NewGMailTunnel(ctx context.Context, subject string, base *jwt.Config, opts ...TunnelOption) (GMailTunnel, error) {
 	t := GMailTunnel{}
+	for _, o := range opts {
+		o(&t.opts)
+	}
 
 	pkey := make([]byte, len(base.PrivateKey))
 	copy(pkey, base.PrivateKey)
@@ -113,8 +397,10 @@ func NewGMailTunnel(subject string, base *jwt.Config) (GMailTunnel, error) {
 
 	t.cred.Subject = subject
 	t.email = subject
-	ctx := context.TODO()
 	ts := t.cred.TokenSource(ctx)
+	if _, err := ts.Token(); err != nil {
+		return GMailTunnel{}, fmt.Errorf("gmail credentials of %s: %w", subject, err)
+	}
 	svc, err := gmail.NewService(ctx, option.WithTokenSource(ts))
 	if err != nil {
 		return GMailTunnel{}, err
@@ -123,6 +409,30 @@ func NewGMailTunnel(subject string, base *jwt.Config) (GMailTunnel, error) {
 	return t, nil
 }
 
+// GMailConfigFromJSON returns a config of a service account JSON key for NewGMailTunnel.
+// scopes default to gmail.send. Given scopes must contain gmail.send, or the full
+// https://mail.google.com/ scope which also grants sending.
+func GMailConfigFromJSON(data []byte, scopes ...string) (*jwt.Config, error) {
+	if len(scopes) == 0 {
+		scopes = []string{gmail.GmailSendScope}
+	}
+	ok := false
+	for _, s := range scopes {
+		if s == gmail.GmailSendScope || s == gmail.MailGoogleComScope {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("gmail config: scopes %v lack %s", scopes, gmail.GmailSendScope)
+	}
+	cfg, err := google.JWTConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("gmail config: %w", err)
+	}
+	return cfg, nil
+}
+
 // Type returns its Type
 func (GMailTunnel) Type() string { return TypeEmail }
 
@@ -133,67 +443,175 @@ func (t GMailTunnel) describe() string {
 }
 
 // Send sends a poke thought GMailTunnel
-func (t GMailTunnel) Send(p *Poke) (Record, error) {
+func (t GMailTunnel) Send(ctx context.Context, p *Poke) (Record, error) {
+	start := time.Now()
+	rec, err := t.send(ctx, p)
+	logSend(ctx, t.opts.log(), t, p, rec, err, start)
+	return rec, err
+}
+
+func (t GMailTunnel) send(ctx context.Context, p *Poke) (Record, error) {
+	status, sent, err := t.deliver(ctx, p)
 	rec := Record{
 		MessageID: p.ID,
+		Status:    status,
+		TimeStamp: time.Now(),
+	}
+	if sent != nil {
+		if id := t.messageID(p); id != "" {
+			rec.setMeta(MetaMessageID, id)
+		}
+		if sent.ThreadId != "" {
+			rec.setMeta(MetaThreadID, sent.ThreadId)
+		}
+	}
+	return rec, err
+}
+
+// messageID returns the Message-ID of the email of p, made of the poke ID and the domain of t,
+// so follow-ups can refer to it. It is empty for a poke without ID.
+func (t GMailTunnel) messageID(p *Poke) string {
+	if p.ID == "" {
+		return ""
+	}
+	domain := t.email[strings.LastIndex(t.email, "@")+1:]
+	return "<" + p.ID + "@" + domain + ">"
+}
+
+// compose composes the email message of p, and returns the inline images it embeds, see messageBytes.
+func (t GMailTunnel) compose(p *Poke) (*email.Email, []InlineImage, error) {
+	to, err := validateEmail(p.To)
+	if err != nil {
+		return nil, nil, err
+	}
+	// a line break in a header would let the rest be taken as more headers
+	if strings.ContainsAny(p.Subject, "\r\n") {
+		return nil, nil, fmt.Errorf("%w: line break in subject", ErrInvalidPoke)
 	}
-	// compose email message body
 	msg := &email.Email{
-		To:      []string{p.To},
+		To:      []string{to},
 		Subject: p.Subject,
 		Text:    []byte(p.Body),
 	}
-	rawBs, err := msg.Bytes()
+	if p.HTML != "" {
+		msg.HTML = []byte(injectTrackingPixel(p.HTML, t.opts.trackingURL, p.ID))
+	}
+	msg.Headers = textproto.MIMEHeader{}
+	if id := t.messageID(p); id != "" {
+		msg.Headers.Set("Message-Id", id)
+	}
+	if p.InReplyTo != "" {
+		if strings.ContainsAny(p.InReplyTo, "\r\n") {
+			return nil, nil, fmt.Errorf("%w: line break in in-reply-to", ErrInvalidPoke)
+		}
+		// threads a follow-up under the original in clients of the recipient
+		msg.Headers.Set("In-Reply-To", p.InReplyTo)
+		msg.Headers.Set("References", p.InReplyTo)
+	}
+	if p.Marketing {
+		if t.opts.unsubscribeURL == "" {
+			return nil, nil, fmt.Errorf("%w: marketing poke %s without unsubscribe url", ErrInvalidPoke, p.ID)
+		}
+		link, err := unsubscribeLink(t.opts.unsubscribeURL, t.opts.unsubscribeKey, p.To)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.Headers.Set("List-Unsubscribe", "<"+link+">")
+		msg.Headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		msg.Text = append(msg.Text, []byte("\n\nUnsubscribe: "+link+"\n")...)
+		if msg.HTML != nil {
+			msg.HTML = []byte(injectUnsubscribeFooter(string(msg.HTML), link))
+		}
+	}
+	inline, err := embedImages(msg, t.opts.images)
 	if err != nil {
-		rec.Status = StatusError
-		rec.TimeStamp = time.Now()
-		return rec, err
+		return nil, nil, err
+	}
+	if p.Event != nil {
+		if err := p.Event.Validate(); err != nil {
+			return nil, nil, err
+		}
+		ics := p.Event.ics(p.ID, t.email, p.To)
+		if _, err := msg.Attach(bytes.NewReader(ics), "invite.ics", "text/calendar; charset=utf-8; method=REQUEST"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return msg, inline, nil
+}
+
+// validateEmail checks addr is a RFC 5322 address, like "user+tag@example.com" or
+// "\"first last\"@example.com", and returns it. Line breaks, which could inject headers, are rejected.
+func validateEmail(addr string) (string, error) {
+	if strings.ContainsAny(addr, "\r\n") {
+		return "", fmt.Errorf("%w: line break in recipient", ErrInvalidPoke)
 	}
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", fmt.Errorf("%w: recipient %q: %v", ErrInvalidPoke, addr, err)
+	}
+	return a.String(), nil
+}
 
+// deliver composes and sends p. It returns the status of the send, and the sent message.
+func (t GMailTunnel) deliver(ctx context.Context, p *Poke) (string, *gmail.Message, error) {
+	msg, inline, err := t.compose(p)
+	if err != nil {
+		return StatusError, nil, err
+	}
+	rawBs, err := messageBytes(msg, inline)
+	if err != nil {
+		return StatusError, nil, err
+	}
 	raw := base64.URLEncoding.EncodeToString(rawBs)
-	// use the tunnel.
 
+	// use the tunnel.
 	if t.svc == nil {
-		rec.TimeStamp = time.Now()
-		rec.Status = StatusError
-		return rec, fmt.Errorf("could not get gmail service: %s ", fmt.Sprint(" got `nil` "))
+		return StatusError, nil, fmt.Errorf("could not get gmail service: got `nil`")
 	}
-
-	_, err = t.svc.Users.Messages.Send(t.email, &gmail.Message{
-		Raw: raw,
-	}).Do()
-
+	// gmail puts a message in a thread only if it also has In-Reply-To and a matching subject
+	sent, err := t.svc.Users.Messages.Send(t.email, &gmail.Message{
+		Raw:      raw,
+		ThreadId: p.ThreadID,
+	}).Context(ctx).Do()
 	if err != nil {
-		rec.TimeStamp = time.Now()
-		rec.Status = StatusUndelivered
 		if apiErr, ok := err.(*googleapi.Error); ok {
-			rec.TimeStamp = time.Now()
-			return rec, fmt.Errorf("gmail error: %s", apiErr.Message)
+			return gmailStatus(apiErr), nil, fmt.Errorf("gmail error: %w", apiErr)
 		}
-		return rec, err
+		return StatusError, nil, err
 	}
+	return StatusDelivered, sent, nil
+}
 
-	rec.TimeStamp = time.Now()
-	rec.Status = StatusDelivered
-
-	return rec, nil
+// gmailStatus maps an error of gmail api to a status.
+// Requests gmail rejects, like a bad recipient, are undelivered;
+// requests gmail accepts but fails to process are failed.
+func gmailStatus(err *googleapi.Error) string {
+	if err.Code >= 500 {
+		return StatusFailed
+	}
+	return StatusUndelivered
 }
 
 // LogWrapper is a Tunnel that can save Record during sending a Poke
 type LogWrapper struct {
-	t Tunnel
-	c *firestore.Client
+	t    Tunnel
+	c    *firestore.Client
+	opts tunnelOptions
 }
 
 // NewLogWrapperTunnel returns a LogWrapper.
-func NewLogWrapperTunnel(t Tunnel, c *firestore.Client) *LogWrapper {
+func NewLogWrapperTunnel(t Tunnel, c *firestore.Client, opts ...TunnelOption) *LogWrapper {
 	if c == nil {
 		panic("initailze LogWrapper with invalid firestore client")
 	}
-	return &LogWrapper{
+	w := &LogWrapper{
 		t: t,
 		c: c,
 	}
+	for _, o := range opts {
+		o(&w.opts)
+	}
+	return w
 }
 
 // Type is a method of Tunnel interface
@@ -207,19 +625,25 @@ func (t LogWrapper) describe() string { return t.t.describe() }
 
 // Send is a method of Tunnel interface.
 // A Logger Send a Poke with proper record storage.
-func (t LogWrapper) Send(p *Poke) (Record, error) {
-	ctx := context.TODO()
+func (t LogWrapper) Send(ctx context.Context, p *Poke) (Record, error) {
 	var rec Record
 	var err error
 	rec.MessageID = p.ID
 
 	err = t.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		var err error // local error
-		rec, err = t.t.Send(p)
+		rec, err = t.t.Send(ctx, p)
+		rec = withPokeMetadata(rec, p)
+		rec.Type = t.Type()
 
 		ref := t.c.Collection("service/notify/record").NewDoc()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s", err)
+			t.opts.log().LogAttrs(ctx, slog.LevelError, "send failed",
+				slog.String("tunnel_type", t.Type()),
+				slog.String("poke_id", p.ID),
+				slog.String("status", rec.Status),
+				slog.Any("error", err),
+			)
 		}
 		err = tx.Create(ref, rec)
 		return err
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	twilio "github.com/sfreiberg/gotwilio"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"user@example.com", false},
+		{"user+tag@example.com", false},
+		{"user+tag+more@sub.example.com", false},
+		{`"first last"@example.com`, false},
+		{`"user@home"@example.com`, false},
+		{"First Last <user+tag@example.com>", false},
+		{"", true},
+		{"user", true},
+		{"user@", true},
+		{"@example.com", true},
+		{"user@@example.com", true},
+		{"user@example.com, other@example.com", true},
+		{"user@example.com\r\nBcc: victim@example.com", true},
+		{"user@example.com\nBcc: victim@example.com", true},
+		{"user@example.com\r\n\r\n<html>injected</html>", true},
+		{"\"user\r\nBcc: victim@example.com\"@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			_, err := validateEmail(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateEmail(%q) = %v, want error %v", tt.addr, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPoke) {
+				t.Errorf("validateEmail(%q) = %v, want ErrInvalidPoke", tt.addr, err)
+			}
+		})
+	}
+}
+
+func TestGMailComposeHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      string
+		subject string
+		wantErr bool
+	}{
+		{"valid", "user+tag@example.com", "hello", false},
+		{"recipient injection", "user@example.com\r\nBcc: victim@example.com", "hello", true},
+		{"subject injection", "user@example.com", "hello\r\nBcc: victim@example.com", true},
+		{"subject body injection", "user@example.com", "hello\n\nfake body", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tun := GMailTunnel{email: "from@example.com"}
+			msg, _, err := tun.compose(&Poke{To: tt.to, Subject: tt.subject, Body: "body"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compose() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			raw, err := msg.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(raw), "victim@example.com") {
+				t.Errorf("composed message has an injected header:\n%s", raw)
+			}
+		})
+	}
+}
+
+func TestSMSRecord(t *testing.T) {
+	price := "-0.0075"
+	tests := []struct {
+		name          string
+		resp          *twilio.SmsResponse
+		ex            *twilio.Exception
+		err           error
+		wantStatus    string
+		wantErr       bool
+		wantRateLimit bool
+		wantSID       string
+		wantTimeFlag  bool
+	}{
+		{name: "nil response", wantStatus: StatusError, wantErr: true},
+		{name: "error", err: errors.New("dial"), wantStatus: StatusError, wantErr: true},
+		{name: "rate limited", ex: &twilio.Exception{Status: 429, Code: 20429}, wantStatus: StatusFailed, wantErr: true, wantRateLimit: true},
+		{name: "rejected", ex: &twilio.Exception{Status: 400, Code: 21211}, wantStatus: StatusUndelivered, wantErr: true},
+		{name: "server error", ex: &twilio.Exception{Status: 503}, wantStatus: StatusFailed, wantErr: true},
+		{
+			name:       "sent",
+			resp:       &twilio.SmsResponse{Sid: "SM1", Status: "queued", DateUpdate: "Mon, 02 Jan 2006 15:04:05 +0000", Price: &price},
+			wantStatus: "queued", wantSID: "SM1",
+		},
+		{
+			name:       "unparsable time",
+			resp:       &twilio.SmsResponse{Sid: "SM2", Status: "queued", DateUpdate: "yesterday"},
+			wantStatus: "queued", wantSID: "SM2", wantTimeFlag: true,
+		},
+		{
+			name:       "no time",
+			resp:       &twilio.SmsResponse{Sid: "SM3", Status: "queued"},
+			wantStatus: "queued", wantSID: "SM3", wantTimeFlag: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := smsRecord(Record{MessageID: "p1"}, tt.resp, tt.ex, 0, tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("smsRecord error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrRateLimited); got != tt.wantRateLimit {
+				t.Errorf("rate limited = %v, want %v", got, tt.wantRateLimit)
+			}
+			if rec.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", rec.Status, tt.wantStatus)
+			}
+			if rec.TimeStamp.IsZero() {
+				t.Error("record has no time")
+			}
+			if got := rec.Metadata[MetaProviderID]; got != tt.wantSID {
+				t.Errorf("provider ID = %q, want %q", got, tt.wantSID)
+			}
+			if _, got := rec.Metadata[MetaTimeUnavailable]; got != tt.wantTimeFlag {
+				t.Errorf("time flagged unavailable = %v, want %v", got, tt.wantTimeFlag)
+			}
+		})
+	}
+}
+
+func TestGMailStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		to         string
+		noService  bool
+		code       int // of gmail, 0 for a connection failure
+		wantStatus string
+		wantErr    bool
+	}{
+		{name: "sent", to: "user@example.com", code: http.StatusOK, wantStatus: StatusDelivered},
+		{name: "compose error", to: "not an address", code: http.StatusOK, wantStatus: StatusError, wantErr: true},
+		{name: "no service", to: "user@example.com", noService: true, wantStatus: StatusError, wantErr: true},
+		{name: "rejected", to: "user@example.com", code: http.StatusBadRequest, wantStatus: StatusUndelivered, wantErr: true},
+		{name: "forbidden", to: "user@example.com", code: http.StatusForbidden, wantStatus: StatusUndelivered, wantErr: true},
+		{name: "failed", to: "user@example.com", code: http.StatusInternalServerError, wantStatus: StatusFailed, wantErr: true},
+		{name: "unavailable", to: "user@example.com", code: http.StatusServiceUnavailable, wantStatus: StatusFailed, wantErr: true},
+		{name: "connection failure", to: "user@example.com", wantStatus: StatusError, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.code)
+				if tt.code == http.StatusOK {
+					w.Write([]byte(`{"id":"m1","threadId":"t1"}`))
+					return
+				}
+				w.Write([]byte(`{"error":{"code":` + strconv.Itoa(tt.code) + `,"message":"no"}}`))
+			}))
+			defer srv.Close()
+			if tt.code == 0 {
+				srv.Close()
+			}
+
+			tun := GMailTunnel{email: "from@example.com"}
+			if !tt.noService {
+				svc, err := gmail.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+				if err != nil {
+					t.Fatal(err)
+				}
+				tun.svc = svc
+			}
+			rec, err := tun.send(context.Background(), &Poke{ID: "p1", To: tt.to, Subject: "hi", Body: "body"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send error = %v, want error %v", err, tt.wantErr)
+			}
+			if rec.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", rec.Status, tt.wantStatus)
+			}
+			if rec.TimeStamp.IsZero() {
+				t.Error("record has no time")
+			}
+		})
+	}
+}
+
+func TestSMSTunnelRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		retryAfter string
+		media      bool
+		wantStatus string
+		wantWait   time.Duration // -1 for not rate limited
+	}{
+		{"sent", http.StatusCreated, "", false, "queued", -1},
+		{"rate limited", http.StatusTooManyRequests, "7", false, StatusFailed, 7 * time.Second},
+		{"rate limited mms", http.StatusTooManyRequests, "7", true, StatusFailed, 7 * time.Second},
+		{"rate limited without wait", http.StatusTooManyRequests, "", false, StatusFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				form = r.PostForm
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.code)
+				if tt.code == http.StatusTooManyRequests {
+					w.Write([]byte(`{"code":20429,"message":"Too Many Requests","status":429}`))
+					return
+				}
+				w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+			}))
+			defer srv.Close()
+			c := twilio.NewTwilioClient("AC1", "token")
+			c.BaseUrl = srv.URL
+
+			p := &Poke{ID: "p1", To: "+15555550100", Body: "hi"}
+			if tt.media {
+				p.MediaURL = []string{"https://example.com/a.png"}
+			}
+			rec, err := NewSMSTunnel("+15555550199", c).Send(context.Background(), p)
+			if rec.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", rec.Status, tt.wantStatus)
+			}
+			if form.Get("From") != "+15555550199" || form.Get("To") != "+15555550100" || form.Get("Body") != "hi" {
+				t.Errorf("posted %v", form)
+			}
+			var rl *RateLimitError
+			switch {
+			case tt.wantWait < 0 && err != nil:
+				t.Errorf("Send error = %v", err)
+			case tt.wantWait >= 0 && !errors.As(err, &rl):
+				t.Errorf("Send error = %v, want a RateLimitError", err)
+			case tt.wantWait >= 0 && rl.RetryAfter != tt.wantWait:
+				t.Errorf("RetryAfter = %s, want %s", rl.RetryAfter, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestSMSTunnelStatusCallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		sendAt time.Duration // from now; 0 to send now
+	}{
+		{"sent", 0},
+		{"scheduled", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				form = r.PostForm
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"sid":"SM1","status":"scheduled"}`))
+			}))
+			defer srv.Close()
+			c := twilio.NewTwilioClient("AC1", "token")
+			c.BaseUrl = srv.URL
+
+			p := &Poke{ID: "p1", To: "+15555550100", Body: "hi", CallbackURL: "https://example.com/status"}
+			if tt.sendAt > 0 {
+				p.DateToSend = time.Now().Add(tt.sendAt)
+			}
+			if _, err := NewSMSTunnel("+15555550199", c, WithMessagingService("MG1")).Send(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+			if form.Get("StatusCallback") == "" {
+				t.Errorf("posted no StatusCallback: %v", form)
+			}
+			if _, ok := form["ApplicationSid"]; ok {
+				t.Errorf("posted ApplicationSid, which makes twilio ignore StatusCallback: %v", form)
+			}
+		})
+	}
+}
@@ -1,45 +1,252 @@
 package notify
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
 // Type X is the Type of a Tunnel
 const (
-	TypeSMS   = "sms"
-	TypeEmail = "email"
-	TypeVoice = "voice"
+	TypeSMS      = "sms"
+	TypeEmail    = "email"
+	TypeVoice    = "voice"
+	TypeTeams    = "teams"
+	TypeTelegram = "telegram"
+	TypeDiscord  = "discord"
+	TypeSNS      = "sns"
 )
 
+// tunnelTypes are the Types of tunnels of this package
+var tunnelTypes = []string{TypeSMS, TypeEmail, TypeVoice, TypeTeams, TypeTelegram, TypeDiscord, TypeSNS}
+
+// statuses are all statuses a Record can have
+var statuses = []string{
+	StatusQueued,
+	StatusDelivered,
+	StatusUndelivered,
+	StatusFailed,
+	StatusRead,
+	StatusSuppressed,
+	StatusExpired,
+	StatusSkipped,
+	StatusSLABreached,
+	StatusReplied,
+	StatusError,
+}
+
 // status code that the Poke is
 // Steal from  twilio sms status code. extend the same meaning to other Tunnels
 const (
 	StatusQueued      = "Queued"
 	StatusDelivered   = "Delivered"
 	StatusUndelivered = "Undelievered"
-	StatusFailed      = "Failed" // message could not be sent. usually because the provider not accept the message.
+	StatusFailed      = "Failed"     // message could not be sent. usually because the provider not accept the message.
+	StatusRead        = "Read"       // recipient has opened the message. only some tunnels can tell.
+	StatusSuppressed  = "Suppressed" // not sent, because the recipient must not be contacted.
+	StatusExpired     = "Expired"    // not sent, because it expired before sending.
+	StatusSkipped     = "Skipped"    // not sent, for the reason in metadata.
+
+	// SLABreached is recorded by ListSLABreaches, for a poke not delivered within its SLA.
+	StatusSLABreached = "SLABreached"
+
+	// Replied is recorded by InboundSMSHandler, for a poke the recipient replied to.
+	StatusReplied = "Replied"
 
 	// Error is our error during composing
 	StatusError = "Error"
 )
 
-// Tunnel describe how to send a Poke
+// Record metadata keys set by tunnels
+const (
+	MetaProviderID     = "provider_id"    // ID of the message at the provider, e.g. twilio message SID
+	MetaPrice          = "price"          // provider charged price, as reported by the provider
+	MetaCostEstimated  = "cost_estimated" // "true" if Cost is an estimate of the Dispatcher, see WithCostEstimate
+	MetaDigestOf       = "digest_of"      // comma separated IDs of pokes sent together as a digest
+	MetaSanitized      = "sanitized"      // the body actually sent, if a Sanitizer changed it
+	MetaReason         = "reason"         // why a poke is not sent
+	MetaSender         = "sender"         // the address sent from, if a tunnel has several
+	MetaEventID        = "event_id"       // ID of the provider event a record is made of. records are made once per event.
+	MetaErrorCode      = "error_code"     // error code of the provider, e.g. twilio error 21211
+	MetaMoreInfo       = "more_info"      // url of the provider explaining the error
+	MetaTransliterated = "transliterated" // "true" if the body was transliterated to GSM before sending
+	MetaVariant        = "variant"        // name of the Variant of an ABTunnel experiment sent
+	MetaMessageID      = "message_id"     // Message-ID header of a sent email, for replies to set Poke.InReplyTo
+	MetaThreadID       = "thread_id"      // gmail thread of a sent email
+	MetaOriginalTo     = "original_to"    // the recipient of a test poke, sent to the test recipient instead
+
+	MetaProviderDateUpdated = "provider_date_updated" // raw date_updated of the provider response, as sent
+	MetaProviderDateSent    = "provider_date_sent"    // raw date_sent of the provider response, empty until the provider sends
+	MetaTimeUnavailable     = "time_unavailable"      // why TimeStamp is our clock, not the provider's, if the provider time is unparsable
+	MetaReplyBody           = "reply_body"            // body of an inbound reply, on a StatusReplied record
+	MetaKeyRef              = "key_ref"               // key encrypting the bodies in metadata, see EncryptingStore
+)
+
+// Tunnel describe how to send a Poke.
+// A Tunnel should stop sending when ctx is done, if the provider allows it.
 type Tunnel interface {
 	describe() string
 	Type() string
 	ID() string
-	Send(p *Poke) (Record, error)
+	Send(ctx context.Context, p *Poke) (Record, error)
 }
 
 // Poke is a message to send
 type Poke struct {
 	ID         string    `firestore:"-" json:"id"`
-	Tunnel     string    `firestore:"tunnel" json:"tunnel"`
+	Tunnel     string    `firestore:"tunnel" json:"tunnel"` // a tunnel name in Registry, or a tunnel Type
 	To         string    `firestore:"to" json:"to"`
 	Subject    string    `firestore:"subject,omitempty" json:"subject,omitempty"` // sms ignores subject, because it does not have one.
 	Body       string    `firestore:"body" json:"body"`
-	DateToSend time.Time `firestore:"date_to_send" json:"date_to_send"`
-	Expiry     time.Time `firestore:"expiry" json:"expiry"`
+	HTML       string    `firestore:"html,omitempty" json:"html,omitempty"` // email only. sent as an alternative of Body.
+	DateToSend time.Time `firestore:"date_to_send" json:"date_to_send"`     // zero means as soon as possible. see CreateNow.
+	Expiry     time.Time `firestore:"expiry" json:"expiry"`                 // zero means never expires. see WithDefaultExpiry.
+
+	NotBefore time.Time `firestore:"not_before,omitempty" json:"not_before,omitempty"` // not sent before, even if due. zero means no bound.
+	NotAfter  time.Time `firestore:"not_after,omitempty" json:"not_after,omitempty"`   // not sent after, but archived as expired. zero means no bound.
+
+	SLA time.Duration `firestore:"sla,omitempty" json:"sla,omitempty"` // time to deliver within, from DateToSend, or from when written if it is zero. see ListSLABreaches.
+
+	CallbackURL string   `firestore:"callback_url,omitempty" json:"callback_url,omitempty"` // status callback of this poke. overrides the tunnel's.
+	MediaURL    []string `firestore:"media_url,omitempty" json:"media_url,omitempty"`       // sms only. makes it a MMS. urls must be public https.
+
+	Event     *CalendarEvent `firestore:"event,omitempty" json:"event,omitempty"`         // email only. attached as an ICS invite.
+	Marketing bool           `firestore:"marketing,omitempty" json:"marketing,omitempty"` // adds an unsubscribe link to emails, and needs an opt-in through a ConsentTunnel. transactional pokes leave it false.
+
+	InReplyTo string `firestore:"in_reply_to,omitempty" json:"in_reply_to,omitempty"` // email only. Message-ID of the email this replies to, see MetaMessageID.
+	ThreadID  string `firestore:"thread_id,omitempty" json:"thread_id,omitempty"`     // email only. gmail thread to send in, see MetaThreadID.
+
+	Test bool `firestore:"test,omitempty" json:"test,omitempty"` // test data. sent to the test recipient of the Dispatcher instead of To.
+
+	MaxAttempts int `firestore:"max_attempts,omitempty" json:"max_attempts,omitempty"` // sends before it is dead lettered. zero means the Dispatcher's. see WithDefaultMaxAttempts.
+
+	Attempts int    `firestore:"attempts,omitempty" json:"attempts,omitempty"` // failed sends so far. see Dispatcher WithRetry.
+	KeyRef   string `firestore:"key_ref,omitempty" json:"-"`                   // key encrypting subject and bodies. see EncryptingStore.
+
+	ClaimedBy    string    `firestore:"claimed_by,omitempty" json:"claimed_by,omitempty"` // worker sending this poke
+	ClaimExpires time.Time `firestore:"claim_expires" json:"claim_expires,omitempty"`     // the claim is released after. zero if unclaimed.
+
+	TenantID   string            `firestore:"tenant_id,omitempty" json:"tenant_id,omitempty"`     // tenant of the poke, set by a store isolating tenants. carried to ArchivedPoke and Record.
+	CampaignID string            `firestore:"campaign_id,omitempty" json:"campaign_id,omitempty"` // groups pokes for CampaignStatus. carried to ArchivedPoke and Record.
+	OwnerUID   string            `firestore:"owner_uid,omitempty" json:"owner_uid,omitempty"`     // user the poke is of, for security rules. see ListByOwner. carried to ArchivedPoke and Record.
+	Metadata   map[string]string `firestore:"metadata,omitempty" json:"metadata,omitempty"`       // labels like a template name. carried to ArchivedPoke and Record.
+}
+
+// dueAt returns when p is due: its DateToSend, or its NotBefore if later.
+func (p *Poke) dueAt() time.Time {
+	if p.NotBefore.After(p.DateToSend) {
+		return p.NotBefore
+	}
+	return p.DateToSend
+}
+
+// early reports whether t is before the send window of p begins.
+func (p *Poke) early(t time.Time) bool {
+	return !p.NotBefore.IsZero() && t.Before(p.NotBefore)
+}
+
+// late reports whether t is after the send window of p ends.
+func (p *Poke) late(t time.Time) bool {
+	return !p.NotAfter.IsZero() && t.After(p.NotAfter)
+}
+
+// claimed reports whether p is claimed by a worker at t.
+func (p *Poke) claimed(t time.Time) bool {
+	return p.ClaimedBy != "" && p.ClaimExpires.After(t)
+}
+
+// PokeOption overrides a field of a copy of Poke. See Poke.With.
+type PokeOption func(*Poke)
+
+// WithTo makes a copy be sent to to.
+func WithTo(to string) PokeOption {
+	return func(p *Poke) {
+		p.To = to
+	}
+}
+
+// WithDateToSend makes a copy be sent at t.
+func WithDateToSend(t time.Time) PokeOption {
+	return func(p *Poke) {
+		p.DateToSend = t
+	}
+}
+
+// WithBody makes a copy have body.
+func WithBody(body string) PokeOption {
+	return func(p *Poke) {
+		p.Body = body
+	}
+}
+
+// WithTunnel makes a copy be sent by tunnel.
+func WithTunnel(tunnel string) PokeOption {
+	return func(p *Poke) {
+		p.Tunnel = tunnel
+	}
+}
+
+// Clone returns a deep copy of p to be created as a new poke.
+// Its ID, attempts and claim are empty; the copy shares no slice, map or pointer with p.
+func (p *Poke) Clone() *Poke {
+	c := *p
+	c.ID = ""
+	c.Attempts = 0
+	c.ClaimedBy = ""
+	c.ClaimExpires = time.Time{}
+	if p.MediaURL != nil {
+		c.MediaURL = append([]string{}, p.MediaURL...)
+	}
+	if p.Event != nil {
+		e := *p.Event
+		c.Event = &e
+	}
+	c.Metadata = copyMeta(p.Metadata)
+	return &c
+}
+
+// With returns a Clone of p with opts applied, e.g. one poke per recipient of a template:
+//
+//	for _, to := range recipients {
+//		store.Create(ctx, template.With(notify.WithTo(to)))
+//	}
+func (p *Poke) With(opts ...PokeOption) *Poke {
+	c := p.Clone()
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// ErrInvalidPoke is returned when a Poke fails validation.
+var ErrInvalidPoke = errors.New("notify: invalid poke")
+
+// Validate checks that p has what a Tunnel needs to send it.
+func (p *Poke) Validate() error {
+	switch {
+	case p.Tunnel == "":
+		return fmt.Errorf("%w: missing tunnel", ErrInvalidPoke)
+	case p.To == "":
+		return fmt.Errorf("%w: missing recipient", ErrInvalidPoke)
+	case p.Body == "" && p.HTML == "":
+		return fmt.Errorf("%w: missing body", ErrInvalidPoke)
+	case !p.Expiry.IsZero() && p.Expiry.Before(p.DateToSend):
+		return fmt.Errorf("%w: expiry is before date to send", ErrInvalidPoke)
+	case !p.NotAfter.IsZero() && p.NotAfter.Before(p.NotBefore):
+		return fmt.Errorf("%w: send window ends before it begins", ErrInvalidPoke)
+	case strings.ContainsAny(p.To, "\r\n"):
+		return fmt.Errorf("%w: line break in recipient", ErrInvalidPoke)
+	case strings.ContainsAny(p.Subject, "\r\n"):
+		return fmt.Errorf("%w: line break in subject", ErrInvalidPoke)
+	}
+	if p.Event != nil {
+		if err := p.Event.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPoke, err)
+		}
+	}
+	return nil
 }
 
 // ArchivedPoke is an archeived or delivered Poke
@@ -48,6 +255,151 @@ type ArchivedPoke struct {
 	Tunnel  string `firestore:"tunnel" json:"tunnel"`
 	To      string `firestore:"to" json:"to"`
 	Expired bool   `firestore:"expired" json:"expired"` // is it get archived becuase of expired
+
+	Recipient string `firestore:"recipient,omitempty" json:"-"` // To, normalized if a phone number with a country code. see ListByRecipient.
+
+	ArchivedAt time.Time `firestore:"archived_at,omitempty" json:"archived_at,omitempty"`
+
+	DeadLettered     bool   `firestore:"dead_lettered,omitempty" json:"dead_lettered,omitempty"` // given up on, e.g. failed every attempt. see ListDeadLettered.
+	DeadLetterReason string `firestore:"dead_letter_reason,omitempty" json:"dead_letter_reason,omitempty"`
+
+	// content of the poke. kept only if the store retains bodies.
+	Subject    string         `firestore:"subject,omitempty" json:"subject,omitempty"`
+	Body       string         `firestore:"body,omitempty" json:"body,omitempty"`
+	HTML       string         `firestore:"html,omitempty" json:"html,omitempty"`
+	MediaURL   []string       `firestore:"media_url,omitempty" json:"media_url,omitempty"`
+	Event      *CalendarEvent `firestore:"event,omitempty" json:"event,omitempty"`
+	DateToSend time.Time      `firestore:"date_to_send,omitempty" json:"date_to_send,omitempty"`
+
+	// the rest of the poke, see Poke
+	Expiry      time.Time     `firestore:"expiry,omitempty" json:"expiry,omitempty"`
+	NotBefore   time.Time     `firestore:"not_before,omitempty" json:"not_before,omitempty"`
+	NotAfter    time.Time     `firestore:"not_after,omitempty" json:"not_after,omitempty"`
+	SLA         time.Duration `firestore:"sla,omitempty" json:"sla,omitempty"`
+	CallbackURL string        `firestore:"callback_url,omitempty" json:"callback_url,omitempty"`
+	Marketing   bool          `firestore:"marketing,omitempty" json:"marketing,omitempty"`
+	InReplyTo   string        `firestore:"in_reply_to,omitempty" json:"in_reply_to,omitempty"`
+	ThreadID    string        `firestore:"thread_id,omitempty" json:"thread_id,omitempty"`
+	Test        bool          `firestore:"test,omitempty" json:"test,omitempty"`
+	MaxAttempts int           `firestore:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+	Attempts    int           `firestore:"attempts,omitempty" json:"attempts,omitempty"`
+	KeyRef      string        `firestore:"key_ref,omitempty" json:"-"`
+
+	TenantID   string            `firestore:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	CampaignID string            `firestore:"campaign_id,omitempty" json:"campaign_id,omitempty"`
+	OwnerUID   string            `firestore:"owner_uid,omitempty" json:"owner_uid,omitempty"`
+	Metadata   map[string]string `firestore:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// Archive returns p archived at now, content included.
+// Every field of p but its claim, which ends with the queue, is kept.
+func (p *Poke) Archive(now time.Time) *ArchivedPoke {
+	return &ArchivedPoke{
+		ID:          p.ID,
+		Tunnel:      p.Tunnel,
+		To:          p.To,
+		Recipient:   recipientKey(p.To),
+		Expired:     !p.Expiry.IsZero() && now.After(p.Expiry) || p.late(now),
+		ArchivedAt:  now,
+		Subject:     p.Subject,
+		Body:        p.Body,
+		HTML:        p.HTML,
+		MediaURL:    copyStrings(p.MediaURL),
+		Event:       p.Event,
+		DateToSend:  p.DateToSend,
+		Expiry:      p.Expiry,
+		NotBefore:   p.NotBefore,
+		NotAfter:    p.NotAfter,
+		SLA:         p.SLA,
+		CallbackURL: p.CallbackURL,
+		Marketing:   p.Marketing,
+		InReplyTo:   p.InReplyTo,
+		ThreadID:    p.ThreadID,
+		Test:        p.Test,
+		MaxAttempts: p.MaxAttempts,
+		Attempts:    p.Attempts,
+		KeyRef:      p.KeyRef,
+		TenantID:    p.TenantID,
+		CampaignID:  p.CampaignID,
+		OwnerUID:    p.OwnerUID,
+		Metadata:    copyMeta(p.Metadata),
+	}
+}
+
+// dropContent removes the content of a
+func (a *ArchivedPoke) dropContent() {
+	a.Subject = ""
+	a.Body = ""
+	a.HTML = ""
+	a.MediaURL = nil
+	a.Event = nil
+	a.DateToSend = time.Time{}
+}
+
+// ToPoke returns the poke a is archived from, as far as a keeps it: p.Archive(t).ToPoke() is p, unclaimed.
+// Without content, retained by WithArchiveRetainBody, the poke has no subject, bodies, media or event.
+func (a *ArchivedPoke) ToPoke() *Poke {
+	return &Poke{
+		ID:          a.ID,
+		Tunnel:      a.Tunnel,
+		To:          a.To,
+		Subject:     a.Subject,
+		Body:        a.Body,
+		HTML:        a.HTML,
+		MediaURL:    copyStrings(a.MediaURL),
+		Event:       a.Event,
+		DateToSend:  a.DateToSend,
+		Expiry:      a.Expiry,
+		NotBefore:   a.NotBefore,
+		NotAfter:    a.NotAfter,
+		SLA:         a.SLA,
+		CallbackURL: a.CallbackURL,
+		Marketing:   a.Marketing,
+		InReplyTo:   a.InReplyTo,
+		ThreadID:    a.ThreadID,
+		Test:        a.Test,
+		MaxAttempts: a.MaxAttempts,
+		Attempts:    a.Attempts,
+		KeyRef:      a.KeyRef,
+		TenantID:    a.TenantID,
+		CampaignID:  a.CampaignID,
+		OwnerUID:    a.OwnerUID,
+		Metadata:    copyMeta(a.Metadata),
+	}
+}
+
+// ErrNotRetained is returned when an archived poke does not keep its content.
+var ErrNotRetained = errors.New("notify: archived poke content not retained")
+
+// PokeFromArchive rebuilds a poke to send again from a.
+// It fails with ErrNotRetained if a does not keep the content. The poke has no failed attempts.
+func PokeFromArchive(a *ArchivedPoke) (*Poke, error) {
+	if a.Body == "" && a.HTML == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotRetained, a.ID)
+	}
+	p := a.ToPoke()
+	p.Attempts = 0 // sent again from the start
+	return p, nil
+}
+
+// copyStrings returns a copy of ss
+func copyStrings(ss []string) []string {
+	if ss == nil {
+		return nil
+	}
+	return append([]string(nil), ss...)
+}
+
+// copyMeta returns a copy of m
+func copyMeta(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
 
 // Record is a delivery record of a Poke. It lists all status change.
@@ -56,4 +408,56 @@ type Record struct {
 	ID        string    `firestore:"-" json:"id"`
 	Status    string    `firestore:"status" json:"status"`
 	TimeStamp time.Time `firestore:"timestamp" json:"timestamp"`
+	Type      string    `firestore:"type,omitempty" json:"type,omitempty"` // Type of the tunnel sent the poke
+
+	Cost     float64 `firestore:"cost,omitempty" json:"cost,omitempty"`         // charged by the provider, or estimated, see MetaCostEstimated. see SumCost.
+	Currency string  `firestore:"currency,omitempty" json:"currency,omitempty"` // ISO 4217 code of Cost, e.g. "USD"
+
+	TenantID   string            `firestore:"tenant_id,omitempty" json:"tenant_id,omitempty"`     // tenant of the poke
+	CampaignID string            `firestore:"campaign_id,omitempty" json:"campaign_id,omitempty"` // campaign of the poke
+	OwnerUID   string            `firestore:"owner_uid,omitempty" json:"owner_uid,omitempty"`     // owner of the poke
+	Metadata   map[string]string `firestore:"metadata,omitempty" json:"metadata,omitempty"`
+
+	History []RecordEntry `firestore:"history,omitempty" json:"history,omitempty"` // records before this one, collapsed by CompactRecords
+}
+
+// RecordEntry is a Record collapsed into the History of a later record of its message.
+type RecordEntry struct {
+	Status    string            `firestore:"status" json:"status"`
+	TimeStamp time.Time         `firestore:"timestamp" json:"timestamp"`
+	Metadata  map[string]string `firestore:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// setMeta sets metadata k of r to v
+func (r *Record) setMeta(k, v string) {
+	if r.Metadata == nil {
+		r.Metadata = make(map[string]string)
+	}
+	r.Metadata[k] = v
+}
+
+// withPokeMetadata returns rec with metadata, the tenant, the campaign and the owner of p added.
+// Keys set by the tunnel win over keys of the poke.
+func withPokeMetadata(rec Record, p *Poke) Record {
+	if rec.TenantID == "" {
+		rec.TenantID = p.TenantID
+	}
+	if rec.CampaignID == "" {
+		rec.CampaignID = p.CampaignID
+	}
+	if rec.OwnerUID == "" {
+		rec.OwnerUID = p.OwnerUID
+	}
+	if len(p.Metadata) == 0 {
+		return rec
+	}
+	m := make(map[string]string, len(p.Metadata)+len(rec.Metadata))
+	for k, v := range p.Metadata {
+		m[k] = v
+	}
+	for k, v := range rec.Metadata {
+		m[k] = v
+	}
+	rec.Metadata = m
+	return rec
 }
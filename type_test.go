@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPokeValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      string
+		subject string
+		wantErr bool
+	}{
+		{"plain", "user@example.com", "hello", false},
+		{"subaddress", "user+tag@example.com", "hello", false},
+		{"phone", "+15555550100", "", false},
+		{"CRLF in recipient", "user@example.com\r\nBcc: victim@example.com", "hello", true},
+		{"LF in recipient", "user@example.com\nBcc: victim@example.com", "hello", true},
+		{"CR in recipient", "user@example.com\rBcc: victim@example.com", "hello", true},
+		{"CRLF in subject", "user@example.com", "hello\r\nBcc: victim@example.com", true},
+		{"LF in subject", "user@example.com", "hello\nContent-Type: text/html", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Poke{Tunnel: TypeEmail, To: tt.to, Subject: tt.subject, Body: "body"}
+			err := p.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPoke) {
+				t.Errorf("Validate() = %v, want ErrInvalidPoke", err)
+			}
+		})
+	}
+}
+
+func TestArchiveToPoke(t *testing.T) {
+	tests := []struct {
+		name   string
+		retain bool
+		drop   []string // fields of Poke the archive does not keep
+	}{
+		{"retained", true, []string{"ClaimedBy", "ClaimExpires"}},
+		{"content dropped", false, []string{"ClaimedBy", "ClaimExpires", "Subject", "Body", "HTML", "MediaURL", "Event", "DateToSend"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Poke
+			fill(t, reflect.ValueOf(&p).Elem())
+			a := p.Archive(time.Now())
+			if !tt.retain {
+				a.dropContent()
+			}
+			want := p
+			for _, f := range tt.drop {
+				v := reflect.ValueOf(&want).Elem().FieldByName(f)
+				v.Set(reflect.Zero(v.Type()))
+			}
+			if got := a.ToPoke(); !reflect.DeepEqual(*got, want) {
+				t.Errorf("ToPoke of Archive =\n%+v\nwant\n%+v", *got, want)
+			}
+		})
+	}
+}
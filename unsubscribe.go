@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadUnsubscribeToken is returned when an unsubscribe token is malformed, tampered or expired.
+var ErrBadUnsubscribeToken = errors.New("notify: bad unsubscribe token")
+
+// unsubscribeTTL is how long an unsubscribe link works after sending.
+// CAN-SPAM requires at least 30 days.
+const unsubscribeTTL = 90 * 24 * time.Hour
+
+// UnsubscribeToken returns a token of recipient to, valid until expires, signed with key.
+func UnsubscribeToken(key []byte, to string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(expires.Unix(), 10) + "|" + to))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(unsubscribeMAC(key, payload))
+}
+
+// ParseUnsubscribeToken verifies token with key and returns its recipient.
+func ParseUnsubscribeToken(key []byte, token string) (string, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return "", ErrBadUnsubscribeToken
+	}
+	payload := token[:i]
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, unsubscribeMAC(key, payload)) {
+		return "", ErrBadUnsubscribeToken
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrBadUnsubscribeToken
+	}
+	parts := strings.SplitN(string(bs), "|", 2)
+	if len(parts) != 2 {
+		return "", ErrBadUnsubscribeToken
+	}
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().After(time.Unix(exp, 0)) {
+		return "", ErrBadUnsubscribeToken
+	}
+	return parts[1], nil
+}
+
+func unsubscribeMAC(key []byte, payload string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// unsubscribeLink returns the unsubscribe url of recipient to, passing the token as query "token".
+func unsubscribeLink(base string, key []byte, to string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", UnsubscribeToken(key, to, time.Now().Add(unsubscribeTTL)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// injectUnsubscribeFooter puts an unsubscribe link at the end of the html body.
+func injectUnsubscribeFooter(body, link string) string {
+	footer := `<p style="font-size:small"><a href="` + html.EscapeString(link) + `">Unsubscribe</a></p>`
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + footer + body[i:]
+	}
+	return body + footer
+}
+
+// unsubscribePage is the page of an unsubscribe link, confirming by a POST of its form
+const unsubscribePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body><form method="post" action="%s">
+<p>Unsubscribe from these emails?</p>
+<button type="submit" name="List-Unsubscribe" value="One-Click">Unsubscribe</button>
+</form></body></html>
+`
+
+// UnsubscribeHandler adds the recipient of the token given in query "token" to list.
+// Tokens are verified with key, the same key given to WithUnsubscribe.
+// Only POST unsubscribes: one-click List-Unsubscribe posts it, see RFC 8058.
+// GET, from the link in the footer, serves a page confirming by a POST, as mail scanners
+// and link prefetchers follow links without the recipient asking to unsubscribe.
+func UnsubscribeHandler(list *SuppressionList, key []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		to, err := ParseUnsubscribeToken(key, r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid or expired unsubscribe link", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, unsubscribePage, html.EscapeString(r.URL.RequestURI()))
+			return
+		}
+		if err := list.Add(r.Context(), to, "unsubscribed"); err != nil {
+			slog.ErrorContext(r.Context(), "unsubscribe failed", slog.Any("error", err))
+			http.Error(w, "could not unsubscribe", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("You have been unsubscribed.\n"))
+	}
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnsubscribeHandler(t *testing.T) {
+	key := []byte("key")
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		code   int
+		want   bool // recipient unsubscribed
+	}{
+		{"link followed", http.MethodGet, UnsubscribeToken(key, "a@example.com", time.Now().Add(time.Hour)), http.StatusOK, false},
+		{"one-click", http.MethodPost, UnsubscribeToken(key, "a@example.com", time.Now().Add(time.Hour)), http.StatusOK, true},
+		{"expired", http.MethodPost, UnsubscribeToken(key, "a@example.com", time.Now().Add(-time.Hour)), http.StatusBadRequest, false},
+		{"other key", http.MethodPost, UnsubscribeToken([]byte("other"), "a@example.com", time.Now().Add(time.Hour)), http.StatusBadRequest, false},
+		{"put", http.MethodPut, UnsubscribeToken(key, "a@example.com", time.Now().Add(time.Hour)), http.StatusMethodNotAllowed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeClient(t)
+			list := NewSuppressionList(c, "suppressed")
+			target := "/unsubscribe?" + url.Values{"token": {tt.token}}.Encode()
+			req := httptest.NewRequest(tt.method, target, strings.NewReader("List-Unsubscribe=One-Click"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			UnsubscribeHandler(list, key).ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if tt.method == http.MethodGet && !strings.Contains(rec.Body.String(), `method="post"`) {
+				t.Errorf("page of the link has no form to post: %s", rec.Body)
+			}
+			got, err := list.Suppressed(context.Background(), "a@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("unsubscribed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
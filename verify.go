@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrVerifyUnsupported is returned by Verify for tunnels that can not ask the provider for a status.
+var ErrVerifyUnsupported = errors.New("notify: tunnel can not verify status")
+
+// StatusChecker is a Tunnel that can ask its provider for the current status of a message.
+type StatusChecker interface {
+	// CheckStatus returns the status of the message providerID, as recorded in MetaProviderID.
+	CheckStatus(ctx context.Context, providerID string) (string, error)
+}
+
+// Verify asks the provider of t for the status of the message of rec, and returns it.
+// If it differs from rec.Status, rec is updated with it; the caller may keep it by CreateRecord,
+// as records are a history of statuses.
+// It fails with ErrVerifyUnsupported if t is not a StatusChecker, or rec has no provider ID.
+func Verify(ctx context.Context, t Tunnel, rec *Record) (string, error) {
+	sc, ok := t.(StatusChecker)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrVerifyUnsupported, t.Type())
+	}
+	pid := rec.Metadata[MetaProviderID]
+	if pid == "" {
+		return "", fmt.Errorf("%w: record %s has no provider id", ErrVerifyUnsupported, rec.ID)
+	}
+	status, err := sc.CheckStatus(ctx, pid)
+	if err != nil {
+		return "", err
+	}
+	if status != rec.Status {
+		rec.Status = status
+		rec.TimeStamp = time.Now()
+	}
+	return status, nil
+}
+
+// CheckStatus is a method of StatusChecker interface. It fetches the message sid from twilio.
+func (t SMSTunnel) CheckStatus(ctx context.Context, sid string) (string, error) {
+	resp, ex, _, err := t.twilioMessage(ctx, http.MethodGet, sid, nil)
+	if err != nil {
+		return "", err
+	}
+	if ex != nil {
+		return "", fmt.Errorf("twilio exception: %w", *ex)
+	}
+	if status, ok := twilioStatuses[resp.Status]; ok {
+		return status, nil
+	}
+	return resp.Status, nil
+}
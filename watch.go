@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchHorizon is how far ahead of now a listener of Watch covers.
+// Listeners are reopened every horizon, moving it forward.
+const watchHorizon = time.Hour
+
+// watchRetry is the wait before reopening a listener broken by a transient error.
+const watchRetry = time.Second
+
+// Watch sends pokes over the returned poke channel as they are created or changed while due,
+// using a firestore snapshot listener rather than polling.
+// The pokes due when Watch starts are sent first. Claimed pokes are skipped, but pokes are not claimed.
+//
+// Firestore can not notify when a poke becomes due with time, only when it is written,
+// so a poke created ahead of its date to send is not sent when it becomes due, but only when
+// the listener is next reopened, up to watchHorizon later.
+// Combine Watch with a short poll of ListToSend or ClaimToSend for those.
+//
+// Listeners are reopened every watchHorizon and on transient errors. A poke is sent once for each
+// write of it: pokes already sent are not sent again by a reopened listener unless changed since.
+// Both channels are closed when ctx is done or another error occurs; the error is sent over the error channel before it is closed.
+func (s *firePokeStore) Watch(c context.Context) (<-chan *Poke, <-chan error) {
+	pokes := make(chan *Poke)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(pokes)
+		sent := make(watchSent)
+		for {
+			err := s.watch(c, pokes, sent)
+			if c.Err() != nil {
+				return
+			}
+			if err == nil {
+				continue
+			}
+			if !transient(err) {
+				errs <- firePokeStoreErr{
+					err,
+					"watch",
+					"",
+				}
+				return
+			}
+			s.logger.LogAttrs(c, slog.LevelWarn, "store watch interrupted", slog.Any("error", err))
+			select {
+			case <-time.After(watchRetry):
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return pokes, errs
+}
+
+// watch listens to pokes due within watchHorizon, and sends due ones to out, but those in sent.
+// It returns nil when the horizon passes, to be reopened.
+func (s *firePokeStore) watch(parent context.Context, out chan<- *Poke, sent watchSent) error {
+	ctx, cancel := context.WithTimeout(parent, watchHorizon)
+	defer cancel()
+
+	q, err := s.scope(ctx, s.pokeQuery().Where(s.fields.DateToSend, "<", time.Now().Add(watchHorizon)))
+	if err != nil {
+		return err
+	}
+	iter := q.Snapshots(ctx)
+	defer iter.Stop()
+	for first := true; ; first = false {
+		snap, err := iter.Next()
+		if err != nil {
+			if parent.Err() == nil && ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		if first {
+			// the first snapshot adds every poke of the listener; the others left it before the reopen
+			ids := make(map[string]bool, len(snap.Changes))
+			for _, ch := range snap.Changes {
+				ids[s.idOf(ch.Doc.Ref)] = true
+			}
+			sent.keep(ids)
+		}
+		for _, ch := range snap.Changes {
+			id := s.idOf(ch.Doc.Ref)
+			if ch.Kind == firestore.DocumentRemoved {
+				delete(sent, id)
+				continue
+			}
+			if sent.has(id, ch.Doc.UpdateTime) {
+				continue
+			}
+			p := new(Poke)
+			if err := s.decodePoke(ch.Doc, p); err != nil {
+				return err
+			}
+			p.ID = id
+			if p.DateToSend.After(now) || p.claimed(now) || p.early(now) {
+				continue
+			}
+			select {
+			case out <- p:
+				sent[id] = ch.Doc.UpdateTime
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// watchSent is the update time of the pokes sent by Watch, by id, kept across its listeners
+type watchSent map[string]time.Time
+
+// has reports whether the poke id was sent as written at updated
+func (w watchSent) has(id string, updated time.Time) bool {
+	t, ok := w[id]
+	return ok && t.Equal(updated)
+}
+
+// keep drops the pokes not in ids
+func (w watchSent) keep(ids map[string]bool) {
+	for id := range w {
+		if !ids[id] {
+			delete(w, id)
+		}
+	}
+}
+
+// transient reports whether err of firestore may go away by retrying
+func transient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Internal, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
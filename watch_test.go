@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchSent(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		sent    watchSent
+		keep    map[string]bool // ids of the next listener, nil to not reopen
+		id      string
+		updated time.Time
+		want    bool
+	}{
+		{"not sent", watchSent{}, nil, "p1", t0, false},
+		{"sent", watchSent{"p1": t0}, nil, "p1", t0, true},
+		{"changed since", watchSent{"p1": t0}, nil, "p1", t0.Add(time.Second), false},
+		{"other poke", watchSent{"p2": t0}, nil, "p1", t0, false},
+		{"kept on reopen", watchSent{"p1": t0}, map[string]bool{"p1": true}, "p1", t0, true},
+		{"dropped on reopen", watchSent{"p1": t0}, map[string]bool{"p2": true}, "p1", t0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.keep != nil {
+				tt.sent.keep(tt.keep)
+			}
+			if got := tt.sent.has(tt.id, tt.updated); got != tt.want {
+				t.Errorf("has(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}